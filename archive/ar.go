@@ -0,0 +1,103 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package archive
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/maxim2266/stout"
+)
+
+// Ar constructs a chunk function that writes the given entries as a Unix ar archive, as used
+// for .deb packages and static libraries. Entry names must not be longer than 16 bytes, and must
+// not contain spaces or '/' characters. Only regular files are supported. The body of each entry
+// is buffered in memory before writing.
+func Ar(entries ...Entry) stout.Chunk {
+	return func(w *stout.Writer) (n int64, err error) {
+		var k int
+
+		if k, err = w.WriteString("!<arch>\n"); err != nil {
+			return
+		}
+
+		n = int64(k)
+
+		for i := range entries {
+			var m int64
+
+			if m, err = writeArEntry(w, &entries[i]); err != nil {
+				err = fmt.Errorf("ar entry %q: %w", entries[i].Name, err)
+				return
+			}
+
+			n += m
+		}
+
+		return
+	}
+}
+
+func writeArEntry(w *stout.Writer, e *Entry) (int64, error) {
+	if len(e.Name) == 0 || len(e.Name) > 16 || strings.ContainsAny(e.Name, " /") {
+		return 0, errors.New("invalid name")
+	}
+
+	if !e.Mode.IsRegular() {
+		return 0, fmt.Errorf("unsupported file mode %s", e.Mode)
+	}
+
+	body, err := e.render()
+
+	if err != nil {
+		return 0, err
+	}
+
+	var mtime int64
+
+	if !e.ModTime.IsZero() {
+		mtime = stout.ClampTime(e.ModTime).Unix()
+	}
+
+	hdr := fmt.Sprintf("%-16s%-12d%-6d%-6d%-8o%-10d`\n",
+		e.Name, mtime, e.UID, e.GID, 0100000|uint32(e.Mode.Perm()), len(body))
+
+	if len(hdr) != 60 {
+		return 0, errors.New("header field overflow")
+	}
+
+	chunks := []stout.Chunk{stout.String(hdr), stout.ByteSlice(body)}
+
+	if len(body)%2 != 0 {
+		chunks = append(chunks, stout.Byte('\n'))
+	}
+
+	return w.WriteChunks(chunks)
+}
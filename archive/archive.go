@@ -0,0 +1,67 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+/*
+Package archive provides chunk functions writing simple archive formats, cpio ("newc") and Unix ar,
+where the body of each archive entry is an arbitrary stout chunk.
+*/
+package archive
+
+import (
+	"bytes"
+	"io/fs"
+	"time"
+
+	"github.com/maxim2266/stout"
+)
+
+// Entry is a member of an archive.
+type Entry struct {
+	Name    string      // name of the entry
+	Mode    fs.FileMode // permission bits and type; only regular files and directories are supported
+	ModTime time.Time   // modification time
+	UID     int         // user id
+	GID     int         // group id
+	Body    stout.Chunk // content of the entry; may be nil for empty files and directories
+}
+
+// render the body of the entry; the archive formats require the size to be written
+// before the content, so the content is buffered in memory
+func (e *Entry) render() ([]byte, error) {
+	if e.Body == nil {
+		return nil, nil
+	}
+
+	var b bytes.Buffer
+
+	if _, err := stout.ByteBufferStream(&b).Write(e.Body); err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
@@ -0,0 +1,98 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package archive
+
+import (
+	"io/fs"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/maxim2266/stout"
+)
+
+func TestCpio(t *testing.T) {
+	var b strings.Builder
+
+	n, err := stout.StringBuilderStream(&b).Write(Cpio(
+		Entry{Name: "dir", Mode: 0755 | fs.ModeDir},
+		Entry{Name: "dir/file", Mode: 0644, Body: stout.String("Hello")},
+	))
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	res := b.String()
+
+	if n != int64(len(res)) || len(res)%4 != 0 {
+		t.Errorf("Unexpected size: %d", n)
+		return
+	}
+
+	if !strings.HasPrefix(res, "070701") || !strings.Contains(res, "dir/file\x00") {
+		t.Errorf("Unexpected result: %q", res)
+		return
+	}
+
+	if !strings.Contains(res, "Hello\x00\x00\x00") || !strings.Contains(res, "TRAILER!!!\x00") {
+		t.Errorf("Unexpected result: %q", res)
+		return
+	}
+}
+
+func TestAr(t *testing.T) {
+	var b strings.Builder
+
+	_, err := stout.StringBuilderStream(&b).Write(Ar(
+		Entry{Name: "debian-binary", Mode: 0644, ModTime: time.Unix(1000, 0), Body: stout.String("2.0\n")},
+		Entry{Name: "odd", Mode: 0600, Body: stout.String("abc")},
+	))
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	const exp = "!<arch>\n" +
+		"debian-binary   1000        0     0     100644  4         `\n2.0\n" +
+		"odd             0           0     0     100600  3         `\nabc\n"
+
+	if s := b.String(); s != exp {
+		t.Errorf("Unexpected result:\n%q\ninstead of\n%q", s, exp)
+		return
+	}
+
+	// invalid name
+	if _, err = stout.StringBuilderStream(&b).Write(Ar(Entry{Name: "a/b"})); err == nil {
+		t.Error("Missing error")
+		return
+	}
+}
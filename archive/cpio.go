@@ -0,0 +1,111 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package archive
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/maxim2266/stout"
+)
+
+// Cpio constructs a chunk function that writes the given entries as a cpio archive in "newc"
+// format, as used for Linux initramfs images. The archive is terminated with the standard trailer
+// entry. The body of each entry is buffered in memory before writing.
+func Cpio(entries ...Entry) stout.Chunk {
+	return func(w *stout.Writer) (n int64, err error) {
+		var m int64
+
+		for i := range entries {
+			if m, err = writeCpioEntry(w, &entries[i], uint32(i+1)); err != nil {
+				err = fmt.Errorf("cpio entry %q: %w", entries[i].Name, err)
+				return
+			}
+
+			n += m
+		}
+
+		m, err = writeCpioEntry(w, &Entry{Name: "TRAILER!!!"}, 0)
+		n += m
+		return
+	}
+}
+
+func writeCpioEntry(w *stout.Writer, e *Entry, ino uint32) (int64, error) {
+	var mode uint32
+
+	switch {
+	case e.Name == "TRAILER!!!":
+		// zero mode
+	case e.Mode.IsDir():
+		mode = 0040000 | uint32(e.Mode.Perm())
+	case e.Mode.IsRegular():
+		mode = 0100000 | uint32(e.Mode.Perm())
+	default:
+		return 0, fmt.Errorf("unsupported file mode %s", e.Mode)
+	}
+
+	body, err := e.render()
+
+	if err != nil {
+		return 0, err
+	}
+
+	if len(body) > 0 && e.Mode.IsDir() {
+		return 0, errors.New("directory with content")
+	}
+
+	var mtime int64
+
+	if !e.ModTime.IsZero() {
+		mtime = stout.ClampTime(e.ModTime).Unix()
+	}
+
+	nlink := 1
+
+	if e.Mode.IsDir() {
+		nlink = 2
+	}
+
+	hdr := fmt.Sprintf("070701%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X",
+		ino, mode, e.UID, e.GID, nlink, mtime, len(body), 0, 0, 0, 0, len(e.Name)+1, 0)
+
+	return w.WriteChunks([]stout.Chunk{
+		stout.String(hdr),
+		stout.String(e.Name),
+		stout.Zeros(int64(1 + pad4(len(hdr)+len(e.Name)+1))),
+		stout.ByteSlice(body),
+		stout.Zeros(int64(pad4(len(body)))),
+	})
+}
+
+// padding to 4-byte boundary
+func pad4(n int) int {
+	return (4 - n%4) % 4
+}
@@ -0,0 +1,90 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+// AuditedStream constructs a stream that writes to the primary stream, and also writes a copy
+// of all the data successfully written to the primary stream to the audit stream, after applying
+// the given redaction function (which may be nil). The redaction function is called once per each
+// write to the underlying stream, and it may modify its argument. Even a single chunk may come
+// in several writes (for example, data from an io.Reader are copied in pieces of 32Kb), so a secret
+// may be split between two calls, and the function cannot rely on seeing it whole. Any error
+// from the audit stream fails the write, as an unaudited stream is not acceptable in most settings
+// where auditing is required. Both streams are flushed and closed when the returned stream is.
+func AuditedStream(primary, audit Stream, redact func([]byte) []byte) Stream {
+	if redact == nil {
+		redact = func(s []byte) []byte { return s }
+	}
+
+	s := WriterStream(&auditWriter{primary: primary.w, audit: audit.w, redact: redact})
+
+	s.w.flush = func() (err error) {
+		if err = primary.w.Flush(); err == nil {
+			err = audit.w.Flush()
+		}
+
+		return
+	}
+
+	pc, ac := primary.w.closeFunc(), audit.w.closeFunc()
+
+	s.w.closeWithError = func(err error) (e error) {
+		if pc != nil {
+			e = pc(err)
+		}
+
+		if ac != nil {
+			if e2 := ac(err); e == nil {
+				e = e2
+			}
+		}
+
+		return
+	}
+
+	return s
+}
+
+type auditWriter struct {
+	primary, audit *Writer
+	redact         func([]byte) []byte
+	buff           []byte
+}
+
+func (a *auditWriter) Write(s []byte) (n int, err error) {
+	if n, err = a.primary.Write(s); n > 0 {
+		// the redaction function may modify the data, so pass a copy
+		a.buff = append(a.buff[:0], s[:n]...)
+
+		if _, e := a.audit.Write(a.redact(a.buff)); e != nil && err == nil {
+			err = e
+		}
+	}
+
+	return
+}
@@ -0,0 +1,72 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+)
+
+func TestAuditedStream(t *testing.T) {
+	var out, log bytes.Buffer
+
+	re := regexp.MustCompile(`token=\w+`)
+
+	redact := func(s []byte) []byte { return re.ReplaceAll(s, []byte("token=***")) }
+
+	_, err := AuditedStream(ByteBufferStream(&out), ByteBufferStream(&log), redact).Write(
+		String("user=joe "),
+		String("token=abc123"),
+		String("\n"),
+	)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if exp := "user=joe token=abc123\n"; out.String() != exp {
+		t.Errorf("Unexpected output: %q instead of %q", out.String(), exp)
+		return
+	}
+
+	if exp := "user=joe token=***\n"; log.String() != exp {
+		t.Errorf("Unexpected audit log: %q instead of %q", log.String(), exp)
+		return
+	}
+
+	// audit failure fails the stream
+	w := limitWriter{limit: 3}
+
+	if _, err = AuditedStream(ByteBufferStream(&out), WriterStream(&w), nil).Write(String("aaaa")); err == nil {
+		t.Error("Missing error")
+		return
+	}
+}
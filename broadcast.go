@@ -0,0 +1,282 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+// ErrSlowConsumer is the error recorded for a subscriber that has been disconnected
+// by the SlowDisconnect policy.
+var ErrSlowConsumer = errors.New("slow consumer disconnected")
+
+// SlowConsumerPolicy defines what a Broadcaster does when a subscriber buffer is full.
+type SlowConsumerPolicy int
+
+const (
+	// SlowDrop discards the data that does not fit into the subscriber buffer.
+	SlowDrop SlowConsumerPolicy = iota
+	// SlowDisconnect removes the subscriber, with its error set to ErrSlowConsumer.
+	SlowDisconnect
+	// SlowBlock makes the broadcasting stream wait until the subscriber catches up.
+	SlowBlock
+)
+
+// Broadcaster fans out all the data written to it to a dynamic set of subscribers,
+// each with its own buffer and slow consumer policy. A subscriber attached in the
+// middle of a stream receives only the data written after the attachment.
+// Broadcaster implements io.Writer, and it never fails a write due to a subscriber error.
+type Broadcaster struct {
+	lock   sync.Mutex
+	subs   map[*Subscription]struct{}
+	closed bool
+}
+
+// NewBroadcaster constructs a new Broadcaster with no subscribers.
+func NewBroadcaster() *Broadcaster {
+	return &Broadcaster{subs: make(map[*Subscription]struct{})}
+}
+
+// Stream returns a stream writing to the broadcaster. Closing the stream does not close
+// the broadcaster, so the function may be called more than once.
+func (b *Broadcaster) Stream() Stream {
+	return WriterStream(b)
+}
+
+// Subscribe attaches the given writer to the broadcaster. The subscriber gets a buffer
+// of the given size in bytes, and the policy defines what happens when the buffer is full.
+// A write bigger than the buffer size is still accepted into an empty buffer.
+// The writer is never called concurrently.
+func (b *Broadcaster) Subscribe(w io.Writer, buffSize int, policy SlowConsumerPolicy) *Subscription {
+	if buffSize <= 0 {
+		panic("stout: invalid subscriber buffer size")
+	}
+
+	s := &Subscription{
+		b:      b,
+		w:      w,
+		limit:  buffSize,
+		policy: policy,
+		done:   make(chan struct{}),
+	}
+
+	s.cond.L = &s.lock
+
+	b.lock.Lock()
+
+	if b.closed {
+		s.err = io.ErrClosedPipe
+		s.closed = true
+		close(s.done)
+	} else {
+		b.subs[s] = struct{}{}
+		go s.run()
+	}
+
+	b.lock.Unlock()
+	return s
+}
+
+// Write implements io.Writer interface.
+func (b *Broadcaster) Write(p []byte) (int, error) {
+	b.lock.Lock()
+
+	if b.closed {
+		b.lock.Unlock()
+		return 0, io.ErrClosedPipe
+	}
+
+	subs := make([]*Subscription, 0, len(b.subs))
+
+	for s := range b.subs {
+		subs = append(subs, s)
+	}
+
+	b.lock.Unlock()
+
+	if len(p) > 0 && len(subs) > 0 {
+		data := append([]byte(nil), p...) // shared between all subscribers
+
+		for _, s := range subs {
+			s.push(data)
+		}
+	}
+
+	return len(p), nil
+}
+
+// Close detaches all subscribers after delivering all their buffered data,
+// and returns the first subscriber error, if any. Subsequent writes to the
+// broadcaster return io.ErrClosedPipe.
+func (b *Broadcaster) Close() (err error) {
+	b.lock.Lock()
+
+	b.closed = true
+
+	subs := b.subs
+
+	b.subs = nil
+	b.lock.Unlock()
+
+	for s := range subs {
+		if e := s.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+
+	return
+}
+
+// Subscription represents a subscriber attached to a Broadcaster.
+type Subscription struct {
+	b       *Broadcaster
+	w       io.Writer
+	limit   int
+	policy  SlowConsumerPolicy
+	lock    sync.Mutex
+	cond    sync.Cond
+	queue   [][]byte
+	size    int
+	dropped int64
+	err     error
+	closed  bool
+	done    chan struct{}
+}
+
+// Close detaches the subscriber from the broadcaster, waits until all the buffered data
+// are delivered, and returns the subscriber error, if any.
+func (s *Subscription) Close() error {
+	s.detach()
+
+	s.lock.Lock()
+	s.closed = true
+	s.cond.Broadcast()
+	s.lock.Unlock()
+
+	<-s.done
+	return s.Err()
+}
+
+// Err returns the subscriber error, if any.
+func (s *Subscription) Err() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.err
+}
+
+// Dropped returns the number of bytes discarded by the SlowDrop policy.
+func (s *Subscription) Dropped() int64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.dropped
+}
+
+// add data to the subscriber queue, applying the policy
+func (s *Subscription) push(data []byte) {
+	s.lock.Lock()
+
+	for s.err == nil && !s.closed && s.size > 0 && s.size+len(data) > s.limit {
+		switch s.policy {
+		case SlowDrop:
+			s.dropped += int64(len(data))
+			s.lock.Unlock()
+			return
+		case SlowDisconnect:
+			s.err = ErrSlowConsumer
+			s.closed = true
+			s.cond.Broadcast()
+			s.lock.Unlock()
+			s.detach()
+			return
+		default:
+			s.cond.Wait()
+		}
+	}
+
+	if s.err == nil && !s.closed {
+		s.queue = append(s.queue, data)
+		s.size += len(data)
+		s.cond.Broadcast()
+	}
+
+	s.lock.Unlock()
+}
+
+// delivery loop
+func (s *Subscription) run() {
+	defer close(s.done)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for {
+		for len(s.queue) == 0 && !s.closed {
+			s.cond.Wait()
+		}
+
+		if len(s.queue) == 0 || s.err != nil {
+			return
+		}
+
+		data := s.queue[0]
+
+		s.queue[0] = nil
+		s.queue = s.queue[1:]
+
+		s.lock.Unlock()
+
+		_, err := s.w.Write(data)
+
+		s.lock.Lock()
+
+		s.size -= len(data)
+		s.cond.Broadcast()
+
+		if err != nil {
+			s.err = err
+			s.closed = true
+			s.queue = nil
+			s.size = 0
+
+			go s.detach()
+			return
+		}
+	}
+}
+
+// remove the subscriber from the broadcaster
+func (s *Subscription) detach() {
+	s.b.lock.Lock()
+	delete(s.b.subs, s)
+	s.b.lock.Unlock()
+}
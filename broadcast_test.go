@@ -0,0 +1,132 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestBroadcaster(t *testing.T) {
+	b := NewBroadcaster()
+
+	var buffs [3]syncBuffer
+
+	subs := []*Subscription{
+		b.Subscribe(&buffs[0], 10, SlowBlock),
+		b.Subscribe(&buffs[1], 1000, SlowDrop),
+		b.Subscribe(&buffs[2], 1000, SlowDisconnect),
+	}
+
+	exp := strings.Repeat("0123456789", 100)
+
+	if _, err := b.Stream().Write(String(exp[:500]), String(exp[500:])); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := b.Close(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	for i := range buffs {
+		if res := buffs[i].String(); res != exp {
+			t.Errorf("Unexpected result from subscriber %d: %d bytes", i, len(res))
+			return
+		}
+
+		if err := subs[i].Err(); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	if _, err := b.Write([]byte("x")); err == nil {
+		t.Error("Missing error after close")
+		return
+	}
+}
+
+func TestBroadcasterSlowConsumer(t *testing.T) {
+	b := NewBroadcaster()
+	gate := make(chan struct{})
+	w := &gatedWriter{gate: gate}
+
+	drop := b.Subscribe(w, 3, SlowDrop)
+	disc := b.Subscribe(&gatedWriter{gate: gate}, 3, SlowDisconnect)
+
+	for i := 0; i < 5; i++ {
+		b.Write([]byte("abc"))
+	}
+
+	close(gate)
+
+	if err := drop.Close(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if drop.Dropped() == 0 {
+		t.Error("Nothing dropped")
+		return
+	}
+
+	if n := int64(w.buff.Len()) + drop.Dropped(); n != 15 {
+		t.Errorf("Unexpected number of bytes: %d instead of 15", n)
+		return
+	}
+
+	if err := disc.Close(); !errors.Is(err, ErrSlowConsumer) {
+		t.Error("Unexpected error:", err)
+		return
+	}
+
+	// failing subscriber
+	b.Subscribe(&limitWriter{}, 10, SlowBlock)
+
+	b.Write([]byte("abc"))
+
+	if err := b.Close(); err == nil {
+		t.Error("Missing error from subscriber")
+		return
+	}
+}
+
+type gatedWriter struct {
+	gate chan struct{}
+	buff bytes.Buffer
+}
+
+func (w *gatedWriter) Write(p []byte) (int, error) {
+	<-w.gate
+	return w.buff.Write(p)
+}
@@ -0,0 +1,134 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"bytes"
+	"math/bits"
+	"sync"
+	"sync/atomic"
+)
+
+// BufferPool is a pool of memory buffers used by the chunk functions that render their
+// output into memory before writing it to a stream (like Optional). Implementations must
+// be safe for concurrent use.
+type BufferPool interface {
+	// Get returns an empty buffer, preferably with the capacity of at least the given
+	// number of bytes; the size hint may be zero if unknown.
+	Get(sizeHint int) *bytes.Buffer
+	// Put returns the buffer to the pool.
+	Put(b *bytes.Buffer)
+}
+
+// SetBufferPool replaces the package-level buffer pool with the given one, and returns
+// the previous pool. Passing nil restores the default pool.
+func SetBufferPool(pool BufferPool) BufferPool {
+	if pool == nil {
+		pool = defaultBufferPool
+	}
+
+	return *bufferPool.Swap(&pool)
+}
+
+// NewBufferPool constructs a buffer pool based on sync.Pool, with size classes of powers of two
+// from minSize up to maxSize bytes. Buffers that have grown beyond maxSize are not retained.
+func NewBufferPool(minSize, maxSize int) BufferPool {
+	if minSize <= 0 || maxSize < minSize {
+		panic("stout: invalid buffer pool size classes")
+	}
+
+	minShift := bits.Len(uint(minSize - 1))
+	maxShift := bits.Len(uint(maxSize - 1))
+
+	return &sizedPool{
+		minShift: minShift,
+		maxSize:  maxSize,
+		classes:  make([]sync.Pool, maxShift-minShift+1),
+	}
+}
+
+var (
+	defaultBufferPool = NewBufferPool(1024, 1024*1024)
+	bufferPool        atomic.Pointer[BufferPool]
+)
+
+func init() {
+	bufferPool.Store(&defaultBufferPool)
+}
+
+// get a buffer from the package-level pool
+func getBuffer(sizeHint int) *bytes.Buffer {
+	return (*bufferPool.Load()).Get(sizeHint)
+}
+
+// return the buffer to the package-level pool
+func putBuffer(b *bytes.Buffer) {
+	(*bufferPool.Load()).Put(b)
+}
+
+// sync.Pool based buffer pool with size classes
+type sizedPool struct {
+	minShift int
+	maxSize  int         // buffers with larger capacity are not retained
+	classes  []sync.Pool // class i holds buffers with capacity of at least 1 << (minShift + i)
+}
+
+func (p *sizedPool) Get(sizeHint int) *bytes.Buffer {
+	i := max(bits.Len(uint(max(sizeHint, 1)-1))-p.minShift, 0)
+
+	if i >= len(p.classes) {
+		b := new(bytes.Buffer)
+
+		b.Grow(sizeHint)
+		return b
+	}
+
+	if b, ok := p.classes[i].Get().(*bytes.Buffer); ok {
+		return b
+	}
+
+	b := new(bytes.Buffer)
+
+	b.Grow(1 << (p.minShift + i))
+	return b
+}
+
+func (p *sizedPool) Put(b *bytes.Buffer) {
+	if b.Cap() > p.maxSize {
+		return
+	}
+
+	// the largest class with the size not above the buffer capacity
+	i := bits.Len(uint(b.Cap())) - 1 - p.minShift
+
+	if i >= 0 && i < len(p.classes) {
+		b.Reset()
+		p.classes[i].Put(b)
+	}
+}
@@ -0,0 +1,115 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"bytes"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestBufferPool(t *testing.T) {
+	p := NewBufferPool(1024, 4096)
+
+	for _, hint := range []int{0, 1, 1000, 1024, 1025, 4096, 10000} {
+		b := p.Get(hint)
+
+		if b.Len() != 0 || b.Cap() < hint {
+			t.Errorf("Unexpected buffer for size hint %d: len %d, cap %d", hint, b.Len(), b.Cap())
+			return
+		}
+
+		b.WriteString("zzz")
+		p.Put(b)
+	}
+
+	// buffers from the pool must be empty
+	if b := p.Get(0); b.Len() != 0 {
+		t.Errorf("Non-empty buffer from the pool: %q", b.String())
+		return
+	}
+
+	// buffers above the maximum size are not retained
+	big := bytes.NewBuffer(make([]byte, 0, 6000))
+
+	p.Put(big)
+
+	if p.Get(4096) == big {
+		t.Error("Oversized buffer retained")
+		return
+	}
+}
+
+func TestSetBufferPool(t *testing.T) {
+	var pool countingPool
+
+	pool.BufferPool = NewBufferPool(16, 1024)
+
+	prev := SetBufferPool(&pool)
+
+	defer SetBufferPool(prev)
+
+	var b strings.Builder
+
+	if _, err := StringBuilderStream(&b).Write(Optional(String("aaa"), nil)); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if b.String() != "aaa" {
+		t.Errorf("Unexpected result: %q instead of %q", b.String(), "aaa")
+		return
+	}
+
+	if pool.gets.Load() != 1 || pool.puts.Load() != 1 {
+		t.Errorf("Unexpected pool usage: %d gets, %d puts", pool.gets.Load(), pool.puts.Load())
+		return
+	}
+
+	if SetBufferPool(nil) != &pool {
+		t.Error("Unexpected previous pool")
+		return
+	}
+}
+
+type countingPool struct {
+	BufferPool
+	gets, puts atomic.Int64
+}
+
+func (p *countingPool) Get(sizeHint int) *bytes.Buffer {
+	p.gets.Add(1)
+	return p.BufferPool.Get(sizeHint)
+}
+
+func (p *countingPool) Put(b *bytes.Buffer) {
+	p.puts.Add(1)
+	p.BufferPool.Put(b)
+}
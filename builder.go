@@ -0,0 +1,187 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"bufio"
+	"compress/gzip"
+	"hash"
+	"io"
+	"time"
+)
+
+// Builder assembles a stream from a sink and a number of layers on top of it, like buffering,
+// compression, hashing, or rate limiting. Each method adds a layer on top of the previously added
+// ones, so the data written to the resulting stream pass through the layers in the reverse order:
+// for example, in
+//
+//	To(w).Buffered(64*1024).Gzip().Hash(sha256.New()).RateLimit(1<<20).Stream()
+//
+// the data are first rate limited, then hashed, then compressed, and then buffered before
+// being written to w. The Builder is not meant to be reused after the call to Stream().
+type Builder struct {
+	sink      io.Writer
+	w         io.Writer
+	err       error
+	finish    []func() error // in the order of the layers being added
+	closeSink bool
+}
+
+// To starts building a stream on top of the given sink. The sink is not closed by the resulting
+// stream, unless requested via Builder.Closing() function.
+func To(w io.Writer) *Builder {
+	return &Builder{sink: w, w: w}
+}
+
+// Buffered adds a buffer of the given size.
+func (b *Builder) Buffered(size int) *Builder {
+	if b.err == nil {
+		buff := bufio.NewWriterSize(b.w, size)
+
+		b.add(buff, buff.Flush)
+	}
+
+	return b
+}
+
+// Compressed adds a compressing (or otherwise encoding) layer using the given codec.
+func (b *Builder) Compressed(codec Codec) *Builder {
+	if b.err == nil {
+		var enc io.WriteCloser
+
+		if enc, b.err = codec(b.w); b.err == nil {
+			b.add(enc, enc.Close)
+		}
+	}
+
+	return b
+}
+
+// Gzip adds gzip compression with the default compression level.
+func (b *Builder) Gzip() *Builder {
+	return b.Compressed(func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriter(w), nil })
+}
+
+// Hash adds a layer that feeds all the data passing through it into the given hash.
+func (b *Builder) Hash(h hash.Hash) *Builder {
+	if b.err == nil {
+		b.add(io.MultiWriter(b.w, h), nil)
+	}
+
+	return b
+}
+
+// RateLimit adds a layer that limits the throughput to the given number of bytes per second.
+func (b *Builder) RateLimit(bytesPerSecond int64) *Builder {
+	if b.err == nil {
+		if bytesPerSecond <= 0 {
+			panic("stout: invalid rate limit")
+		}
+
+		b.add(&rateLimiter{w: b.w, rate: bytesPerSecond}, nil)
+	}
+
+	return b
+}
+
+// Closing makes the resulting stream close the sink, if the sink implements io.Closer.
+func (b *Builder) Closing() *Builder {
+	b.closeSink = true
+	return b
+}
+
+// Stream returns the resulting stream, or the first error encountered while building it.
+// When the stream gets closed upon exit from its Write() function, all the layers are finalised
+// (flushed or closed) in the order from the topmost one down to the sink.
+func (b *Builder) Stream() (s Stream, err error) {
+	if err = b.err; err != nil {
+		return
+	}
+
+	s = WriterStream(b.w)
+	s.w.flush = nil // finalisation is done on close
+
+	finish := b.finish
+
+	if c, ok := b.sink.(io.Closer); ok && b.closeSink {
+		finish = append([]func() error{c.Close}, finish...)
+	}
+
+	s.w.close = func() (err error) {
+		for i := len(finish) - 1; i >= 0; i-- {
+			if e := finish[i](); e != nil && err == nil {
+				err = e
+			}
+		}
+
+		return
+	}
+
+	return
+}
+
+// add a layer
+func (b *Builder) add(w io.Writer, finish func() error) {
+	b.w = w
+
+	if finish != nil {
+		b.finish = append(b.finish, finish)
+	}
+}
+
+// io.Writer that limits the throughput
+type rateLimiter struct {
+	w     io.Writer
+	rate  int64 // bytes per second
+	start time.Time
+	n     int64 // bytes written since the start
+}
+
+func (r *rateLimiter) Write(s []byte) (n int, err error) {
+	if r.start.IsZero() {
+		r.start = clockNow()
+	}
+
+	for len(s) > 0 && err == nil {
+		// write at most 1/10th of a second worth of data at a time
+		k := int(min64(int64(len(s)), max64(r.rate/10, 1)))
+
+		// wait until the data are allowed to go
+		time.Sleep(r.start.Add(time.Duration(float64(r.n) / float64(r.rate) * float64(time.Second))).Sub(clockNow()))
+
+		var m int
+
+		m, err = r.w.Write(s[:k])
+		n += m
+		r.n += int64(m)
+		s = s[m:]
+	}
+
+	return
+}
@@ -0,0 +1,148 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuilder(t *testing.T) {
+	var buff bytes.Buffer
+
+	h := sha256.New()
+	exp := strings.Repeat("0123456789", 10000)
+
+	s, err := To(&buff).Buffered(64 * 1024).Gzip().Hash(h).RateLimit(1 << 30).Stream()
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if _, err = s.Write(String(exp)); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// check the content
+	var r *gzip.Reader
+
+	if r, err = gzip.NewReader(&buff); err != nil {
+		t.Error(err)
+		return
+	}
+
+	var data []byte
+
+	if data, err = io.ReadAll(r); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if string(data) != exp {
+		t.Errorf("Unexpected result of %d bytes", len(data))
+		return
+	}
+
+	// check the hash
+	sum := sha256.Sum256([]byte(exp))
+
+	if got := h.Sum(nil); !bytes.Equal(got, sum[:]) {
+		t.Errorf("Unexpected hash: %s", hex.EncodeToString(got))
+		return
+	}
+}
+
+func TestBuilderErrors(t *testing.T) {
+	codec := func(io.Writer) (io.WriteCloser, error) { return nil, errors.New("test error") }
+
+	if _, err := To(io.Discard).Compressed(codec).Buffered(100).Stream(); err == nil {
+		t.Error("Missing error")
+		return
+	}
+
+	// closing the sink
+	var c closeRecorder
+
+	s, err := To(&c).Buffered(100).Closing().Stream()
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if _, err = s.Write(String("aaa")); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if !c.closed || c.String() != "aaa" {
+		t.Errorf("Unexpected sink state: closed %v, content %q", c.closed, c.String())
+		return
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	s, err := To(io.Discard).RateLimit(10000).Stream()
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	start := time.Now()
+
+	if _, err = s.Write(String(strings.Repeat("z", 3000))); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if d := time.Since(start); d < 200*time.Millisecond {
+		t.Error("Rate limit not applied:", d)
+		return
+	}
+}
+
+type closeRecorder struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
@@ -0,0 +1,172 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+/*
+Package bundle assembles diagnostic (support) bundles: named sections produced by stout chunks,
+disk files, or commands are collected into a single tar.gz archive. Failure of any one section
+does not abort the archive, instead the error message is recorded in the archive in place of
+the section's content.
+*/
+package bundle
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"io"
+	"io/fs"
+	"time"
+
+	"github.com/maxim2266/stout"
+)
+
+// Bundle is a collection of named sections to be written to a tar.gz archive.
+// The zero value is an empty bundle ready to use.
+type Bundle struct {
+	sections []section
+}
+
+type section struct {
+	name  string
+	chunk stout.Chunk
+}
+
+// Add appends a section with the given name and content to the bundle. The name
+// becomes the path of the section within the archive.
+func (b *Bundle) Add(name string, chunk stout.Chunk) *Bundle {
+	b.sections = append(b.sections, section{name, chunk})
+	return b
+}
+
+// AddFile appends a section with the given name and the content of the given disk file.
+func (b *Bundle) AddFile(name, pathname string) *Bundle {
+	return b.Add(name, stout.File(pathname))
+}
+
+// AddCommand appends a section with the given name and the output of the given command.
+func (b *Bundle) AddCommand(name string, cmd string, args ...string) *Bundle {
+	return b.Add(name, stout.Command(cmd, args...))
+}
+
+// AddCommandContext is like AddCommand, but also takes a context which when becomes done
+// terminates the process.
+func (b *Bundle) AddCommandContext(ctx context.Context, name string, cmd string, args ...string) *Bundle {
+	return b.Add(name, stout.CommandContext(ctx, cmd, args...))
+}
+
+// ErrorSuffix is appended to the name of a failed section to form the name of the
+// archive entry holding the error message.
+const ErrorSuffix = ".error.txt"
+
+// Archive constructs a chunk function that writes all the sections of the bundle as
+// a tar.gz archive. Each section is first rendered to a temporary file, and in case of
+// an error the entry "<name>.error.txt" with the error message is written instead of the section.
+// Only errors from the target stream terminate the archive. The entries are timestamped with
+// the time of the chunk invocation, as returned by stout.CurrentTime function.
+func (b *Bundle) Archive() stout.Chunk {
+	return func(w *stout.Writer) (n int64, err error) {
+		cw := countingWriter{w: w}
+		gz := gzip.NewWriter(&cw)
+		tw := tar.NewWriter(gz)
+		now := stout.CurrentTime()
+
+		for _, s := range b.sections {
+			if err = writeSection(tw, s, now); err != nil {
+				return cw.n, err
+			}
+		}
+
+		if err = tw.Close(); err == nil {
+			err = gz.Close()
+		}
+
+		return cw.n, err
+	}
+}
+
+// WriteFile writes the bundle archive to the given disk file, atomically.
+func (b *Bundle) WriteFile(pathname string, perm fs.FileMode) (int64, error) {
+	return stout.AtomicWriteFile(pathname, perm, b.Archive())
+}
+
+// render the section to a temporary file and copy it to the archive
+func writeSection(tw *tar.Writer, s section, now time.Time) error {
+	temp, size, err := stout.WriteTempFile(s.chunk)
+
+	if err != nil {
+		return writeError(tw, s.name, now, err)
+	}
+
+	defer stout.CurrentFileSystem().Remove(temp)
+
+	hdr := tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     s.name,
+		Mode:     0644,
+		Size:     size,
+		ModTime:  now,
+	}
+
+	if err = tw.WriteHeader(&hdr); err != nil {
+		return err
+	}
+
+	_, err = stout.WriterStream(tw).Write(stout.File(temp))
+	return err
+}
+
+// write error message entry
+func writeError(tw *tar.Writer, name string, now time.Time, err error) error {
+	msg := err.Error() + "\n"
+
+	hdr := tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name + ErrorSuffix,
+		Mode:     0644,
+		Size:     int64(len(msg)),
+		ModTime:  now,
+	}
+
+	if err = tw.WriteHeader(&hdr); err == nil {
+		_, err = io.WriteString(tw, msg)
+	}
+
+	return err
+}
+
+// io.Writer that counts the number of bytes written
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(s []byte) (n int, err error) {
+	n, err = c.w.Write(s)
+	c.n += int64(n)
+	return
+}
@@ -0,0 +1,175 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/maxim2266/stout"
+)
+
+func TestBundle(t *testing.T) {
+	var b Bundle
+
+	b.Add("hello.txt", stout.String("Hello, world!")).
+		Add("broken.txt", func(_ *stout.Writer) (int64, error) { return 0, errors.New("test error") }).
+		AddFile("missing.txt", "this-file-does-not-exist")
+
+	var buff bytes.Buffer
+
+	n, err := stout.ByteBufferStream(&buff).Write(b.Archive())
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if n != int64(buff.Len()) {
+		t.Errorf("Unexpected number of bytes written: %d instead of %d", n, buff.Len())
+		return
+	}
+
+	entries, err := readArchive(&buff)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if len(entries) != 3 {
+		t.Errorf("Unexpected number of entries: %d", len(entries))
+		return
+	}
+
+	if s := entries["hello.txt"]; s != "Hello, world!" {
+		t.Errorf("Unexpected content of hello.txt: %q", s)
+		return
+	}
+
+	if s := entries["broken.txt"+ErrorSuffix]; !strings.Contains(s, "test error") {
+		t.Errorf("Unexpected error message: %q", s)
+		return
+	}
+
+	if _, ok := entries["missing.txt"+ErrorSuffix]; !ok {
+		t.Error("Missing error entry for missing.txt")
+		return
+	}
+}
+
+func readArchive(src io.Reader) (map[string]string, error) {
+	gz, err := gzip.NewReader(src)
+
+	if err != nil {
+		return nil, err
+	}
+
+	tr := tar.NewReader(gz)
+	res := make(map[string]string)
+
+	for {
+		hdr, err := tr.Next()
+
+		if err == io.EOF {
+			return res, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		var b strings.Builder
+
+		if _, err = io.Copy(&b, tr); err != nil {
+			return nil, err
+		}
+
+		res[hdr.Name] = b.String()
+	}
+}
+
+func TestDeterministicBundle(t *testing.T) {
+	defer stout.SetDeterministic(stout.SetDeterministic(true))
+
+	t.Setenv("SOURCE_DATE_EPOCH", "1000")
+
+	var b Bundle
+
+	b.Add("a.txt", stout.String("aaa")).Add("b.txt", stout.String("bbb"))
+
+	var b1, b2 bytes.Buffer
+
+	// the clock moves between the two archives
+	now := time.Now()
+
+	defer stout.SetClock(stout.SetClock(func() time.Time { return now }))
+
+	if _, err := stout.ByteBufferStream(&b1).Write(b.Archive()); err != nil {
+		t.Error(err)
+		return
+	}
+
+	now = now.Add(time.Hour)
+
+	if _, err := stout.ByteBufferStream(&b2).Write(b.Archive()); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if !bytes.Equal(b1.Bytes(), b2.Bytes()) {
+		t.Error("Archives differ")
+		return
+	}
+
+	gz, err := gzip.NewReader(&b1)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	hdr, err := tar.NewReader(gz).Next()
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if hdr.ModTime.Unix() != 1000 {
+		t.Errorf("Unexpected modification time: %s", hdr.ModTime)
+		return
+	}
+}
@@ -0,0 +1,222 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Cached constructs a chunk function that caches the output of the given chunk in a file within
+// the specified directory. The cache file name is derived from the key returned by the key function
+// (which is called on each invocation of the chunk). On a cache hit the content of the cache file
+// is copied to the stream, otherwise the chunk is invoked, with its output written to the stream,
+// and at the same time to a temporary file in the cache directory, which is moved in place of
+// the cache file upon successful completion of the chunk. Failures to write the cache (including
+// creation of the cache directory) do not fail the chunk, the output is just not cached.
+// See CachePolicy for expiration and size limits.
+func Cached(cacheDir string, key func() (string, error), chunk Chunk) Chunk {
+	return CachePolicy{Key: key}.Cached(cacheDir, chunk)
+}
+
+// CachePolicy specifies the caching of chunk output, typically from remote sources like HTTP requests
+// or commands, to avoid repeated calls to the upstream when generating reports. The policy value can
+// be shared by many chunks using the same cache directory.
+type CachePolicy struct {
+	// TTL, if positive, is the time after which a cache entry becomes stale, and the chunk gets
+	// invoked again to refresh it.
+	TTL time.Duration
+
+	// MaxSize, if positive, is the limit on the total size of the cache directory; after a new
+	// entry is stored, the oldest entries are removed until the total size is within the limit.
+	MaxSize int64
+
+	// Key returns the cache key for the chunk; it must not be nil.
+	Key func() (string, error)
+}
+
+// Cached is like the package-level Cached function, but with the policy applied.
+func (p CachePolicy) Cached(cacheDir string, chunk Chunk) Chunk {
+	if p.Key == nil {
+		panic("stout: missing cache key function")
+	}
+
+	return func(w *Writer) (n int64, err error) {
+		var k string
+
+		if k, err = p.Key(); err != nil {
+			return
+		}
+
+		pathname := filepath.Join(cacheDir, cacheFileName(k))
+
+		// cache hit
+		var file FileHandle
+
+		if file, err = p.open(pathname); err == nil {
+			return w.readFromAndClose(file)
+		}
+
+		if !errors.Is(err, fs.ErrNotExist) {
+			return
+		}
+
+		// cache miss
+		if n, err = renderToCache(w, pathname, chunk); err == nil && p.MaxSize > 0 {
+			p.evict(cacheDir)
+		}
+
+		return
+	}
+}
+
+// open the cache file, if it exists and is not stale
+func (p CachePolicy) open(pathname string) (FileHandle, error) {
+	fsys := currentFS()
+
+	if p.TTL > 0 {
+		info, err := fsys.Lstat(pathname)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if clockSince(info.ModTime()) > p.TTL {
+			return nil, fs.ErrNotExist
+		}
+	}
+
+	return fsys.OpenFile(pathname, os.O_RDONLY, 0)
+}
+
+// remove the oldest cache entries until the total size is within the limit; errors are ignored
+func (p CachePolicy) evict(cacheDir string) {
+	entries, err := os.ReadDir(cacheDir)
+
+	if err != nil {
+		return
+	}
+
+	var files []fs.FileInfo
+	var total int64
+
+	for _, e := range entries {
+		if !e.Type().IsRegular() || strings.HasPrefix(e.Name(), "tmp-") {
+			continue
+		}
+
+		if info, err := e.Info(); err == nil {
+			files = append(files, info)
+			total += info.Size()
+		}
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].ModTime().Before(files[j].ModTime()) })
+
+	fsys := currentFS()
+
+	for i := 0; total > p.MaxSize && i < len(files); i++ {
+		if fsys.Remove(filepath.Join(cacheDir, files[i].Name())) == nil {
+			total -= files[i].Size()
+		}
+	}
+}
+
+// cache file name for the given key
+func cacheFileName(key string) string {
+	sum := sha256.Sum256([]byte(key))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// invoke the chunk, writing its output to both the stream and the cache file
+func renderToCache(w *Writer, pathname string, chunk Chunk) (n int64, err error) {
+	dir := filepath.Dir(pathname)
+	fsys := currentFS()
+
+	var temp FileHandle
+
+	if err = os.MkdirAll(dir, 0755); err == nil {
+		temp, err = fsys.CreateTemp(dir, "tmp-")
+	}
+
+	if err != nil {
+		// no caching
+		return chunk(w)
+	}
+
+	defer func() {
+		if temp != nil {
+			temp.Close()
+			fsys.Remove(temp.Name())
+		}
+	}()
+
+	cw := cacheWriter{w: w, cache: bufio.NewWriter(temp)}
+
+	if n, err = chunk(WriterStream(&cw).w.inherit(w)); err != nil || cw.err != nil {
+		return
+	}
+
+	// commit the cache file
+	if cw.err = cw.cache.Flush(); cw.err == nil {
+		if cw.err = temp.Sync(); cw.err == nil {
+			cw.err = temp.Close()
+		}
+	}
+
+	if cw.err == nil && fsys.Rename(temp.Name(), pathname) == nil {
+		temp = nil
+	}
+
+	return
+}
+
+// io.Writer that also writes to the cache; an error from the cache only stops the caching
+type cacheWriter struct {
+	w     *Writer
+	cache *bufio.Writer
+	err   error // cache write error
+}
+
+func (cw *cacheWriter) Write(s []byte) (n int, err error) {
+	if n, err = cw.w.Write(s); cw.err == nil {
+		_, cw.err = cw.cache.Write(s[:n])
+	}
+
+	return
+}
@@ -0,0 +1,196 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCached(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "cache")
+
+	calls := 0
+	chunk := func(w *Writer) (int64, error) {
+		calls++
+		return String("expensive result")(w)
+	}
+
+	key := func() (string, error) { return "key", nil }
+
+	for i := 0; i < 3; i++ {
+		var b strings.Builder
+
+		if _, err := StringBuilderStream(&b).Write(Cached(dir, key, chunk)); err != nil {
+			t.Error(err)
+			return
+		}
+
+		if b.String() != "expensive result" {
+			t.Errorf("[%d] Unexpected result: %q", i, b.String())
+			return
+		}
+	}
+
+	if calls != 1 {
+		t.Errorf("Unexpected number of calls: %d", calls)
+		return
+	}
+
+	// failed chunk is not cached
+	fail := func(w *Writer) (int64, error) {
+		calls++
+		return 0, errors.New("test error")
+	}
+
+	failKey := func() (string, error) { return "fail", nil }
+
+	for i := 0; i < 2; i++ {
+		var b strings.Builder
+
+		if _, err := StringBuilderStream(&b).Write(Cached(dir, failKey, fail)); err == nil {
+			t.Error("Missing error")
+			return
+		}
+	}
+
+	if calls != 3 {
+		t.Errorf("Unexpected number of calls: %d", calls)
+		return
+	}
+
+	// only one file, no temporaries
+	entries, err := os.ReadDir(dir)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if len(entries) != 1 || entries[0].Name() != cacheFileName("key") {
+		t.Errorf("Unexpected cache content: %v", entries)
+		return
+	}
+
+	// key error
+	keyErr := func() (string, error) { return "", errors.New("key error") }
+
+	if _, err = StringBuilderStream(&strings.Builder{}).Write(Cached(dir, keyErr, chunk)); err == nil {
+		t.Error("Missing error")
+		return
+	}
+}
+
+func TestCachePolicy(t *testing.T) {
+	dir := t.TempDir()
+
+	calls := 0
+	chunk := func(w *Writer) (int64, error) {
+		calls++
+		return String("0123456789")(w)
+	}
+
+	run := func(p CachePolicy) error {
+		var b strings.Builder
+
+		if _, err := StringBuilderStream(&b).Write(p.Cached(dir, chunk)); err != nil {
+			return err
+		}
+
+		if b.String() != "0123456789" {
+			return errors.New("unexpected result: " + b.String())
+		}
+
+		return nil
+	}
+
+	key := func(k string) func() (string, error) {
+		return func() (string, error) { return k, nil }
+	}
+
+	// TTL
+	p := CachePolicy{TTL: time.Hour, Key: key("a")}
+
+	for i := 0; i < 2; i++ {
+		if err := run(p); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	if calls != 1 {
+		t.Errorf("Unexpected number of calls: %d", calls)
+		return
+	}
+
+	// make the entry stale
+	old := time.Now().Add(-2 * time.Hour)
+
+	if err := os.Chtimes(filepath.Join(dir, cacheFileName("a")), old, old); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := run(p); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if calls != 2 {
+		t.Errorf("Unexpected number of calls: %d", calls)
+		return
+	}
+
+	// size limit
+	if err := os.Chtimes(filepath.Join(dir, cacheFileName("a")), old, old); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := run(CachePolicy{MaxSize: 15, Key: key("b")}); err != nil {
+		t.Error(err)
+		return
+	}
+
+	entries, err := os.ReadDir(dir)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if len(entries) != 1 || entries[0].Name() != cacheFileName("b") {
+		t.Errorf("Unexpected cache content: %v", entries)
+		return
+	}
+}
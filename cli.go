@@ -0,0 +1,61 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Main is a helper for programs that just render a stream to STDOUT: it writes the given chunks
+// to STDOUT (buffered), and then terminates the program with exit code 0 on success, or if STDOUT
+// has been closed by the reader (like when piped into "head" command), otherwise the error message
+// is printed to STDERR, and the exit code is 1. The function never returns.
+func Main(chunks ...Chunk) {
+	restore := catchSIGPIPE()
+	code := RunMain(os.Stdout, os.Stderr, chunks...)
+
+	restore()
+	os.Exit(code)
+}
+
+// RunMain writes the given chunks to the given stdout writer, and returns the exit code as described
+// for Main function, printing the error message (if any) to the given stderr writer, prefixed with
+// the program name.
+func RunMain(stdout, stderr io.Writer, chunks ...Chunk) int {
+	_, err := NewStream(stdout, WithBufferSize(32*1024), WithStopOnSinkClosed(true)).Write(chunks...)
+
+	if err == nil {
+		return 0
+	}
+
+	io.WriteString(stderr, filepath.Base(os.Args[0])+": "+err.Error()+"\n")
+	return 1
+}
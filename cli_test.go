@@ -0,0 +1,83 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRunMain(t *testing.T) {
+	var stdout, stderr strings.Builder
+
+	if code := RunMain(&stdout, &stderr, String("Hello, "), String("world!")); code != 0 {
+		t.Errorf("Unexpected exit code: %d", code)
+		return
+	}
+
+	if stdout.String() != "Hello, world!" || stderr.Len() != 0 {
+		t.Errorf("Unexpected output: %q, %q", stdout.String(), stderr.String())
+		return
+	}
+
+	// closed pipe
+	if code := RunMain(failingWriter{ErrSinkClosed}, &stderr, String("zzz")); code != 0 {
+		t.Errorf("Unexpected exit code: %d", code)
+		return
+	}
+
+	if stderr.Len() != 0 {
+		t.Errorf("Unexpected error message: %q", stderr.String())
+		return
+	}
+
+	// chunk error
+	stdout.Reset()
+
+	code := RunMain(&stdout, &stderr, String("zzz"), func(_ *Writer) (int64, error) {
+		return 0, errors.New("test error")
+	})
+
+	if code != 1 {
+		t.Errorf("Unexpected exit code: %d", code)
+		return
+	}
+
+	if s := stderr.String(); !strings.HasSuffix(s, ": writing stream chunk 1 at offset 3: test error\n") {
+		t.Errorf("Unexpected error message: %q", s)
+		return
+	}
+}
+
+type failingWriter struct {
+	err error
+}
+
+func (w failingWriter) Write(_ []byte) (int, error) { return 0, w.err }
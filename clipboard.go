@@ -0,0 +1,136 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"sync/atomic"
+)
+
+// Clipboard is the interface of the system clipboard.
+type Clipboard interface {
+	// Copy replaces the content of the clipboard with the given data.
+	Copy(data []byte) error
+}
+
+// CommandClipboard is the default implementation of Clipboard interface that runs an external
+// command, feeding the data to its STDIN. The zero value selects the first available command
+// for the platform: pbcopy on macOS, clip on Windows, and wl-copy (under Wayland), xclip, or xsel
+// on other systems.
+type CommandClipboard struct {
+	Name string   // command name, or empty for the platform default
+	Args []string // command arguments
+}
+
+// Copy implements Clipboard interface.
+func (c CommandClipboard) Copy(data []byte) (err error) {
+	args := append([]string{c.Name}, c.Args...)
+
+	if len(c.Name) == 0 {
+		if args, err = clipboardCommand(); err != nil {
+			return
+		}
+	}
+
+	_, err = WriterStream(io.Discard).Write(CommandOptions{Stdin: ByteSlice(data)}.Command(args[0], args[1:]...))
+	return
+}
+
+// the first available clipboard command for the platform
+func clipboardCommand() ([]string, error) {
+	var candidates [][]string
+
+	switch runtime.GOOS {
+	case "darwin":
+		candidates = [][]string{{"pbcopy"}}
+	case "windows":
+		candidates = [][]string{{"clip"}}
+	default:
+		if len(os.Getenv("WAYLAND_DISPLAY")) > 0 {
+			candidates = [][]string{{"wl-copy"}}
+		}
+
+		candidates = append(candidates, []string{"xclip", "-selection", "clipboard"}, []string{"xsel", "--clipboard", "--input"})
+	}
+
+	for _, cmd := range candidates {
+		if _, err := exec.LookPath(cmd[0]); err == nil {
+			return cmd, nil
+		}
+	}
+
+	return nil, errors.New("stout: no clipboard command found")
+}
+
+var clipboard atomic.Pointer[Clipboard]
+
+func init() {
+	SetClipboard(nil)
+}
+
+// SetClipboard replaces the package-level clipboard implementation used by ClipboardStream,
+// and returns the previous implementation. Passing nil restores the default implementation,
+// which is the zero value of CommandClipboard.
+func SetClipboard(c Clipboard) Clipboard {
+	if c == nil {
+		c = CommandClipboard{}
+	}
+
+	if prev := clipboard.Swap(&c); prev != nil {
+		return *prev
+	}
+
+	return nil
+}
+
+// ClipboardStream constructs a stream that collects the data in memory, and upon successful exit
+// from the stream Write() function copies the data to the system clipboard (see SetClipboard).
+// On error the clipboard is left untouched. The stream is meant for small outputs, like generated
+// snippets in command line tools.
+func ClipboardStream() Stream {
+	b := new(bytes.Buffer)
+	s := ByteBufferStream(b)
+
+	s.w.closeWithError = func(err error) error {
+		defer b.Reset()
+
+		if err != nil {
+			return nil
+		}
+
+		return (*clipboard.Load()).Copy(b.Bytes())
+	}
+
+	return s
+}
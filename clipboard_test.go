@@ -0,0 +1,97 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+type clipboardRecorder struct {
+	data []byte
+}
+
+func (c *clipboardRecorder) Copy(data []byte) error {
+	c.data = append([]byte(nil), data...)
+	return nil
+}
+
+func TestClipboardStream(t *testing.T) {
+	var c clipboardRecorder
+
+	defer SetClipboard(SetClipboard(&c))
+
+	s := ClipboardStream()
+
+	if _, err := s.Write(String("Hello, "), String("world!")); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if string(c.data) != "Hello, world!" {
+		t.Errorf("Unexpected clipboard content: %q", c.data)
+		return
+	}
+
+	// error
+	fail := func(_ *Writer) (int64, error) { return 0, errors.New("test error") }
+
+	if _, err := s.Write(String("zzz"), fail); err == nil {
+		t.Error("Missing error")
+		return
+	}
+
+	if string(c.data) != "Hello, world!" {
+		t.Errorf("Unexpected clipboard content: %q", c.data)
+		return
+	}
+}
+
+func TestCommandClipboard(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires unix tools")
+	}
+
+	name := filepath.Join(t.TempDir(), "clipboard")
+
+	c := CommandClipboard{Name: "sh", Args: []string{"-c", "cat > " + name}}
+
+	if err := c.Copy([]byte("zzz")); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if data, err := os.ReadFile(name); err != nil || string(data) != "zzz" {
+		t.Errorf("Unexpected result: %q, %v", data, err)
+		return
+	}
+}
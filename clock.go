@@ -0,0 +1,113 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	mrand "math/rand"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	clock      atomic.Pointer[func() time.Time]
+	randSource atomic.Pointer[io.Reader]
+)
+
+func init() {
+	SetClock(nil)
+	SetRandomSource(nil)
+}
+
+// SetClock replaces the package-level clock used by the time-dependent features (like CurrentTime,
+// Now, Elapsed, Timed, and the cache expiration) with the given function, and returns the previous
+// clock. Passing nil restores the default clock, which is time.Now. The function allows for testing
+// the chunks that timestamp their output.
+func SetClock(now func() time.Time) func() time.Time {
+	if now == nil {
+		now = time.Now
+	}
+
+	if prev := clock.Swap(&now); prev != nil {
+		return *prev
+	}
+
+	return nil
+}
+
+// SetRandomSource replaces the package-level source of randomness used by RandomBytes chunk and
+// for generating temporary file names, and returns the previous source. Passing nil restores the
+// default source, which is crypto/rand.Reader. The source must be safe for concurrent use.
+func SetRandomSource(r io.Reader) io.Reader {
+	if r == nil {
+		r = rand.Reader
+	}
+
+	if prev := randSource.Swap(&r); prev != nil {
+		return *prev
+	}
+
+	return nil
+}
+
+// current time from the package clock
+func clockNow() time.Time {
+	return (*clock.Load())()
+}
+
+// time elapsed since the given moment, by the package clock
+func clockSince(t time.Time) time.Duration {
+	return clockNow().Sub(t)
+}
+
+// random number from the package source; falls back to math/rand if the source fails
+func randomUint32() uint32 {
+	var b [4]byte
+
+	if _, err := io.ReadFull(*randSource.Load(), b[:]); err != nil {
+		return mrand.Uint32()
+	}
+
+	return binary.BigEndian.Uint32(b[:])
+}
+
+// RandomBytes constructs a chunk function that writes the given number of bytes read from
+// the package source of randomness (see SetRandomSource).
+func RandomBytes(num int) Chunk {
+	return func(w *Writer) (n int64, err error) {
+		if n, err = w.ReadFrom(io.LimitReader(*randSource.Load(), int64(num))); err == nil && n < int64(num) {
+			err = fmt.Errorf("random source: %w", io.ErrUnexpectedEOF)
+		}
+
+		return
+	}
+}
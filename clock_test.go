@@ -0,0 +1,101 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClock(t *testing.T) {
+	ts := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	defer SetClock(SetClock(func() time.Time { return ts }))
+
+	var b strings.Builder
+
+	_, err := StringBuilderStream(&b).Write(
+		Now(time.RFC3339),
+		Space,
+		Elapsed(ts.Add(-90*time.Second), time.Second),
+	)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if exp := "2020-01-02T03:04:05Z 1m30s"; b.String() != exp {
+		t.Errorf("Unexpected result: %q instead of %q", b.String(), exp)
+		return
+	}
+
+	// restore
+	SetClock(nil)
+
+	if time.Since(CurrentTime()) > time.Minute {
+		t.Error("Default clock is not restored")
+		return
+	}
+}
+
+func TestRandomSource(t *testing.T) {
+	defer SetRandomSource(SetRandomSource(bytes.NewReader([]byte("0123456789"))))
+
+	var b strings.Builder
+
+	if _, err := StringBuilderStream(&b).Write(RandomBytes(4)); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if b.String() != "0123" {
+		t.Errorf("Unexpected result: %q", b.String())
+		return
+	}
+
+	// source exhausted
+	if _, err := StringBuilderStream(&b).Write(RandomBytes(10)); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	// default source
+	SetRandomSource(nil)
+	b.Reset()
+
+	if _, err := StringBuilderStream(&b).Write(RandomBytes(16)); err != nil || b.Len() != 16 {
+		t.Errorf("Unexpected result: %q, %v", b.String(), err)
+		return
+	}
+}
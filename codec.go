@@ -0,0 +1,287 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sync"
+)
+
+// Codec is a constructor of a compressing (or otherwise encoding) writer on top of the given
+// io.Writer. Closing the returned writer must flush all the encoder's state, without closing
+// the underlying io.Writer. For example, for gzip compression:
+//
+//	func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriterLevel(w, gzip.BestSpeed) }
+type Codec = func(io.Writer) (io.WriteCloser, error)
+
+// Compressed constructs a chunk function that writes the output of the given chunk to a stream
+// through the encoder created by the given codec. The returned number of bytes is that of
+// the encoded data.
+func Compressed(chunk Chunk, codec Codec) Chunk {
+	return func(w *Writer) (int64, error) {
+		cw := countingWriter{w: w}
+		enc, err := codec(&cw)
+
+		if err != nil {
+			return 0, err
+		}
+
+		s := encoderStream(enc)
+
+		s.w.inherit(w)
+
+		_, err = s.Write(chunk)
+		return cw.n, err
+	}
+}
+
+// CompressedStream constructs a stream that writes to the given io.Writer object through
+// the encoder created by the given codec. The encoder is closed (and the io.Writer is flushed,
+// if it supports flushing) upon exit from the stream Write() function, so the stream is
+// for one-time use only.
+func CompressedStream(w io.Writer, codec Codec) (s Stream, err error) {
+	var enc io.WriteCloser
+
+	if enc, err = codec(w); err != nil {
+		return
+	}
+
+	s = encoderStream(enc)
+
+	if f, ok := w.(interface{ Flush() error }); ok {
+		s.w.close = func() (err error) {
+			if err = enc.Close(); err == nil {
+				err = f.Flush()
+			}
+
+			return
+		}
+	}
+
+	return
+}
+
+// HexEncoded constructs a chunk function that writes the output of the given chunk to a stream
+// hex-encoded, as hex.Encoder does. The returned number of bytes is that of the encoded data.
+func HexEncoded(chunk Chunk) Chunk {
+	return Compressed(chunk, func(w io.Writer) (io.WriteCloser, error) {
+		return nopCloser{hex.NewEncoder(w)}, nil
+	})
+}
+
+// Base64Encoded constructs a chunk function that writes the output of the given chunk to a stream
+// encoded with the given base64 encoding (like base64.StdEncoding), including the padding of the final
+// block, if any. The returned number of bytes is that of the encoded data.
+func Base64Encoded(enc *base64.Encoding, chunk Chunk) Chunk {
+	return Compressed(chunk, func(w io.Writer) (io.WriteCloser, error) {
+		return base64.NewEncoder(enc, w), nil
+	})
+}
+
+// io.Writer with no-op Close
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+// GzipStream constructs a stream that writes to the given io.Writer object through a gzip compressor
+// with the given compression level (like gzip.BestSpeed), as described for CompressedStream function.
+// The function panics if the compression level is invalid.
+func GzipStream(w io.Writer, level int) Stream {
+	s, err := CompressedStream(w, func(w io.Writer) (io.WriteCloser, error) {
+		return gzip.NewWriterLevel(w, level)
+	})
+
+	if err != nil {
+		panic("stout: " + err.Error())
+	}
+
+	return s
+}
+
+// stream on top of the given encoder
+func encoderStream(enc io.WriteCloser) (s Stream) {
+	s = WriterStream(enc)
+
+	// the encoder's Flush function (if any) typically writes some extra bytes to make
+	// the output decodable up to this point, so it is not called, because Close does the same
+	s.w.flush = nil
+	s.w.close = enc.Close
+	return
+}
+
+// apply the codec (if any) to the given chunks
+func encoded(codec Codec, chunks []Chunk) []Chunk {
+	if codec == nil {
+		return chunks
+	}
+
+	return []Chunk{Compressed(All(chunks...), codec)}
+}
+
+// codec registry
+var codecs = struct {
+	sync.RWMutex
+	m map[string]Codec
+}{
+	m: map[string]Codec{
+		"gz": func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriter(w), nil },
+	},
+}
+
+// RegisterCodec makes the given codec available under the specified name, which is also
+// the file name extension (without the leading dot) the codec is selected for by CodecForFile
+// function. Codec "gz" (gzip with the default compression level) is registered by default.
+// The function panics if the name is empty, or the codec is nil, or a codec with the same name
+// is already registered.
+func RegisterCodec(name string, wrap Codec) {
+	if len(name) == 0 || wrap == nil {
+		panic("stout: invalid codec registration")
+	}
+
+	codecs.Lock()
+	defer codecs.Unlock()
+
+	if _, dup := codecs.m[name]; dup {
+		panic(fmt.Sprintf("stout: codec %q is already registered", name))
+	}
+
+	codecs.m[name] = wrap
+}
+
+// LookupCodec returns the codec registered under the given name, if any.
+func LookupCodec(name string) (codec Codec, ok bool) {
+	codecs.RLock()
+	defer codecs.RUnlock()
+
+	codec, ok = codecs.m[name]
+	return
+}
+
+// Decoder is a constructor of a decompressing (or otherwise decoding) reader on top of the given
+// io.Reader. Closing the returned reader must not close the underlying io.Reader.
+type Decoder = func(io.Reader) (io.ReadCloser, error)
+
+// decoder registry
+var decoders = struct {
+	sync.RWMutex
+	m map[string]Decoder
+}{
+	m: map[string]Decoder{
+		"gz": func(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) },
+	},
+}
+
+// RegisterDecoder makes the given decoder available under the specified name, like RegisterCodec
+// does for the encoders. Decoder "gz" is registered by default. The function panics if the name
+// is empty, or the decoder is nil, or a decoder with the same name is already registered.
+func RegisterDecoder(name string, dec Decoder) {
+	if len(name) == 0 || dec == nil {
+		panic("stout: invalid decoder registration")
+	}
+
+	decoders.Lock()
+	defer decoders.Unlock()
+
+	if _, dup := decoders.m[name]; dup {
+		panic(fmt.Sprintf("stout: decoder %q is already registered", name))
+	}
+
+	decoders.m[name] = dec
+}
+
+// LookupDecoder returns the decoder registered under the given name, if any.
+func LookupDecoder(name string) (dec Decoder, ok bool) {
+	decoders.RLock()
+	defer decoders.RUnlock()
+
+	dec, ok = decoders.m[name]
+	return
+}
+
+// DecompressedReader constructs a chunk function that copies data from the given io.Reader
+// to a stream, decoding it with the decoder registered under the given name.
+func DecompressedReader(src io.Reader, codec string) Chunk {
+	return func(w *Writer) (int64, error) {
+		dec, ok := LookupDecoder(codec)
+
+		if !ok {
+			return 0, fmt.Errorf("unknown decoder %q", codec)
+		}
+
+		return Open(func() (io.ReadCloser, error) { return dec(src) })(w)
+	}
+}
+
+// GzipFile constructs a chunk function that copies data from the given gzip-compressed disk file
+// to a stream, decompressing it on the fly.
+func GzipFile(pathname string) Chunk {
+	return func(w *Writer) (n int64, err error) {
+		var file FileHandle
+
+		if file, err = openFile(pathname); err != nil {
+			return
+		}
+
+		defer func() {
+			if e := file.Close(); e != nil && err == nil {
+				err = e
+			}
+		}()
+
+		var src *gzip.Reader
+
+		if src, err = gzip.NewReader(bufio.NewReader(file)); err == nil {
+			n, err = w.readFromAndClose(src)
+		}
+
+		return
+	}
+}
+
+// CodecForFile returns the codec registered for the extension of the given file name,
+// or nil if there is no such codec. For example:
+//
+//	stout.AtomicFile{Perm: 0644, Codec: stout.CodecForFile(name)}.Write(name, chunks...)
+func CodecForFile(pathname string) Codec {
+	if ext := filepath.Ext(pathname); len(ext) > 1 {
+		if codec, ok := LookupCodec(ext[1:]); ok {
+			return codec
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,252 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func gzipCodec(w io.Writer) (io.WriteCloser, error) {
+	return gzip.NewWriterLevel(w, gzip.BestSpeed)
+}
+
+func TestCompressed(t *testing.T) {
+	var b bytes.Buffer
+
+	n, err := ByteBufferStream(&b).Write(Compressed(RepeatN(1000, String("ZZZ\n")), gzipCodec))
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if n != int64(b.Len()) {
+		t.Errorf("Unexpected number of bytes written: %d instead of %d", n, b.Len())
+		return
+	}
+
+	if err = checkGzip(&b, bytes.Repeat([]byte("ZZZ\n"), 1000)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestEncoded(t *testing.T) {
+	var b strings.Builder
+
+	data := All(String("Hello"), Byte(0), String("world!"))
+
+	n, err := StringBuilderStream(&b).Write(
+		HexEncoded(data),
+		Newline,
+		Base64Encoded(base64.StdEncoding, data),
+		Newline,
+		Base64Encoded(base64.RawURLEncoding, String("ab")),
+	)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	const exp = "48656c6c6f00776f726c6421\nSGVsbG8Ad29ybGQh\nYWI"
+
+	if b.String() != exp {
+		t.Errorf("Unexpected result: %q instead of %q", b.String(), exp)
+		return
+	}
+
+	if n != int64(len(exp)) {
+		t.Errorf("Unexpected number of bytes written: %d instead of %d", n, len(exp))
+		return
+	}
+}
+
+func TestCompressedStream(t *testing.T) {
+	var b bytes.Buffer
+
+	s, err := CompressedStream(&b, gzipCodec)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if _, err = s.Write(String("Hello, "), String("world!")); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err = checkGzip(&b, []byte("Hello, world!")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGzipStream(t *testing.T) {
+	var b bytes.Buffer
+
+	buff := bufio.NewWriter(&b)
+
+	if _, err := GzipStream(buff, gzip.BestSpeed).Write(String("Hello, "), String("world!")); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := checkGzip(&b, []byte("Hello, world!")); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// invalid compression level
+	defer func() {
+		if recover() == nil {
+			t.Error("Missing panic")
+		}
+	}()
+
+	GzipStream(&b, 100)
+}
+
+func checkGzip(src io.Reader, exp []byte) error {
+	r, err := gzip.NewReader(src)
+
+	if err != nil {
+		return err
+	}
+
+	res, err := io.ReadAll(r)
+
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(res, exp) {
+		return fmt.Errorf("Unexpected result: %q instead of %q", res, exp)
+	}
+
+	return nil
+}
+
+func TestCodecRegistry(t *testing.T) {
+	RegisterCodec("test-codec", gzipCodec)
+
+	if _, ok := LookupCodec("test-codec"); !ok {
+		t.Error("Codec not found")
+		return
+	}
+
+	if CodecForFile("file.txt") != nil {
+		t.Error("Unexpected codec")
+		return
+	}
+
+	name := filepath.Join(t.TempDir(), "file.gz")
+
+	_, err := AtomicFile{Perm: 0644, Codec: CodecForFile(name)}.Write(name, String("Hello, world!"))
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	fd, err := os.Open(name)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	defer fd.Close()
+
+	if err = checkGzip(fd, []byte("Hello, world!")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDecompressed(t *testing.T) {
+	dir := t.TempDir()
+
+	var files []Chunk
+
+	for i, s := range []string{"aaa\n", "bbb\n"} {
+		name := filepath.Join(dir, fmt.Sprintf("file-%d.gz", i))
+
+		if _, err := (OutputFile{Perm: 0644, Codec: gzipCodec}).Write(name, String(s)); err != nil {
+			t.Error(err)
+			return
+		}
+
+		files = append(files, GzipFile(name))
+	}
+
+	var b bytes.Buffer
+
+	if _, err := ByteBufferStream(&b).Write(files...); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if s := b.String(); s != "aaa\nbbb\n" {
+		t.Errorf("Unexpected result: %q", s)
+		return
+	}
+
+	// decompressed reader
+	var src bytes.Buffer
+
+	if _, err := ByteBufferStream(&src).Write(Compressed(String("ZZZ"), gzipCodec)); err != nil {
+		t.Error(err)
+		return
+	}
+
+	b.Reset()
+
+	if _, err := ByteBufferStream(&b).Write(DecompressedReader(&src, "gz")); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if s := b.String(); s != "ZZZ" {
+		t.Errorf("Unexpected result: %q", s)
+		return
+	}
+
+	if _, err := ByteBufferStream(&b).Write(DecompressedReader(&src, "no-such-codec")); err == nil {
+		t.Error("Missing error")
+		return
+	}
+}
@@ -0,0 +1,462 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Command constructs a chunk function that invokes the given command and copies its STDOUT
+// to a stream. The initial 2048 bytes of the command's STDERR output (if any) are recorded
+// and returned as an error message if the command fails with a non-zero exit code; the error
+// is of type *CommandError. The process is terminated if the write is cancelled via its context
+// (see Stream.WriteContext). See CommandOptions for the ways to change this behaviour.
+func Command(name string, args ...string) Chunk {
+	return CommandOptions{}.Command(name, args...)
+}
+
+// CommandContext is like Command, but also takes a context which when becomes done terminates
+// the process. On Windows, the cmd.exe builtin commands (like "type" or "dir") are run via cmd.exe,
+// unless an executable with the same name is found.
+func CommandContext(ctx context.Context, name string, args ...string) Chunk {
+	return CommandOptions{}.CommandContext(ctx, name, args...)
+}
+
+// Piped constructs a chunk function that feeds the output of the given chunk to STDIN of the specified
+// command, and copies the command's STDOUT to a stream, allowing for external formatters (like jq)
+// to be used as transforms. An error from the chunk takes precedence over an error from the command.
+func Piped(chunk Chunk, name string, args ...string) Chunk {
+	return CommandOptions{}.Piped(chunk, name, args...)
+}
+
+// CommandOptions specifies options for running a command. The zero value gives the behaviour
+// of Command and CommandContext functions.
+type CommandOptions struct {
+	// MaxStdout, if positive, limits the number of bytes copied from the command's STDOUT;
+	// once the limit is exceeded, the command is terminated, and the chunk returns
+	// an *OutputLimitError.
+	MaxStdout int64
+
+	// ProcessGroup makes the command run in its own process group, so that the termination
+	// signals are sent to the whole group, including any child processes of the command.
+	// On Windows, the command is run in a new process group, so that it receives CTRL_BREAK_EVENT
+	// on termination; the command always runs within a job object, which is used for killing
+	// the command with all its child processes. Ignored on other platforms without process groups.
+	ProcessGroup bool
+
+	// GracePeriod, if positive, makes the command terminate gracefully upon the context
+	// cancellation: the process (or the group) is first sent SIGTERM (CTRL_BREAK_EVENT on Windows),
+	// and then killed if it is still running after the grace period. By default, the process
+	// is killed immediately.
+	GracePeriod time.Duration
+
+	// StderrLimit is the number of bytes of the command's STDERR output to record
+	// for the error message; zero means the default of 2048 bytes.
+	StderrLimit int
+
+	// StderrTail makes the last StderrLimit bytes of STDERR recorded, instead of the initial ones.
+	StderrTail bool
+
+	// Stdin, if not nil, is the chunk whose output is fed to the command's STDIN, as described
+	// for Piped function. Allows for feeding the input to a command with a context.
+	Stdin Chunk
+}
+
+// Command is like the package-level Command function, but with the options applied.
+func (opts CommandOptions) Command(name string, args ...string) Chunk {
+	return func(w *Writer) (int64, error) {
+		return opts.start(w, newCommand(w.Context(), name, args))
+	}
+}
+
+// CommandContext is like the package-level CommandContext function, but with the options applied.
+func (opts CommandOptions) CommandContext(ctx context.Context, name string, args ...string) Chunk {
+	return func(w *Writer) (int64, error) {
+		return opts.start(w, newCommand(ctx, name, args))
+	}
+}
+
+// Piped is like the package-level Piped function, but with the options applied.
+func (opts CommandOptions) Piped(chunk Chunk, name string, args ...string) Chunk {
+	opts.Stdin = chunk
+
+	return opts.Command(name, args...)
+}
+
+// run the command, feeding its STDIN from the input chunk, if any
+func (opts CommandOptions) start(w *Writer, cmd *exec.Cmd) (n int64, err error) {
+	if opts.Stdin == nil {
+		return opts.run(w, cmd)
+	}
+
+	var wait func() error
+
+	cmd.Stdin, wait = feed(w, opts.Stdin)
+
+	n, err = opts.run(w, cmd)
+
+	if e := wait(); e != nil {
+		err = e
+	}
+
+	return
+}
+
+// start a goroutine writing the output of the given chunk to the returned pipe; the returned
+// function is to be called once the consumer is done, and it returns the error from the chunk
+func feed(w *Writer, chunk Chunk) (io.Reader, func() error) {
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+
+	// producer
+	go func() {
+		s := NewStream(pw, WithBufferSize(32*1024))
+
+		_, err := chunk(s.w.inherit(w))
+
+		if err == nil {
+			err = s.w.Flush()
+		}
+
+		pw.CloseWithError(err)
+		done <- err
+	}()
+
+	return pr, func() error {
+		// unblock the producer, if the consumer has not read all the input
+		pr.CloseWithError(io.ErrClosedPipe)
+
+		if err := <-done; err != nil && !errors.Is(err, io.ErrClosedPipe) {
+			return err
+		}
+
+		return nil
+	}
+}
+
+// OutputLimitError is returned from a command chunk when the command produces more
+// output than allowed by CommandOptions.MaxStdout.
+type OutputLimitError struct {
+	Args  []string // command line
+	Limit int64    // the limit
+}
+
+func (e *OutputLimitError) Error() string {
+	return fmt.Sprintf("command %q: output exceeds %d bytes", e.Args[0], e.Limit)
+}
+
+// CommandError is returned from a command chunk when the command fails.
+type CommandError struct {
+	Args     []string // command line
+	ExitCode int      // exit code, or -1 if the process did not exit normally
+	Stderr   string   // recorded STDERR output
+	Err      error    // the underlying error
+}
+
+// Error returns the recorded STDERR output, if any, or a message composed from the underlying error.
+func (e *CommandError) Error() string {
+	if len(e.Stderr) > 0 {
+		return e.Stderr
+	}
+
+	return fmt.Sprintf("command %q: %s", e.Args[0], e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *CommandError) Unwrap() error { return e.Err }
+
+// STDERR recorder
+type stderrRecorder interface {
+	io.Writer
+	String() string
+}
+
+// construct the STDERR recorder
+func (opts CommandOptions) stderr() stderrRecorder {
+	limit := opts.StderrLimit
+
+	if limit <= 0 {
+		limit = 2048
+	}
+
+	if opts.StderrTail {
+		return &tailWriter{limit: limit}
+	}
+
+	return &limitedWriter{limit: limit}
+}
+
+// make *CommandError from the given error returned by cmd.Wait()
+func commandError(cmd *exec.Cmd, stderr stderrRecorder, err error) error {
+	e := &CommandError{
+		Args:     cmd.Args,
+		ExitCode: -1,
+		Stderr:   stderr.String(),
+		Err:      err,
+	}
+
+	var ee *exec.ExitError
+
+	if errors.As(err, &ee) {
+		e.ExitCode = ee.ExitCode()
+	}
+
+	return e
+}
+
+func (opts CommandOptions) run(w *Writer, cmd *exec.Cmd) (n int64, err error) {
+	// set stderr
+	stderr := opts.stderr()
+
+	cmd.Stderr = stderr
+
+	// get stdout pipe
+	var stdout io.ReadCloser
+
+	if stdout, err = cmd.StdoutPipe(); err != nil {
+		return
+	}
+
+	// termination
+	done := make(chan struct{})
+
+	defer close(done)
+
+	pc := newProcessControl(cmd, opts.ProcessGroup)
+
+	defer pc.release()
+
+	cmd.Cancel = func() error {
+		if opts.GracePeriod <= 0 {
+			return pc.kill()
+		}
+
+		go func() {
+			timer := time.NewTimer(opts.GracePeriod)
+
+			defer timer.Stop()
+
+			select {
+			case <-timer.C:
+				pc.kill()
+			case <-done:
+			}
+		}()
+
+		return pc.terminate()
+	}
+
+	// start the command
+	if err = cmd.Start(); err != nil {
+		return
+	}
+
+	if err = pc.started(); err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return
+	}
+
+	// read output
+	var src io.Reader = stdout
+
+	if opts.MaxStdout > 0 {
+		src = io.LimitReader(stdout, opts.MaxStdout)
+	}
+
+	if n, err = w.ReadFrom(src); err != nil {
+		// this error may come from the target writer, so in order to make the command fail
+		// here we can just close the STDOUT pipe (is that correct?)
+		stdout.Close()
+		cmd.Wait()
+
+		return
+	}
+
+	// check the output limit
+	if opts.MaxStdout > 0 && n == opts.MaxStdout {
+		var b [1]byte
+
+		if m, _ := io.ReadFull(stdout, b[:]); m > 0 {
+			pc.kill()
+			stdout.Close()
+			cmd.Wait()
+
+			return n, &OutputLimitError{Args: cmd.Args, Limit: opts.MaxStdout}
+		}
+	}
+
+	// wait for completion
+	if err = cmd.Wait(); err != nil {
+		err = commandError(cmd, stderr, err)
+	}
+
+	return
+}
+
+type limitedWriter struct {
+	b     []byte
+	limit int
+}
+
+func (w *limitedWriter) Write(s []byte) (int, error) {
+	if n := min(w.limit-len(w.b), len(s)); n > 0 {
+		w.b = append(w.b, s[:n]...)
+	}
+
+	return len(s), nil
+}
+
+func (w *limitedWriter) String() string {
+	// truncation may result in broken UTF-8 encoding at the end of the message
+	s := w.b
+
+	for r, n := utf8.DecodeLastRune(s); r == utf8.RuneError && n > 0; r, n = utf8.DecodeLastRune(s) {
+		s = s[:len(s)-n]
+	}
+
+	// trim space and return as a string
+	return string(bytes.TrimSpace(s))
+}
+
+// io.Writer that keeps the last "limit" bytes written
+type tailWriter struct {
+	b     []byte
+	limit int
+}
+
+func (w *tailWriter) Write(s []byte) (int, error) {
+	w.b = append(w.b, s...)
+
+	// trim occasionally to amortise the cost of copying
+	if len(w.b) >= 2*w.limit {
+		w.b = append(w.b[:0], w.b[len(w.b)-w.limit:]...)
+	}
+
+	return len(s), nil
+}
+
+func (w *tailWriter) String() string {
+	s := w.b
+
+	if len(s) > w.limit {
+		s = s[len(s)-w.limit:]
+
+		// truncation may result in broken UTF-8 encoding at the start of the message
+		for r, n := utf8.DecodeRune(s); r == utf8.RuneError && n > 0; r, n = utf8.DecodeRune(s) {
+			s = s[n:]
+		}
+	}
+
+	// trim space and return as a string
+	return string(bytes.TrimSpace(s))
+}
+
+// WindowsQuoteArg quotes the given argument according to the rules used by most Windows programs
+// (CommandLineToArgvW and the Microsoft C runtime) for parsing their command line.
+func WindowsQuoteArg(arg string) string {
+	if len(arg) > 0 && !strings.ContainsAny(arg, " \t\n\v\"") {
+		return arg
+	}
+
+	var b strings.Builder
+
+	b.WriteByte('"')
+
+	slashes := 0
+
+	for i := 0; i < len(arg); i++ {
+		switch c := arg[i]; c {
+		case '\\':
+			slashes++
+		case '"':
+			// escape all the preceding backslashes, and the quote itself
+			b.WriteString(strings.Repeat("\\", 2*slashes+1))
+			b.WriteByte(c)
+			slashes = 0
+		default:
+			b.WriteString(strings.Repeat("\\", slashes))
+			b.WriteByte(c)
+			slashes = 0
+		}
+	}
+
+	// backslashes before the closing quote must be escaped
+	b.WriteString(strings.Repeat("\\", 2*slashes))
+	b.WriteByte('"')
+	return b.String()
+}
+
+// WindowsCommandLine composes a Windows command line from the given arguments,
+// each quoted using WindowsQuoteArg function.
+func WindowsCommandLine(args ...string) string {
+	quoted := make([]string, len(args))
+
+	for i, arg := range args {
+		quoted[i] = WindowsQuoteArg(arg)
+	}
+
+	return strings.Join(quoted, " ")
+}
+
+// compose the command line for cmd.exe running the given builtin command: each argument is quoted
+// using WindowsQuoteArg function, and then all the characters special to cmd.exe (including the quotes)
+// are escaped with '^', so that cmd.exe passes them through literally; arguments containing characters
+// that cannot be escaped ('%' and line breaks) are rejected
+func cmdExeLine(name string, args []string) (string, error) {
+	var b strings.Builder
+
+	b.WriteString(name)
+
+	for _, arg := range args {
+		if strings.ContainsAny(arg, "%\r\n\x00") {
+			return "", fmt.Errorf("unsafe argument for cmd.exe builtin %q: %q", name, arg)
+		}
+
+		b.WriteByte(' ')
+
+		for _, c := range []byte(WindowsQuoteArg(arg)) {
+			if strings.IndexByte("^&|<>()!\"", c) >= 0 {
+				b.WriteByte('^')
+			}
+
+			b.WriteByte(c)
+		}
+	}
+
+	return b.String(), nil
+}
@@ -0,0 +1,73 @@
+//go:build !unix && !windows
+
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"context"
+	"os"
+	"os/exec"
+)
+
+// create the command
+func newCommand(ctx context.Context, name string, args []string) *exec.Cmd {
+	return exec.CommandContext(ctx, name, args...)
+}
+
+// process termination control
+type processControl struct {
+	cmd *exec.Cmd
+}
+
+// set up the process attributes before starting the command
+func newProcessControl(cmd *exec.Cmd, _ bool) *processControl {
+	return &processControl{cmd: cmd}
+}
+
+// called after the process has started
+func (pc *processControl) started() error { return nil }
+
+// release resources
+func (pc *processControl) release() {}
+
+// ask the process to terminate
+func (pc *processControl) terminate() error {
+	if err := pc.cmd.Process.Signal(os.Interrupt); err == nil {
+		return nil
+	}
+
+	// signals are not supported on this platform
+	return pc.cmd.Process.Kill()
+}
+
+// kill the process
+func (pc *processControl) kill() error {
+	return pc.cmd.Process.Kill()
+}
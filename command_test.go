@@ -0,0 +1,286 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestCommandMaxStdout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a unix shell")
+	}
+
+	var b bytes.Buffer
+
+	opts := CommandOptions{MaxStdout: 10}
+
+	// within the limit
+	if _, err := ByteBufferStream(&b).Write(opts.Command("printf", "0123456789")); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if s := b.String(); s != "0123456789" {
+		t.Errorf("Unexpected result: %q instead of %q", s, "0123456789")
+		return
+	}
+
+	// runaway command
+	b.Reset()
+
+	_, err := ByteBufferStream(&b).Write(opts.Command("yes"))
+
+	var e *OutputLimitError
+
+	if !errors.As(err, &e) {
+		t.Error("Unexpected error:", err)
+		return
+	}
+
+	if e.Limit != 10 || b.Len() != 10 {
+		t.Errorf("Unexpected result: limit %d, %d bytes written", e.Limit, b.Len())
+		return
+	}
+}
+
+func TestCommandGracefulTermination(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a unix shell")
+	}
+
+	opts := CommandOptions{
+		ProcessGroup: true,
+		GracePeriod:  100 * time.Millisecond,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+
+	defer cancel()
+
+	// the grandchild process ignores SIGTERM and keeps the STDOUT pipe open
+	start := time.Now()
+
+	_, err := ByteBufferStream(new(bytes.Buffer)).Write(
+		opts.CommandContext(ctx, "sh", "-c", "trap '' TERM; sleep 30 & wait"),
+	)
+
+	if err == nil {
+		t.Error("Missing error")
+		return
+	}
+
+	if d := time.Since(start); d < 200*time.Millisecond || d > 10*time.Second {
+		t.Error("Unexpected duration:", d)
+		return
+	}
+}
+
+func TestWindowsQuoteArg(t *testing.T) {
+	cases := []struct{ arg, exp string }{
+		{"abc", `abc`},
+		{"", `""`},
+		{"a b", `"a b"`},
+		{`C:\dir\`, `C:\dir\`},
+		{`C:\my dir\`, `"C:\my dir\\"`},
+		{`say "hi"`, `"say \"hi\""`},
+		{`a\"b`, `"a\\\"b"`},
+	}
+
+	for _, c := range cases {
+		if s := WindowsQuoteArg(c.arg); s != c.exp {
+			t.Errorf("Unexpected result for %q: %q instead of %q", c.arg, s, c.exp)
+			return
+		}
+	}
+
+	if s := WindowsCommandLine("prog", "a b", "c"); s != `prog "a b" c` {
+		t.Errorf("Unexpected command line: %q", s)
+		return
+	}
+}
+
+func TestCmdExeLine(t *testing.T) {
+	s, err := cmdExeLine("echo", []string{"a&b", "x y|z", `"q"`, "(^!)"})
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if exp := `echo a^&b ^"x y^|z^" ^"\^"q\^"^" ^(^^^!^)`; s != exp {
+		t.Errorf("Unexpected result: %q instead of %q", s, exp)
+		return
+	}
+
+	for _, arg := range []string{"%PATH%", "a\nb", "a\rb"} {
+		if _, err = cmdExeLine("echo", []string{arg}); err == nil {
+			t.Errorf("Missing error for %q", arg)
+			return
+		}
+	}
+}
+
+func TestCommandStderrTail(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a unix shell")
+	}
+
+	const script = "for i in $(seq 1000); do echo line $i >&2; done; exit 1"
+
+	for _, c := range []struct {
+		opts CommandOptions
+		exp  string
+	}{
+		{CommandOptions{StderrLimit: 13}, "line 1\nline 2"},
+		{CommandOptions{StderrLimit: 20, StderrTail: true}, "line 999\nline 1000"},
+	} {
+		_, err := ByteBufferStream(new(bytes.Buffer)).Write(c.opts.Command("sh", "-c", script))
+
+		if err == nil {
+			t.Error("Missing error")
+			return
+		}
+
+		var e *CommandError
+
+		if !errors.As(err, &e) {
+			t.Error("Unexpected error:", err)
+			return
+		}
+
+		if e.Stderr != c.exp || e.ExitCode != 1 || e.Args[0] != "sh" {
+			t.Errorf("Unexpected error: %q (exit code %d) instead of %q", e.Stderr, e.ExitCode, c.exp)
+			return
+		}
+	}
+}
+
+func TestCommandErrorNoStderr(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a unix shell")
+	}
+
+	_, err := ByteBufferStream(new(bytes.Buffer)).Write(Command("sh", "-c", "exit 3"))
+
+	var e *CommandError
+
+	if !errors.As(err, &e) {
+		t.Error("Unexpected error:", err)
+		return
+	}
+
+	if e.ExitCode != 3 || len(e.Stderr) != 0 {
+		t.Errorf("Unexpected exit code %d, stderr %q", e.ExitCode, e.Stderr)
+		return
+	}
+
+	const msg = `command "sh": exit status 3`
+
+	if s := e.Error(); s != msg {
+		t.Errorf("Unexpected error message: %q instead of %q", s, msg)
+		return
+	}
+}
+
+func TestPiped(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires unix tools")
+	}
+
+	var b bytes.Buffer
+
+	_, err := ByteBufferStream(&b).Write(
+		String("<"),
+		Piped(All(String("aaa\n"), String("bbb\n")), "tr", "a-z", "A-Z"),
+		String(">"),
+	)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if exp := "<AAA\nBBB\n>"; b.String() != exp {
+		t.Errorf("Unexpected result: %q instead of %q", b.String(), exp)
+		return
+	}
+
+	// chunk error
+	fail := func(_ *Writer) (int64, error) { return 0, errors.New("test error") }
+
+	_, err = ByteBufferStream(&b).Write(Piped(fail, "cat"))
+
+	if err == nil || errors.As(err, new(*CommandError)) {
+		t.Error("Unexpected error:", err)
+		return
+	}
+
+	// command does not consume all the input
+	b.Reset()
+
+	_, err = ByteBufferStream(&b).Write(Piped(RepeatN(100000, String("zzz\n")), "head", "-n", "1"))
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if b.String() != "zzz\n" {
+		t.Errorf("Unexpected result: %q", b.String())
+		return
+	}
+}
+
+func TestCommandStdin(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires unix tools")
+	}
+
+	var b bytes.Buffer
+
+	opts := CommandOptions{Stdin: String(`{"a": 1}`)}
+
+	_, err := ByteBufferStream(&b).Write(opts.CommandContext(context.Background(), "tr", "a", "b"))
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if exp := `{"b": 1}`; b.String() != exp {
+		t.Errorf("Unexpected result: %q instead of %q", b.String(), exp)
+		return
+	}
+}
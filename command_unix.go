@@ -0,0 +1,85 @@
+//go:build unix
+
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"context"
+	"os/exec"
+	"syscall"
+)
+
+// create the command
+func newCommand(ctx context.Context, name string, args []string) *exec.Cmd {
+	return exec.CommandContext(ctx, name, args...)
+}
+
+// process termination control
+type processControl struct {
+	cmd   *exec.Cmd
+	group bool
+}
+
+// set up the process attributes before starting the command
+func newProcessControl(cmd *exec.Cmd, group bool) *processControl {
+	if group {
+		if cmd.SysProcAttr == nil {
+			cmd.SysProcAttr = &syscall.SysProcAttr{}
+		}
+
+		cmd.SysProcAttr.Setpgid = true
+	}
+
+	return &processControl{cmd: cmd, group: group}
+}
+
+// called after the process has started
+func (pc *processControl) started() error { return nil }
+
+// release resources
+func (pc *processControl) release() {}
+
+// ask the process (or the process group) to terminate
+func (pc *processControl) terminate() error {
+	return pc.signal(syscall.SIGTERM)
+}
+
+// kill the process (or the process group)
+func (pc *processControl) kill() error {
+	return pc.signal(syscall.SIGKILL)
+}
+
+func (pc *processControl) signal(sig syscall.Signal) error {
+	if pc.group {
+		return syscall.Kill(-pc.cmd.Process.Pid, sig)
+	}
+
+	return pc.cmd.Process.Signal(sig)
+}
@@ -0,0 +1,191 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+var (
+	kernel32                     = syscall.NewLazyDLL("kernel32.dll")
+	procCreateJobObjectW         = kernel32.NewProc("CreateJobObjectW")
+	procAssignProcessToJobObject = kernel32.NewProc("AssignProcessToJobObject")
+	procTerminateJobObject       = kernel32.NewProc("TerminateJobObject")
+	procGenerateConsoleCtrlEvent = kernel32.NewProc("GenerateConsoleCtrlEvent")
+	procNtResumeProcess          = syscall.NewLazyDLL("ntdll.dll").NewProc("NtResumeProcess")
+)
+
+// cmd.exe builtin commands
+var cmdBuiltins = map[string]bool{
+	"assoc": true, "call": true, "cd": true, "chdir": true, "cls": true, "copy": true,
+	"date": true, "del": true, "dir": true, "echo": true, "erase": true, "ftype": true,
+	"md": true, "mkdir": true, "mklink": true, "move": true, "path": true, "rd": true,
+	"ren": true, "rename": true, "rmdir": true, "set": true, "time": true, "type": true,
+	"ver": true, "vol": true,
+}
+
+// create the command, running cmd.exe builtins via cmd.exe; arguments that cannot be passed
+// to cmd.exe safely make the command fail to start
+func newCommand(ctx context.Context, name string, args []string) *exec.Cmd {
+	if !cmdBuiltins[strings.ToLower(name)] {
+		return exec.CommandContext(ctx, name, args...)
+	}
+
+	if _, err := exec.LookPath(name); err == nil {
+		return exec.CommandContext(ctx, name, args...)
+	}
+
+	shell := os.Getenv("ComSpec")
+
+	if len(shell) == 0 {
+		shell = "cmd.exe"
+	}
+
+	line, err := cmdExeLine(name, args)
+	cmd := exec.CommandContext(ctx, shell)
+
+	if err != nil {
+		cmd.Err = err
+		return cmd
+	}
+
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		CmdLine: WindowsQuoteArg(shell) + ` /d /s /c "` + line + `"`,
+	}
+
+	return cmd
+}
+
+// process termination control
+type processControl struct {
+	cmd   *exec.Cmd
+	group bool
+	lock  sync.Mutex
+	job   syscall.Handle // job object, if any
+}
+
+// set up the process attributes before starting the command; the process is started suspended,
+// so that it cannot spawn any children before it is assigned to the job object
+func newProcessControl(cmd *exec.Cmd, group bool) *processControl {
+	const createSuspended = 0x00000004
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+
+	cmd.SysProcAttr.CreationFlags |= createSuspended
+
+	if group {
+		cmd.SysProcAttr.CreationFlags |= syscall.CREATE_NEW_PROCESS_GROUP
+	}
+
+	return &processControl{cmd: cmd, group: group}
+}
+
+// called after the process has started suspended; assigns the process to a new job object,
+// and then resumes it
+func (pc *processControl) started() error {
+	const access = 0x0100 | 0x0001 | 0x0800 // PROCESS_SET_QUOTA | PROCESS_TERMINATE | PROCESS_SUSPEND_RESUME
+
+	proc, err := syscall.OpenProcess(access, false, uint32(pc.cmd.Process.Pid))
+
+	if err != nil {
+		return err
+	}
+
+	defer syscall.CloseHandle(proc)
+
+	job, _, err := procCreateJobObjectW.Call(0, 0)
+
+	if job == 0 {
+		return err
+	}
+
+	if r, _, err := procAssignProcessToJobObject.Call(job, uintptr(proc)); r == 0 {
+		syscall.CloseHandle(syscall.Handle(job))
+		return err
+	}
+
+	pc.lock.Lock()
+	pc.job = syscall.Handle(job)
+	pc.lock.Unlock()
+
+	if status, _, _ := procNtResumeProcess.Call(uintptr(proc)); status != 0 {
+		return fmt.Errorf("failed to resume process %d: NTSTATUS 0x%08X", pc.cmd.Process.Pid, status)
+	}
+
+	return nil
+}
+
+// release resources
+func (pc *processControl) release() {
+	pc.lock.Lock()
+	defer pc.lock.Unlock()
+
+	if pc.job != 0 {
+		syscall.CloseHandle(pc.job)
+		pc.job = 0
+	}
+}
+
+// ask the process group to terminate
+func (pc *processControl) terminate() error {
+	if pc.group {
+		const ctrlBreakEvent = 1
+
+		if r, _, _ := procGenerateConsoleCtrlEvent.Call(ctrlBreakEvent, uintptr(pc.cmd.Process.Pid)); r != 0 {
+			return nil
+		}
+	}
+
+	// no other way of graceful termination
+	return pc.kill()
+}
+
+// kill the process, or all the processes in the job
+func (pc *processControl) kill() error {
+	pc.lock.Lock()
+	defer pc.lock.Unlock()
+
+	if pc.job != 0 {
+		if r, _, err := procTerminateJobObject.Call(uintptr(pc.job), 1); r == 0 {
+			return err
+		}
+
+		return nil
+	}
+
+	return pc.cmd.Process.Kill()
+}
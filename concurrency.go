@@ -0,0 +1,128 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+)
+
+// CheckConcurrency switches the stream to the checking mode where misuse of the stream from
+// multiple goroutines is detected and reported as an error matching ErrConcurrentUse, instead of
+// silently interleaving or corrupting the output. In this mode, the stream writer may only be used
+// by the goroutine that has called the stream Write() function, unless the writing chunk is wrapped
+// with Reentrant, and any overlapping writes, as well as overlapping Write() calls, are errors.
+// The checks are relatively expensive, so the mode is meant for testing and debugging. The function
+// returns the same stream.
+func (s Stream) CheckConcurrency() Stream {
+	if s.w.guard == nil {
+		s.w.guard = new(useGuard)
+	}
+
+	return s
+}
+
+// Reentrant constructs a chunk function that invokes the given chunk declaring that it writes to
+// the stream from other goroutines, with its own synchronisation. For streams in the checking mode
+// (see Stream.CheckConcurrency) the goroutine ownership check is lifted for the duration of the chunk,
+// though overlapping writes are still detected. For other streams the wrapper has no effect.
+func Reentrant(chunk Chunk) Chunk {
+	return func(w *Writer) (int64, error) {
+		if g := w.guard; g != nil {
+			defer g.owner.Store(g.owner.Swap(0))
+		}
+
+		return chunk(w)
+	}
+}
+
+// concurrent use detector
+type useGuard struct {
+	owner  atomic.Int64 // id of the goroutine running Stream.Write, or 0 for any goroutine
+	active atomic.Int32 // number of writer calls in progress
+	writes atomic.Int32 // number of Stream.Write calls in progress
+}
+
+// start Stream.Write call
+func (g *useGuard) begin() error {
+	if g.writes.Add(1) != 1 {
+		g.writes.Add(-1)
+		return fmt.Errorf("%w: overlapping stream Write() calls", ErrConcurrentUse)
+	}
+
+	g.owner.Store(goid())
+	return nil
+}
+
+// end Stream.Write call
+func (g *useGuard) end() {
+	g.owner.Store(0)
+	g.writes.Add(-1)
+}
+
+// start a writer call
+func (g *useGuard) enter() error {
+	if g.active.Add(1) != 1 {
+		g.active.Add(-1)
+		return fmt.Errorf("%w: overlapping writes", ErrConcurrentUse)
+	}
+
+	if owner := g.owner.Load(); owner != 0 {
+		if id := goid(); id != owner {
+			g.active.Add(-1)
+			return fmt.Errorf("%w: write from goroutine %d to the stream owned by goroutine %d",
+				ErrConcurrentUse, id, owner)
+		}
+	}
+
+	return nil
+}
+
+// end a writer call
+func (g *useGuard) leave() {
+	g.active.Add(-1)
+}
+
+// id of the current goroutine, from the stack trace header "goroutine 123 [running]:"
+func goid() int64 {
+	var buff [64]byte
+
+	s := buff[:runtime.Stack(buff[:], false)]
+	s = bytes.TrimPrefix(s, []byte("goroutine "))
+
+	if i := bytes.IndexByte(s, ' '); i > 0 {
+		s = s[:i]
+	}
+
+	id, _ := strconv.ParseInt(string(s), 10, 64)
+	return id
+}
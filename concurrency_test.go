@@ -0,0 +1,118 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestConcurrencyCheck(t *testing.T) {
+	var b strings.Builder
+
+	// write from another goroutine
+	foreign := func(w *Writer) (n int64, err error) {
+		done := make(chan struct{})
+
+		go func() {
+			defer close(done)
+
+			var m int
+
+			m, err = w.WriteString("zzz")
+			n = int64(m)
+		}()
+
+		<-done
+		return
+	}
+
+	s := StringBuilderStream(&b).CheckConcurrency()
+
+	if _, err := s.Write(String("aaa"), foreign); !errors.Is(err, ErrConcurrentUse) {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	// same, declared re-entrant
+	b.Reset()
+
+	if _, err := s.Write(String("aaa"), Reentrant(foreign), String("bbb")); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if b.String() != "aaazzzbbb" {
+		t.Errorf("Unexpected result: %q", b.String())
+		return
+	}
+
+	// overlapping Write() calls
+	release := make(chan struct{})
+	started := make(chan struct{})
+
+	s = NewStream(io.Discard, WithConcurrencyCheck(true))
+
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+
+		s.Write(func(_ *Writer) (int64, error) {
+			close(started)
+			<-release
+			return 0, nil
+		})
+	}()
+
+	<-started
+
+	_, err := s.Write(String("zzz"))
+
+	close(release)
+	wg.Wait()
+
+	if !errors.Is(err, ErrConcurrentUse) {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	// unchecked stream
+	b.Reset()
+
+	if _, err = StringBuilderStream(&b).Write(foreign); err != nil || b.String() != "zzz" {
+		t.Errorf("Unexpected result: %q, %v", b.String(), err)
+		return
+	}
+}
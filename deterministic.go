@@ -0,0 +1,98 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+var deterministic atomic.Bool
+
+// SetDeterministic switches the package (and its subpackages) to or from the deterministic mode,
+// and returns the previous setting. In the deterministic mode all the features that would otherwise
+// put non-reproducible data into the output use fixed values instead: the current time (see
+// CurrentTime function) is frozen, Elapsed chunk writes zero duration, manifests produced by RenderTree
+// report the frozen time instead of the file modification times, and archive timestamps are
+// clamped to the frozen time. The mode is meant for reproducible builds and testing.
+func SetDeterministic(on bool) bool {
+	return deterministic.Swap(on)
+}
+
+// IsDeterministic returns true if the package is in the deterministic mode.
+func IsDeterministic() bool {
+	return deterministic.Load()
+}
+
+// CurrentTime returns the current time from the package clock (see SetClock), or, in the deterministic mode, the time specified by
+// SOURCE_DATE_EPOCH environment variable (as the number of seconds since the Unix epoch, in UTC),
+// or the Unix epoch itself if the variable is not set, or invalid.
+func CurrentTime() time.Time {
+	if !deterministic.Load() {
+		return clockNow()
+	}
+
+	return frozenTime()
+}
+
+// ClampTime returns the given time, or, in the deterministic mode, the earliest of the given
+// time and the frozen time (see CurrentTime). Zero time is returned as is.
+func ClampTime(t time.Time) time.Time {
+	if !t.IsZero() && deterministic.Load() {
+		if ft := frozenTime(); t.After(ft) {
+			return ft
+		}
+	}
+
+	return t
+}
+
+// the time for the deterministic mode
+func frozenTime() time.Time {
+	if s, ok := os.LookupEnv("SOURCE_DATE_EPOCH"); ok {
+		if sec, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return time.Unix(sec, 0).UTC()
+		}
+	}
+
+	return time.Unix(0, 0).UTC()
+}
+
+// Now constructs a chunk function that writes the current time (see CurrentTime function) formatted
+// using the given layout, as in time.Time.Format. The time is taken when the chunk is invoked.
+func Now(layout string) Chunk {
+	return func(w *Writer) (int64, error) {
+		var buff [64]byte
+
+		n, err := w.Write(CurrentTime().AppendFormat(buff[:0], layout))
+		return int64(n), err
+	}
+}
@@ -0,0 +1,88 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDeterministic(t *testing.T) {
+	if IsDeterministic() {
+		t.Error("Deterministic mode is on by default")
+		return
+	}
+
+	defer SetDeterministic(SetDeterministic(true))
+
+	t.Setenv("SOURCE_DATE_EPOCH", "86400")
+
+	var b strings.Builder
+
+	_, err := StringBuilderStream(&b).Write(
+		Now(time.RFC3339),
+		Space,
+		Elapsed(time.Now().Add(-time.Hour), time.Second),
+	)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if exp := "1970-01-02T00:00:00Z 0s"; b.String() != exp {
+		t.Errorf("Unexpected result: %q instead of %q", b.String(), exp)
+		return
+	}
+
+	// clamping
+	early, late := time.Unix(1000, 0), time.Unix(100000, 0)
+
+	if !ClampTime(early).Equal(early) || !ClampTime(late).Equal(time.Unix(86400, 0)) || !ClampTime(time.Time{}).IsZero() {
+		t.Error("Unexpected clamping result")
+		return
+	}
+
+	// invalid epoch
+	t.Setenv("SOURCE_DATE_EPOCH", "xxx")
+
+	if ts := CurrentTime(); ts.Unix() != 0 {
+		t.Errorf("Unexpected time: %s", ts)
+		return
+	}
+
+	// normal mode
+	SetDeterministic(false)
+
+	if ts := CurrentTime(); time.Since(ts) > time.Minute {
+		t.Errorf("Unexpected time: %s", ts)
+		return
+	}
+}
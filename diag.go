@@ -0,0 +1,132 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"runtime/pprof"
+	"sort"
+	"strings"
+)
+
+// EnvDump constructs a chunk function that writes the environment variables of the current
+// process, one "KEY=VALUE" pair per line, in sorted order. Only the variables for which the given
+// filter function returns true are written; a nil filter selects all the variables.
+// The environment is read when the chunk is invoked, not when it is constructed.
+func EnvDump(filter func(key string) bool) Chunk {
+	return func(w *Writer) (n int64, err error) {
+		env := os.Environ()
+
+		sort.Strings(env)
+
+		for _, kv := range env {
+			key := kv
+
+			if i := strings.IndexByte(kv, '='); i >= 0 {
+				key = kv[:i]
+			}
+
+			if filter != nil && !filter(key) {
+				continue
+			}
+
+			var m int
+
+			if m, err = w.WriteString(kv); err != nil {
+				break
+			}
+
+			n += int64(m)
+
+			if err = w.WriteByte('\n'); err != nil {
+				break
+			}
+
+			n++
+		}
+
+		return
+	}
+}
+
+// BuildInfo constructs a chunk function that writes the build information embedded in
+// the running binary (see debug.ReadBuildInfo), in the same text format as produced by
+// "go version -m" command. The chunk fails if the build information is not available.
+func BuildInfo() Chunk {
+	return func(w *Writer) (int64, error) {
+		info, ok := debug.ReadBuildInfo()
+
+		if !ok {
+			return 0, errors.New("build information is not available")
+		}
+
+		n, err := w.WriteString(info.String())
+		return int64(n), err
+	}
+}
+
+// StackTrace constructs a chunk function that writes the stack trace of the calling goroutine,
+// or, if the parameter is true, the stack traces of all the goroutines, in the same format
+// as used by runtime.Stack.
+func StackTrace(all bool) Chunk {
+	return func(w *Writer) (int64, error) {
+		buff := make([]byte, 16*1024)
+
+		for {
+			if m := runtime.Stack(buff, all); m < len(buff) {
+				n, err := w.Write(buff[:m])
+				return int64(n), err
+			}
+
+			buff = make([]byte, 2*len(buff))
+		}
+	}
+}
+
+// PprofProfile constructs a chunk function that writes the named runtime profile
+// (like "goroutine", "heap", "allocs", etc.) using the given debug level, as described
+// in pprof.Profile.WriteTo documentation. The chunk fails if the profile does not exist.
+func PprofProfile(name string, debug int) Chunk {
+	return func(w *Writer) (int64, error) {
+		p := pprof.Lookup(name)
+
+		if p == nil {
+			return 0, fmt.Errorf("profile %q does not exist", name)
+		}
+
+		cw := countingWriter{w: w}
+		err := p.WriteTo(&cw, debug)
+
+		return cw.n, err
+	}
+}
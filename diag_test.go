@@ -0,0 +1,135 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestEnvDump(t *testing.T) {
+	const prefix = "STOUT_TEST_ENV_"
+
+	os.Setenv(prefix+"B", "bbb")
+	os.Setenv(prefix+"A", "aaa")
+
+	defer func() {
+		os.Unsetenv(prefix + "A")
+		os.Unsetenv(prefix + "B")
+	}()
+
+	var b strings.Builder
+
+	n, err := StringBuilderStream(&b).Write(EnvDump(func(key string) bool {
+		return strings.HasPrefix(key, prefix)
+	}))
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	exp := prefix + "A=aaa\n" + prefix + "B=bbb\n"
+
+	if s := b.String(); s != exp {
+		t.Errorf("Unexpected result: %q instead of %q", s, exp)
+		return
+	}
+
+	if n != int64(len(exp)) {
+		t.Errorf("Unexpected number of bytes written: %d instead of %d", n, len(exp))
+		return
+	}
+}
+
+func TestBuildInfo(t *testing.T) {
+	var b strings.Builder
+
+	n, err := StringBuilderStream(&b).Write(BuildInfo())
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if n == 0 || n != int64(b.Len()) {
+		t.Errorf("Unexpected number of bytes written: %d", n)
+		return
+	}
+
+	if !strings.HasPrefix(b.String(), "go\t") {
+		t.Errorf("Unexpected build info: %q", b.String())
+		return
+	}
+}
+
+func TestStackTrace(t *testing.T) {
+	var b strings.Builder
+
+	n, err := StringBuilderStream(&b).Write(StackTrace(false))
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if n != int64(b.Len()) {
+		t.Errorf("Unexpected number of bytes written: %d instead of %d", n, b.Len())
+		return
+	}
+
+	if s := b.String(); !strings.Contains(s, "TestStackTrace") {
+		t.Errorf("Unexpected stack trace: %q", s)
+		return
+	}
+}
+
+func TestPprofProfile(t *testing.T) {
+	var b strings.Builder
+
+	n, err := StringBuilderStream(&b).Write(PprofProfile("goroutine", 1))
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if n == 0 || n != int64(b.Len()) {
+		t.Errorf("Unexpected number of bytes written: %d", n)
+		return
+	}
+
+	if _, err = StringBuilderStream(&b).Write(PprofProfile("no-such-profile", 0)); err == nil {
+		t.Error("Missing error")
+		return
+	}
+
+	t.Log(err)
+}
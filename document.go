@@ -0,0 +1,99 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// FrontMatterFormat describes the encoding and delimiters of the front matter of a document.
+type FrontMatterFormat struct {
+	Open, Close string                            // delimiter lines, without the trailing '\n'; may be empty
+	Marshal     func(interface{}) ([]byte, error) // encoder of the front matter
+}
+
+// JSONFrontMatter is the format of the front matter as a JSON object, without delimiters.
+var JSONFrontMatter = FrontMatterFormat{
+	Marshal: func(v interface{}) ([]byte, error) { return json.MarshalIndent(v, "", "  ") },
+}
+
+// YAMLFrontMatter constructs a front matter format for YAML delimited by "---" lines. The YAML
+// encoder (like yaml.Marshal from a YAML package of choice) is to be supplied by the caller.
+func YAMLFrontMatter(marshal func(interface{}) ([]byte, error)) FrontMatterFormat {
+	return FrontMatterFormat{Open: "---", Close: "---", Marshal: marshal}
+}
+
+// TOMLFrontMatter constructs a front matter format for TOML delimited by "+++" lines. The TOML
+// encoder is to be supplied by the caller.
+func TOMLFrontMatter(marshal func(interface{}) ([]byte, error)) FrontMatterFormat {
+	return FrontMatterFormat{Open: "+++", Close: "+++", Marshal: marshal}
+}
+
+// Document constructs a chunk function that writes a document consisting of the given front matter,
+// encoded and delimited according to the specified format, followed by the body. The front matter
+// is encoded at the time of writing. Each delimiter and the encoded front matter are terminated
+// with '\n'.
+func Document(frontMatter interface{}, body Chunk, format FrontMatterFormat) Chunk {
+	return func(w *Writer) (n int64, err error) {
+		var data []byte
+
+		if data, err = format.Marshal(frontMatter); err != nil {
+			return
+		}
+
+		var b bytes.Buffer
+
+		if len(format.Open) > 0 {
+			b.WriteString(format.Open)
+			b.WriteByte('\n')
+		}
+
+		b.Write(data)
+
+		if len(data) > 0 && data[len(data)-1] != '\n' {
+			b.WriteByte('\n')
+		}
+
+		if len(format.Close) > 0 {
+			b.WriteString(format.Close)
+			b.WriteByte('\n')
+		}
+
+		var m int
+
+		if m, err = w.Write(b.Bytes()); err != nil {
+			return int64(m), err
+		}
+
+		n, err = body(w)
+		n += int64(m)
+		return
+	}
+}
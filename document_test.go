@@ -0,0 +1,77 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestDocument(t *testing.T) {
+	meta := map[string]interface{}{"title": "Hello"}
+
+	// fake YAML encoder
+	yaml := func(v interface{}) ([]byte, error) {
+		return []byte(fmt.Sprintf("title: %s", v.(map[string]interface{})["title"])), nil
+	}
+
+	cases := []struct {
+		format FrontMatterFormat
+		exp    string
+	}{
+		{JSONFrontMatter, "{\n  \"title\": \"Hello\"\n}\nbody\n"},
+		{YAMLFrontMatter(yaml), "---\ntitle: Hello\n---\nbody\n"},
+		{TOMLFrontMatter(yaml), "+++\ntitle: Hello\n+++\nbody\n"},
+	}
+
+	for _, c := range cases {
+		var b strings.Builder
+
+		n, err := StringBuilderStream(&b).Write(Document(meta, String("body\n"), c.format))
+
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if b.String() != c.exp || n != int64(len(c.exp)) {
+			t.Errorf("Unexpected result: %q (%d bytes) instead of %q", b.String(), n, c.exp)
+			return
+		}
+	}
+
+	// encoding error
+	var b strings.Builder
+
+	if _, err := StringBuilderStream(&b).Write(Document(make(chan int), String("body"), JSONFrontMatter)); err == nil {
+		t.Error("Missing error")
+		return
+	}
+}
@@ -0,0 +1,113 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+)
+
+// DryRunEntry describes a file write planned in dry-run mode, where the chunks are rendered,
+// but nothing is written to the disk.
+type DryRunEntry struct {
+	Path    string // file path
+	Size    int64  // number of bytes that would be written
+	Exists  bool   // true if the file exists
+	Changed bool   // true if the write would create the file or change its content
+	Removed bool   // true if the file would be removed (RenderTree only)
+}
+
+// render the chunks comparing the result with the content of the existing file, and report
+// the planned write; the file is not modified
+func dryRun(open func(string) (io.ReadCloser, error), pathname string, appending bool, codec Codec,
+	chunks []Chunk, report func(DryRunEntry)) (n int64, err error) {
+	e := DryRunEntry{Path: pathname}
+
+	var file io.ReadCloser
+
+	if file, err = open(pathname); err == nil {
+		defer file.Close()
+
+		e.Exists = true
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+
+	var cw compareWriter
+
+	if e.Exists && !appending {
+		cw.r = bufio.NewReader(file)
+	}
+
+	if n, err = NewStream(&cw, WithBufferSize(4096)).Write(encoded(codec, chunks)...); err != nil {
+		return
+	}
+
+	switch {
+	case !e.Exists:
+		e.Changed = true
+	case appending:
+		e.Changed = n > 0
+	default:
+		if !cw.diff {
+			_, e := cw.r.ReadByte()
+			cw.diff = e != io.EOF
+		}
+
+		e.Changed = cw.diff
+	}
+
+	e.Size = n
+	report(e)
+	return
+}
+
+// io.Writer that compares the data with the content of the given reader
+type compareWriter struct {
+	r    *bufio.Reader
+	diff bool
+	buff [4096]byte
+}
+
+func (cw *compareWriter) Write(s []byte) (int, error) {
+	for p := s; !cw.diff && cw.r != nil && len(p) > 0; {
+		m := min(len(p), len(cw.buff))
+
+		if _, err := io.ReadFull(cw.r, cw.buff[:m]); err != nil || !bytes.Equal(p[:m], cw.buff[:m]) {
+			cw.diff = true
+		}
+
+		p = p[m:]
+	}
+
+	return len(s), nil
+}
@@ -0,0 +1,167 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestDryRunFile(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "file")
+
+	var entries []DryRunEntry
+
+	report := func(e DryRunEntry) { entries = append(entries, e) }
+
+	// new file
+	n, err := OutputFile{DryRun: report}.Write(name, String("abc"))
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if _, err = os.Stat(name); !os.IsNotExist(err) {
+		t.Error("File has been created")
+		return
+	}
+
+	if err = os.WriteFile(name, []byte("abc"), 0644); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// same content
+	if _, err = (AtomicFile{DryRun: report}).Write(name, String("abc")); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// different content
+	if _, err = (AtomicFile{DryRun: report}).Write(name, String("ab")); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// append
+	if _, err = (OutputFile{DryRun: report}).Append(name, String("xyz")); err != nil {
+		t.Error(err)
+		return
+	}
+
+	exp := []DryRunEntry{
+		{Path: name, Size: 3, Changed: true},
+		{Path: name, Size: 3, Exists: true},
+		{Path: name, Size: 2, Exists: true, Changed: true},
+		{Path: name, Size: 3, Exists: true, Changed: true},
+	}
+
+	if n != 3 || len(entries) != len(exp) {
+		t.Errorf("Unexpected result: %d bytes, %d entries", n, len(entries))
+		return
+	}
+
+	for i, e := range entries {
+		if e != exp[i] {
+			t.Errorf("[%d] Unexpected entry: %+v instead of %+v", i, e, exp[i])
+			return
+		}
+	}
+
+	if data, err := os.ReadFile(name); err != nil || string(data) != "abc" {
+		t.Errorf("File has been modified: %q, %v", data, err)
+		return
+	}
+}
+
+func TestDryRunTree(t *testing.T) {
+	dst := filepath.Join(t.TempDir(), "site")
+
+	// missing destination
+	var entries []DryRunEntry
+
+	report := func(e DryRunEntry) { entries = append(entries, e) }
+
+	if _, err := RenderTree(dst, map[string]Chunk{"a": String("a")}, TreeDryRun(report)); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if len(entries) != 1 || !entries[0].Changed || entries[0].Exists {
+		t.Errorf("Unexpected entries: %+v", entries)
+		return
+	}
+
+	if _, err := os.Stat(dst); !os.IsNotExist(err) {
+		t.Error("Destination has been created")
+		return
+	}
+
+	// existing destination
+	if _, err := RenderTree(dst, map[string]Chunk{"a": String("a"), "b/c": String("c"), "d": String("d")}); err != nil {
+		t.Error(err)
+		return
+	}
+
+	entries = nil
+
+	if _, err := RenderTree(dst, map[string]Chunk{"a": String("a"), "d": String("dd")}, TreeDryRun(report)); err != nil {
+		t.Error(err)
+		return
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+
+	exp := []DryRunEntry{
+		{Path: filepath.Join(dst, "a"), Size: 1, Exists: true},
+		{Path: filepath.Join(dst, "b", "c"), Size: 1, Exists: true, Changed: true, Removed: true},
+		{Path: filepath.Join(dst, "d"), Size: 2, Exists: true, Changed: true},
+	}
+
+	if len(entries) != len(exp) {
+		t.Errorf("Unexpected entries: %+v", entries)
+		return
+	}
+
+	for i, e := range entries {
+		if e != exp[i] {
+			t.Errorf("[%d] Unexpected entry: %+v instead of %+v", i, e, exp[i])
+			return
+		}
+	}
+
+	if err := checkTree(dst, map[string]string{"a": "a", "b/c": "c", "d": "d"}); err != nil {
+		t.Error(err)
+		return
+	}
+}
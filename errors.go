@@ -0,0 +1,135 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"errors"
+	"io/fs"
+	"net"
+	"os"
+	"strconv"
+)
+
+var (
+	// ErrSinkClosed matches (via errors.Is) errors indicating that the stream destination
+	// has gone away, like a broken pipe, a reset connection, or a closed file.
+	ErrSinkClosed = errors.New("stream closed")
+
+	// ErrSourceFailed matches (via errors.Is) errors from chunk functions that failed
+	// to produce data, as opposed to the errors from writing to the stream.
+	ErrSourceFailed = errors.New("chunk failed")
+
+	// ErrConcurrentUse matches (via errors.Is) errors from streams in the checking mode
+	// (see Stream.CheckConcurrency) indicating misuse of the stream from multiple goroutines.
+	ErrConcurrentUse = errors.New("concurrent use of stream")
+
+	// ErrLimitExceeded is the error from writing more data than allowed by LimitStream.
+	ErrLimitExceeded = errors.New("stream size limit exceeded")
+)
+
+// ChunkError is the error returned from Writer.WriteChunks (and thus from Stream.Write)
+// when one of the chunks fails.
+type ChunkError struct {
+	Index  int   // index of the failed chunk, counting from 0
+	Offset int64 // stream offset at which the failure occurred
+	Err    error // the underlying error
+
+	sink bool // the error came from the stream
+}
+
+func (e *ChunkError) Error() string {
+	msg := "writing stream chunk " + strconv.Itoa(e.Index)
+
+	// the offset is only shown at the innermost level of nested chunks
+	if _, ok := e.Err.(*ChunkError); !ok {
+		msg += " at offset " + strconv.FormatInt(e.Offset, 10)
+	}
+
+	return msg + ": " + e.Err.Error()
+}
+
+func (e *ChunkError) Unwrap() error { return e.Err }
+
+// Is supports ErrSinkClosed and ErrSourceFailed targets.
+func (e *ChunkError) Is(target error) bool {
+	switch target {
+	case ErrSinkClosed:
+		return isDisconnect(e.Err)
+	case ErrSourceFailed:
+		return !e.sink && !isDisconnect(e.Err)
+	default:
+		return false
+	}
+}
+
+// SourceError is the error returned from the chunks reading disk files (like File) when
+// the source file cannot be accessed.
+type SourceError struct {
+	Path string // path to the source file
+	Op   string // the failed operation, like "open"
+	Err  error  // the underlying error
+}
+
+func (e *SourceError) Error() string {
+	return e.Op + " source file " + strconv.Quote(e.Path) + ": " + e.Err.Error()
+}
+
+func (e *SourceError) Unwrap() error { return e.Err }
+
+// wrap an error from accessing the given source file
+func sourceError(op, pathname string, err error) error {
+	var pe *fs.PathError
+
+	if errors.As(err, &pe) {
+		err = pe.Err
+	}
+
+	return &SourceError{Path: pathname, Op: op, Err: err}
+}
+
+// Is supports ErrSinkClosed target.
+func (e *DisconnectError) Is(target error) bool { return target == ErrSinkClosed }
+
+// IsSinkClosed returns true if the given error indicates that the stream destination has gone away.
+func IsSinkClosed(err error) bool {
+	return errors.Is(err, ErrSinkClosed) || isDisconnect(err)
+}
+
+// IsSourceFailed returns true if the given error is from a chunk function that failed to produce
+// data, rather than from writing to the stream.
+func IsSourceFailed(err error) bool {
+	return errors.Is(err, ErrSourceFailed)
+}
+
+// check if the error is due to the destination being closed
+func isDisconnect(err error) bool {
+	return isSysDisconnect(err) ||
+		errors.Is(err, net.ErrClosed) ||
+		errors.Is(err, os.ErrClosed)
+}
@@ -0,0 +1,95 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestErrorClassification(t *testing.T) {
+	// source error
+	var b strings.Builder
+
+	_, err := StringBuilderStream(&b).Write(String("aaa"), func(_ *Writer) (int64, error) {
+		return 0, errors.New("source error")
+	})
+
+	if !IsSourceFailed(err) || IsSinkClosed(err) {
+		t.Error("Unexpected error classification:", err)
+		return
+	}
+
+	var ce *ChunkError
+
+	if !errors.As(err, &ce) || ce.Index != 1 {
+		t.Error("Unexpected error:", err)
+		return
+	}
+
+	// sink error
+	_, err = WriterStream(&deadWriter{}).Write(All(String("aaa")))
+
+	if IsSourceFailed(err) || IsSinkClosed(err) {
+		t.Error("Unexpected error classification:", err)
+		return
+	}
+
+	// closed sink
+	_, err = WriterStream(pipeWriter{}).Write(All(String("aaa")))
+
+	if IsSourceFailed(err) || !IsSinkClosed(err) {
+		t.Error("Unexpected error classification:", err)
+		return
+	}
+}
+
+type pipeWriter struct{}
+
+func (pipeWriter) Write(_ []byte) (int, error) { return 0, os.ErrClosed }
+
+func TestChunkErrorOffset(t *testing.T) {
+	var b strings.Builder
+
+	_, err := StringBuilderStream(&b).Write(
+		String("aaa"),
+		All(String("bb"), Byte('c'), func(_ *Writer) (int64, error) {
+			return 0, errors.New("test error")
+		}),
+	)
+
+	const msg = "writing stream chunk 1: writing stream chunk 2 at offset 6: test error"
+
+	if err == nil || err.Error() != msg {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+}
@@ -0,0 +1,177 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+)
+
+// Factory creates streams sharing common limits on the total throughput, the number of concurrent
+// Write() calls, and the number of open files, so that a service writing on behalf of many clients
+// can govern the resources centrally. The limits are shared fairly: the waiting Write() calls and
+// file opens are admitted in the order of arrival, and the throughput is divided in small slices
+// allocated to the active streams in turn. A Factory is safe for concurrent use.
+type Factory struct {
+	rate   *sharedRate // nil if unlimited
+	writes *semaphore  // nil if unlimited
+	files  *semaphore  // nil if unlimited
+}
+
+// FactoryLimits specifies the limits shared by the streams created by a Factory.
+// Zero value of any field means no limit.
+type FactoryLimits struct {
+	BytesPerSecond int64 // total throughput of all the streams
+	Writes         int   // number of concurrent Write() calls
+	OpenFiles      int   // number of files opened via the factory at the same time
+}
+
+// NewFactory constructs a Factory with the given limits.
+func NewFactory(limits FactoryLimits) *Factory {
+	f := new(Factory)
+
+	if limits.BytesPerSecond > 0 {
+		f.rate = &sharedRate{rate: limits.BytesPerSecond}
+	}
+
+	if limits.Writes > 0 {
+		f.writes = newSemaphore(int64(limits.Writes))
+	}
+
+	if limits.OpenFiles > 0 {
+		f.files = newSemaphore(int64(limits.OpenFiles))
+	}
+
+	return f
+}
+
+// Stream constructs a stream from the given io.Writer object, configured by the given options,
+// like NewStream function does, but subject to the factory limits. The stream Write() function
+// waits for a free write slot, if necessary; the wait is aborted when the context of the write
+// (see Stream.WriteContext) is done.
+func (f *Factory) Stream(w io.Writer, opts ...Option) (s Stream) {
+	if f.rate != nil {
+		rw := &sharedRateWriter{w: w, rate: f.rate}
+
+		if c, ok := w.(io.Closer); ok {
+			w = &sharedRateWriteCloser{rw, c}
+		} else {
+			w = rw
+		}
+	}
+
+	s = NewStream(w, opts...)
+
+	if f.writes != nil {
+		s.w.enter = func(ctx context.Context) (func(), error) {
+			if err := f.writes.acquire(ctx, 1); err != nil {
+				return nil, err
+			}
+
+			return func() { f.writes.release(1) }, nil
+		}
+	}
+
+	return
+}
+
+// WriteFile is like the package-level WriteFile function, but the file counts towards the factory
+// limit on open files while being written, and the write is subject to the other factory limits.
+func (f *Factory) WriteFile(pathname string, perm fs.FileMode, chunks ...Chunk) (n int64, err error) {
+	if f.files != nil {
+		if err = f.files.acquire(context.Background(), 1); err != nil {
+			return
+		}
+
+		defer f.files.release(1)
+	}
+
+	var file FileHandle
+
+	if file, err = currentFS().OpenFile(pathname, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm|0600); err != nil {
+		return
+	}
+
+	return f.Stream(file, WithBufferSize(4096), WithCloseOnFinish(true)).Write(chunks...)
+}
+
+// throughput limit shared by a number of writers
+type sharedRate struct {
+	rate int64     // bytes per second
+	next time.Time // the moment the next slice of data is allowed to go
+	lock sync.Mutex
+}
+
+// reserve the time for writing the given number of bytes, and return the moment the write may start
+func (r *sharedRate) reserve(n int) time.Time {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if now := clockNow(); r.next.Before(now) {
+		r.next = now
+	}
+
+	start := r.next
+	r.next = r.next.Add(time.Duration(float64(n) / float64(r.rate) * float64(time.Second)))
+
+	return start
+}
+
+// io.Writer subject to a shared throughput limit
+type sharedRateWriter struct {
+	w    io.Writer
+	rate *sharedRate
+}
+
+func (r *sharedRateWriter) Write(s []byte) (n int, err error) {
+	for len(s) > 0 && err == nil {
+		// write at most 1/10th of a second worth of data at a time, so that the concurrent
+		// writers take turns
+		k := int(min64(int64(len(s)), max64(r.rate.rate/10, 1)))
+
+		time.Sleep(r.rate.reserve(k).Sub(clockNow()))
+
+		var m int
+
+		m, err = r.w.Write(s[:k])
+		n += m
+		s = s[m:]
+	}
+
+	return
+}
+
+type sharedRateWriteCloser struct {
+	*sharedRateWriter
+	io.Closer
+}
@@ -0,0 +1,167 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFactoryWrites(t *testing.T) {
+	f := NewFactory(FactoryLimits{Writes: 2, OpenFiles: 1})
+
+	var active, peak atomic.Int32
+
+	chunk := func(w *Writer) (int64, error) {
+		n := active.Add(1)
+
+		defer active.Add(-1)
+
+		for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+		}
+
+		time.Sleep(10 * time.Millisecond)
+		return 0, nil
+	}
+
+	var wg sync.WaitGroup
+
+	errs := make(chan error, 10)
+	dir := t.TempDir()
+
+	for i := 0; i < 5; i++ {
+		wg.Add(2)
+
+		go func() {
+			defer wg.Done()
+
+			_, err := f.Stream(io.Discard).Write(chunk)
+			errs <- err
+		}()
+
+		go func(i int) {
+			defer wg.Done()
+
+			_, err := f.WriteFile(filepath.Join(dir, "file"+string(rune('0'+i))), 0644, String("ZZZ"), chunk)
+			errs <- err
+		}(i)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	if p := peak.Load(); p != 2 {
+		t.Errorf("Unexpected number of concurrent writes: %d", p)
+		return
+	}
+
+	if data, err := os.ReadFile(filepath.Join(dir, "file3")); err != nil || string(data) != "ZZZ" {
+		t.Errorf("Unexpected file content: %q, %v", data, err)
+		return
+	}
+
+	// cancellation while waiting for a write slot
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+
+	defer cancel()
+
+	release := make(chan struct{})
+	done := make(chan struct{}, 2)
+
+	block := func(w *Writer) (int64, error) {
+		done <- struct{}{}
+		<-release
+		return 0, nil
+	}
+
+	for i := 0; i < 2; i++ {
+		go f.Stream(io.Discard).Write(block)
+		<-done
+	}
+
+	_, err := f.Stream(io.Discard).WriteContext(ctx, String("ZZZ"))
+
+	close(release)
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+}
+
+func TestFactoryRate(t *testing.T) {
+	f := NewFactory(FactoryLimits{BytesPerSecond: 10000})
+
+	var wg sync.WaitGroup
+
+	bufs := make([]strings.Builder, 2)
+	start := time.Now()
+
+	for i := range bufs {
+		wg.Add(1)
+
+		go func(b *strings.Builder) {
+			defer wg.Done()
+
+			if _, err := f.Stream(b).Write(String(strings.Repeat("z", 2000))); err != nil {
+				t.Error(err)
+			}
+		}(&bufs[i])
+	}
+
+	wg.Wait()
+
+	// 4000 bytes at 10000 bytes per second, less the first slice sent immediately
+	if d := time.Since(start); d < 300*time.Millisecond {
+		t.Errorf("Rate limit is not applied: %s", d)
+		return
+	}
+
+	for _, b := range bufs {
+		if b.Len() != 2000 {
+			t.Errorf("Unexpected number of bytes: %d", b.Len())
+			return
+		}
+	}
+}
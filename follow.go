@@ -0,0 +1,114 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// FollowFile constructs a chunk function that copies the given disk file to a stream, and then keeps
+// copying the data appended to the file, like "tail -f" command does, until the context is cancelled.
+// The file is checked for new data at the given interval, and the stream is flushed after each portion
+// of data. If the file gets truncated, the copying starts again from the beginning of the file. Context
+// cancellation is the normal way to stop the chunk, so it is not reported as an error.
+func FollowFile(ctx context.Context, pathname string, poll time.Duration) Chunk {
+	return func(w *Writer) (n int64, err error) {
+		var fd FileHandle
+
+		if fd, err = openFile(pathname); err != nil {
+			return
+		}
+
+		defer func() {
+			if e := fd.Close(); e != nil && err == nil {
+				err = e
+			}
+		}()
+
+		file, ok := fd.(seekableFile)
+
+		if !ok {
+			return 0, &fs.PathError{Op: "follow", Path: pathname, Err: errors.ErrUnsupported}
+		}
+
+		timer := time.NewTimer(poll)
+
+		defer timer.Stop()
+
+		for {
+			// copy whatever is available
+			var m int64
+
+			m, err = w.ReadFrom(file)
+			n += m
+
+			if err != nil {
+				return
+			}
+
+			if m > 0 {
+				if err = w.Flush(); err != nil {
+					return
+				}
+			}
+
+			// wait
+			timer.Reset(poll)
+
+			select {
+			case <-ctx.Done():
+				return n, nil
+			case <-timer.C:
+			}
+
+			// check for truncation
+			var pos int64
+			var stat os.FileInfo
+
+			if pos, err = file.Seek(0, io.SeekCurrent); err != nil {
+				return
+			}
+
+			if stat, err = file.Stat(); err != nil {
+				return
+			}
+
+			if stat.Size() < pos {
+				if _, err = file.Seek(0, io.SeekStart); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,114 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFollowFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "log")
+
+	if _, err := WriteFile(name, 0644, String("aaa\n")); err != nil {
+		t.Error(err)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	defer cancel()
+
+	var w syncBuffer
+
+	done := make(chan error, 1)
+
+	go func() {
+		_, err := WriterStream(&w).Write(FollowFile(ctx, name, 5*time.Millisecond))
+		done <- err
+	}()
+
+	waitFor := func(exp string) bool {
+		for i := 0; i < 200; i++ {
+			if w.String() == exp {
+				return true
+			}
+
+			time.Sleep(5 * time.Millisecond)
+		}
+
+		return false
+	}
+
+	if !waitFor("aaa\n") {
+		t.Errorf("Unexpected result: %q", w.String())
+		return
+	}
+
+	if _, err := AppendToFile(name, 0644, String("bbb\n")); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if !waitFor("aaa\nbbb\n") {
+		t.Errorf("Unexpected result: %q", w.String())
+		return
+	}
+
+	cancel()
+
+	if err := <-done; err != nil {
+		t.Error(err)
+		return
+	}
+}
+
+// thread-safe buffer
+type syncBuffer struct {
+	b    bytes.Buffer
+	lock sync.Mutex
+}
+
+func (s *syncBuffer) Write(p []byte) (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.b.Write(p)
+}
+
+func (s *syncBuffer) String() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.b.String()
+}
@@ -0,0 +1,157 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// FileSystem is the set of operating system calls made by the file writers (OutputFile, AtomicFile,
+// TempFile, FileTarget, and the functions built on top of them, like RenderTree, Staged, Cached,
+// and TempSet) when no root directory is given, and by the file readers (File, GzipFile, TailLines,
+// and FollowFile). Replacing the default implementation (see SetFileSystem) allows for testing
+// the error paths that are otherwise hard to reach, like running out of disk space, or a crash
+// between the write and the rename of a temporary file. Operations on whole
+// directories (creating, listing, changing permissions, and removing recursively) are not covered,
+// and always go directly to the operating system.
+type FileSystem interface {
+	OpenFile(name string, flag int, perm fs.FileMode) (FileHandle, error)
+	CreateTemp(dir, pattern string) (FileHandle, error)
+	Rename(oldpath, newpath string) error
+	Remove(name string) error
+	Link(oldname, newname string) error
+	Lstat(name string) (fs.FileInfo, error)
+	Readlink(name string) (string, error)
+	Chtimes(name string, atime, mtime time.Time) error
+}
+
+// FileHandle is an open file, as returned from FileSystem. The default implementation returns *os.File.
+type FileHandle interface {
+	io.ReadWriteCloser
+	Name() string
+	Sync() error
+	Chmod(mode fs.FileMode) error
+	Chown(uid, gid int) error
+}
+
+// OSFileSystem is the default implementation of FileSystem interface, calling the functions
+// from "os" package. It can also be embedded into a custom implementation that only overrides
+// some of the calls.
+type OSFileSystem struct{}
+
+// OpenFile calls os.OpenFile.
+func (OSFileSystem) OpenFile(name string, flag int, perm fs.FileMode) (FileHandle, error) {
+	return fileHandle(os.OpenFile(name, flag, perm))
+}
+
+// CreateTemp calls os.CreateTemp.
+func (OSFileSystem) CreateTemp(dir, pattern string) (FileHandle, error) {
+	return fileHandle(os.CreateTemp(dir, pattern))
+}
+
+// Rename calls os.Rename.
+func (OSFileSystem) Rename(oldpath, newpath string) error { return os.Rename(oldpath, newpath) }
+
+// Remove calls os.Remove.
+func (OSFileSystem) Remove(name string) error { return os.Remove(name) }
+
+// Link calls os.Link.
+func (OSFileSystem) Link(oldname, newname string) error { return os.Link(oldname, newname) }
+
+// Lstat calls os.Lstat.
+func (OSFileSystem) Lstat(name string) (fs.FileInfo, error) { return os.Lstat(name) }
+
+// Readlink calls os.Readlink.
+func (OSFileSystem) Readlink(name string) (string, error) { return os.Readlink(name) }
+
+// Chtimes calls os.Chtimes.
+func (OSFileSystem) Chtimes(name string, atime, mtime time.Time) error {
+	return os.Chtimes(name, atime, mtime)
+}
+
+// avoid non-nil interface holding a nil pointer
+func fileHandle(file *os.File, err error) (FileHandle, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	return file, nil
+}
+
+var fileSystem atomic.Pointer[FileSystem]
+
+func init() {
+	SetFileSystem(nil)
+}
+
+// SetFileSystem replaces the package-level implementation of the file system calls made by
+// the file writers, and returns the previous implementation. Passing nil restores the default
+// implementation, which is OSFileSystem. The implementation must be safe for concurrent use.
+// Writes confined to a root directory (see os.Root) are not affected. TailLines and FollowFile also
+// need the file handle to implement io.ReaderAt, io.Seeker, and Stat() method (as *os.File does),
+// and fail with errors.ErrUnsupported otherwise.
+func SetFileSystem(fsys FileSystem) FileSystem {
+	if fsys == nil {
+		fsys = OSFileSystem{}
+	}
+
+	if prev := fileSystem.Swap(&fsys); prev != nil {
+		return *prev
+	}
+
+	return nil
+}
+
+// CurrentFileSystem returns the package-level implementation of the file system calls
+// (see SetFileSystem).
+func CurrentFileSystem() FileSystem {
+	return currentFS()
+}
+
+// the current package file system
+func currentFS() FileSystem {
+	return *fileSystem.Load()
+}
+
+// open the file for reading
+func openFile(name string) (FileHandle, error) {
+	return currentFS().OpenFile(name, os.O_RDONLY, 0)
+}
+
+// file handle that allows for random access, like *os.File
+type seekableFile interface {
+	FileHandle
+	io.ReaderAt
+	io.Seeker
+	Stat() (fs.FileInfo, error)
+}
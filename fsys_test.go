@@ -0,0 +1,222 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// injected file system errors
+var (
+	errNoSpace    = errors.New("no space left on device")
+	errIO         = errors.New("input/output error")
+	errPermission = errors.New("permission denied")
+)
+
+// file system with injected failures
+type faultyFS struct {
+	OSFileSystem
+	writeErr  error // error from file writes
+	renameErr error // error from Rename
+	createErr error // error from CreateTemp
+}
+
+func (f *faultyFS) CreateTemp(dir, pattern string) (FileHandle, error) {
+	if f.createErr != nil {
+		return nil, &os.PathError{Op: "createtemp", Path: dir, Err: f.createErr}
+	}
+
+	fd, err := f.OSFileSystem.CreateTemp(dir, pattern)
+
+	if err == nil && f.writeErr != nil {
+		fd = &faultyFile{fd, f.writeErr}
+	}
+
+	return fd, err
+}
+
+func (f *faultyFS) Rename(oldpath, newpath string) error {
+	if f.renameErr != nil {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: f.renameErr}
+	}
+
+	return f.OSFileSystem.Rename(oldpath, newpath)
+}
+
+type faultyFile struct {
+	FileHandle
+	err error
+}
+
+func (f *faultyFile) Write(s []byte) (int, error) {
+	return 0, &os.PathError{Op: "write", Path: f.Name(), Err: f.err}
+}
+
+func TestFileSystemFailures(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file")
+
+	if _, err := WriteFile(file, 0644, String("old")); err != nil {
+		t.Error(err)
+		return
+	}
+
+	fsys := &faultyFS{}
+
+	defer SetFileSystem(SetFileSystem(fsys))
+
+	// out of disk space
+	fsys.writeErr = errNoSpace
+
+	if _, err := AtomicWriteFile(file, 0644, String("new")); !errors.Is(err, errNoSpace) {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	if err := checkFileSystemState(dir, file, "old"); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// crash between the write and the rename
+	fsys.writeErr, fsys.renameErr = nil, errIO
+
+	if _, err := AtomicWriteFile(file, 0644, String("new")); !errors.Is(err, errIO) {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	if err := checkFileSystemState(dir, file, "old"); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// no permission to create temporary file
+	fsys.renameErr, fsys.createErr = nil, errPermission
+
+	if _, _, err := WriteTempFileIn(dir, "tmp-", String("new")); !errors.Is(err, errPermission) {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	// no failures
+	fsys.createErr = nil
+
+	if _, err := AtomicWriteFile(file, 0644, String("new")); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := checkFileSystemState(dir, file, "new"); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// default file system
+	SetFileSystem(nil)
+
+	if _, ok := SetFileSystem(nil).(OSFileSystem); !ok {
+		t.Error("Default file system is not restored")
+		return
+	}
+}
+
+// check the file content and the absence of temporary files
+func checkFileSystemState(dir, file, content string) error {
+	data, err := os.ReadFile(file)
+
+	if err != nil {
+		return err
+	}
+
+	if string(data) != content {
+		return errors.New("unexpected file content: " + string(data))
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "tmp-*"))
+
+	if err != nil {
+		return err
+	}
+
+	if len(files) > 0 {
+		return &fs.PathError{Op: "check", Path: files[0], Err: errors.New("temporary file left over")}
+	}
+
+	return nil
+}
+
+// file system that hides the *os.File behind a plain FileHandle
+type wrappingFS struct {
+	OSFileSystem
+}
+
+func (f wrappingFS) OpenFile(name string, flag int, perm fs.FileMode) (FileHandle, error) {
+	fd, err := f.OSFileSystem.OpenFile(name, flag, perm)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return struct{ FileHandle }{fd}, nil
+}
+
+func TestFileSystemReaders(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file")
+
+	if _, err := WriteFile(file, 0644, String("aaa\nbbb\n")); err != nil {
+		t.Error(err)
+		return
+	}
+
+	defer SetFileSystem(SetFileSystem(wrappingFS{}))
+
+	var b strings.Builder
+
+	if _, err := StringBuilderStream(&b).Write(File(file)); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if s := b.String(); s != "aaa\nbbb\n" {
+		t.Errorf("Unexpected result: %q", s)
+		return
+	}
+
+	// random access is not available
+	if _, err := StringBuilderStream(&b).Write(TailLines(file, 1)); !errors.Is(err, errors.ErrUnsupported) {
+		t.Error("Unexpected error:", err)
+		return
+	}
+}
@@ -1,3 +1,3 @@
 module github.com/maxim2266/stout
 
-go 1.16
+go 1.25
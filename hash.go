@@ -0,0 +1,79 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"hash"
+	"io"
+)
+
+// HashChunks renders the given chunks into a hash created by the supplied constructor,
+// without writing them anywhere else, and returns the digest and the number of bytes hashed.
+// The function is useful for computing cache keys or detecting changes in the output
+// of a composition of chunks. For example:
+//
+//	digest, _, err := stout.HashChunks(sha256.New, chunks...)
+func HashChunks(newHash func() hash.Hash, chunks ...Chunk) (digest []byte, n int64, err error) {
+	h := newHash()
+
+	if n, err = WriterStream(h).Write(chunks...); err == nil {
+		digest = h.Sum(nil)
+	}
+
+	return
+}
+
+// HashingStream constructs a stream that writes to the given io.Writer object, also feeding all
+// the data written into the given hash, so that the digest of the output can be obtained in the same
+// pass, either after the write, or within it via Checksum chunk. If the io.Writer supports flushing,
+// so does the stream.
+func HashingStream(w io.Writer, h hash.Hash) Stream {
+	s := WriterStream(&teeWriter{w, h})
+
+	if f, ok := w.(interface{ Flush() error }); ok {
+		s.w.flush = f.Flush
+	}
+
+	return s
+}
+
+// Checksum constructs a chunk function that writes the digest of the data fed into the given hash
+// so far (like the output of a HashingStream before this chunk), encoded by the given function
+// (like hex.EncodeToString). For example, to append a checksum line to the output:
+//
+//	h := sha256.New()
+//	s := stout.HashingStream(file, h)
+//	_, err := s.Write(body, stout.String("sha256: "), stout.Checksum(h, hex.EncodeToString), stout.Newline)
+func Checksum(h hash.Hash, encode func([]byte) string) Chunk {
+	return func(w *Writer) (int64, error) {
+		n, err := w.WriteString(encode(h.Sum(nil)))
+
+		return int64(n), err
+	}
+}
@@ -0,0 +1,92 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func TestHashChunks(t *testing.T) {
+	digest, n, err := HashChunks(sha256.New, String("Hello"), Space, String("world!"))
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	exp := sha256.Sum256([]byte("Hello world!"))
+
+	if n != 12 || !bytes.Equal(digest, exp[:]) {
+		t.Errorf("Unexpected result: %x (%d bytes) instead of %x", digest, n, exp)
+		return
+	}
+
+	// error
+	fail := func(_ *Writer) (int64, error) { return 0, errors.New("test error") }
+
+	if digest, _, err = HashChunks(sha256.New, String("x"), fail); err == nil || digest != nil {
+		t.Error("Missing error")
+		return
+	}
+}
+
+func TestHashingStream(t *testing.T) {
+	var b bytes.Buffer
+
+	h := sha256.New()
+
+	_, err := HashingStream(&b, h).Write(
+		String("Hello world!"),
+		Newline,
+		Checksum(h, hex.EncodeToString),
+		Newline,
+	)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	sum := sha256.Sum256([]byte("Hello world!\n"))
+
+	if exp := "Hello world!\n" + hex.EncodeToString(sum[:]) + "\n"; b.String() != exp {
+		t.Errorf("Unexpected result: %q instead of %q", b.String(), exp)
+		return
+	}
+
+	// the hash has seen the whole output
+	if sum = sha256.Sum256(b.Bytes()); !bytes.Equal(h.Sum(nil), sum[:]) {
+		t.Error("Unexpected digest")
+		return
+	}
+}
@@ -0,0 +1,171 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// HeartbeatStream constructs a stream that writes to the given io.Writer object, and also writes
+// the given keepalive chunk (like an SSE comment line ": ping\n\n") whenever no data has been written
+// for the specified interval, to prevent proxies from closing idle connections. The keepalive is written
+// from a background goroutine that only runs during the stream Write() function (the interval is counted
+// from the start of the function, and then from the last write), and it never interleaves
+// with a single write to the stream, though it may appear between any two writes, so the keepalive must
+// be something the receiver can ignore at any position. If the io.Writer supports flushing (including
+// http.Flusher), it is flushed after each keepalive. An error from writing the keepalive is reported by
+// the next write to the stream.
+func HeartbeatStream(w io.Writer, interval time.Duration, keepalive Chunk) Stream {
+	hb := &heartbeatWriter{
+		w:         w,
+		ka:        WriterStream(w).w,
+		interval:  interval,
+		keepalive: keepalive,
+	}
+
+	switch f := w.(type) {
+	case interface{ Flush() error }:
+		hb.flush = f.Flush
+	case interface{ Flush() }:
+		hb.flush = func() error { f.Flush(); return nil }
+	}
+
+	s := WriterStream(hb)
+
+	s.w.flush = hb.Flush
+	s.w.enter = func(context.Context) (func(), error) {
+		hb.start()
+		return hb.stop, nil
+	}
+
+	return s
+}
+
+type heartbeatWriter struct {
+	w         io.Writer
+	ka        *Writer // writer for the keepalive chunk
+	flush     func() error
+	interval  time.Duration
+	keepalive Chunk
+
+	lock sync.Mutex
+	last time.Time     // time of the last write (real time, to match the timer)
+	err  error         // error from the keepalive
+	done chan struct{} // closed to stop the goroutine
+	wg   sync.WaitGroup
+}
+
+func (hb *heartbeatWriter) Write(s []byte) (int, error) {
+	hb.lock.Lock()
+	defer hb.lock.Unlock()
+
+	if hb.err != nil {
+		return 0, hb.err
+	}
+
+	hb.last = time.Now()
+	return hb.w.Write(s)
+}
+
+// Flush flushes the underlying writer, if it supports flushing.
+func (hb *heartbeatWriter) Flush() (err error) {
+	hb.lock.Lock()
+	defer hb.lock.Unlock()
+
+	if err = hb.err; err == nil && hb.flush != nil {
+		err = hb.flush()
+	}
+
+	return
+}
+
+// start the background goroutine
+func (hb *heartbeatWriter) start() {
+	hb.lock.Lock()
+	defer hb.lock.Unlock()
+
+	done := make(chan struct{})
+
+	hb.done = done
+	hb.last = time.Now()
+	hb.wg.Add(1)
+
+	go func() {
+		defer hb.wg.Done()
+
+		timer := time.NewTimer(hb.interval)
+
+		defer timer.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-timer.C:
+			}
+
+			timer.Reset(hb.tick())
+		}
+	}()
+}
+
+// write the keepalive chunk, if it is time to; returns the time to wait till the next check
+func (hb *heartbeatWriter) tick() time.Duration {
+	hb.lock.Lock()
+	defer hb.lock.Unlock()
+
+	if idle := time.Since(hb.last); idle < hb.interval {
+		return hb.interval - idle
+	}
+
+	if hb.err == nil {
+		if _, hb.err = hb.keepalive(hb.ka); hb.err == nil && hb.flush != nil {
+			hb.err = hb.flush()
+		}
+	}
+
+	hb.last = time.Now()
+	return hb.interval
+}
+
+// stop the background goroutine, if running
+func (hb *heartbeatWriter) stop() {
+	hb.lock.Lock()
+	done := hb.done
+	hb.done = nil
+	hb.lock.Unlock()
+
+	if done != nil {
+		close(done)
+		hb.wg.Wait()
+	}
+}
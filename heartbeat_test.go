@@ -0,0 +1,91 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHeartbeatStream(t *testing.T) {
+	var w syncBuffer
+
+	const ping = ": ping\n"
+
+	_, err := HeartbeatStream(&w, 10*time.Millisecond, String(ping)).Write(
+		String("data: aaa\n"),
+		func(_ *Writer) (int64, error) {
+			time.Sleep(55 * time.Millisecond)
+			return 0, nil
+		},
+		String("data: bbb\n"),
+	)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	res := w.String()
+
+	if !strings.HasPrefix(res, "data: aaa\n"+ping) || !strings.HasSuffix(res, ping+"data: bbb\n") {
+		t.Errorf("Unexpected result: %q", res)
+		return
+	}
+
+	// no more pings after the stream is done
+	time.Sleep(30 * time.Millisecond)
+
+	if s := w.String(); s != res {
+		t.Errorf("Unexpected result after completion: %q", s)
+		return
+	}
+
+	// keepalive before the first write
+	w = syncBuffer{}
+
+	_, err = HeartbeatStream(&w, 10*time.Millisecond, String(ping)).Write(
+		func(_ *Writer) (int64, error) {
+			time.Sleep(25 * time.Millisecond)
+			return 0, nil
+		},
+		String("data: ccc\n"),
+	)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if res = w.String(); !strings.HasPrefix(res, ping) || !strings.HasSuffix(res, "data: ccc\n") {
+		t.Errorf("Unexpected result: %q", res)
+		return
+	}
+}
@@ -0,0 +1,87 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"io"
+	"net/http"
+)
+
+// ResponseStream constructs a stream that writes to the given http.ResponseWriter. The response
+// writer is already buffered, so no extra buffer is added. If the response writer supports flushing
+// (http.Flusher), the response is flushed when the stream Write() completes, and also by the Flush
+// chunk, for incremental delivery. Write errors caused by the client going away are reported
+// as *DisconnectError.
+func ResponseStream(w http.ResponseWriter) Stream {
+	s := WriterStream(&responseWriter{w})
+
+	switch f := w.(type) {
+	case interface{ FlushError() error }:
+		s.w.flush = f.FlushError
+	case http.Flusher:
+		s.w.flush = func() error { f.Flush(); return nil }
+	}
+
+	return s
+}
+
+// DisconnectError is returned from a stream when the remote side has closed the connection.
+type DisconnectError struct {
+	Err error
+}
+
+func (e *DisconnectError) Error() string { return "client disconnected: " + e.Err.Error() }
+func (e *DisconnectError) Unwrap() error { return e.Err }
+
+type responseWriter struct {
+	w http.ResponseWriter
+}
+
+func (r *responseWriter) Write(s []byte) (n int, err error) {
+	n, err = r.w.Write(s)
+	return n, mapDisconnect(err)
+}
+
+func (r *responseWriter) WriteString(s string) (n int, err error) {
+	n, err = io.WriteString(r.w, s)
+	return n, mapDisconnect(err)
+}
+
+func (r *responseWriter) ReadFrom(src io.Reader) (n int64, err error) {
+	n, err = io.Copy(r.w, src)
+	return n, mapDisconnect(err)
+}
+
+func mapDisconnect(err error) error {
+	if err != nil && isDisconnect(err) {
+		err = &DisconnectError{err}
+	}
+
+	return err
+}
@@ -0,0 +1,80 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestResponseStream(t *testing.T) {
+	rec := httptest.NewRecorder()
+
+	_, err := ResponseStream(rec).Write(String("aaa"), Flush, String("bbb"))
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if !rec.Flushed {
+		t.Error("Response not flushed")
+		return
+	}
+
+	if s := rec.Body.String(); s != "aaabbb" {
+		t.Errorf("Unexpected result: %q instead of %q", s, "aaabbb")
+		return
+	}
+}
+
+func TestResponseStreamDisconnect(t *testing.T) {
+	_, err := ResponseStream(brokenResponse{}).Write(String("aaa"))
+
+	var de *DisconnectError
+
+	if !errors.As(err, &de) {
+		t.Error("Unexpected error:", err)
+		return
+	}
+
+	if !errors.Is(err, os.ErrClosed) {
+		t.Error("Unexpected error:", err)
+		return
+	}
+}
+
+type brokenResponse struct{}
+
+func (brokenResponse) Header() http.Header         { return http.Header{} }
+func (brokenResponse) WriteHeader(_ int)           {}
+func (brokenResponse) Write(_ []byte) (int, error) { return 0, os.ErrClosed }
@@ -0,0 +1,356 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"hash/maphash"
+	"io"
+	"io/fs"
+	"math"
+)
+
+// FilterLines constructs a chunk function that copies to a stream only those lines from the given
+// source for which the predicate returns true. The predicate receives each line without the
+// trailing '\n', and the byte slice is only valid until the predicate returns.
+func FilterLines(src io.Reader, keep func([]byte) bool) Chunk {
+	return func(w *Writer) (int64, error) {
+		return forEachLine(src, func(line []byte, eol bool) (int64, error) {
+			if !keep(line) {
+				return 0, nil
+			}
+
+			return writeLine(w, line, eol)
+		})
+	}
+}
+
+// MapLines constructs a chunk function that writes each line from the given source transformed
+// by the supplied function. The function receives each line without the trailing '\n' (which is
+// added back to the result), and the byte slice is only valid until the function returns.
+func MapLines(src io.Reader, fn func([]byte) []byte) Chunk {
+	return func(w *Writer) (int64, error) {
+		return forEachLine(src, func(line []byte, eol bool) (int64, error) {
+			return writeLine(w, fn(line), eol)
+		})
+	}
+}
+
+// write the line, with '\n' if required
+func writeLine(w *Writer, line []byte, eol bool) (n int64, err error) {
+	var m int
+
+	m, err = w.Write(line)
+	n = int64(m)
+
+	if err == nil && eol {
+		if err = w.WriteByte('\n'); err == nil {
+			n++
+		}
+	}
+
+	return
+}
+
+// iterate over the lines of the given source; the callback receives each line without '\n',
+// and a flag showing if the line was terminated with '\n'
+func forEachLine(src io.Reader, fn func([]byte, bool) (int64, error)) (n int64, err error) {
+	r := bufio.NewReader(src)
+
+	var long []byte // accumulator for lines longer than the reader buffer
+
+	for {
+		var line []byte
+
+		if line, err = r.ReadSlice('\n'); err == bufio.ErrBufferFull {
+			long = append(long, line...)
+			continue
+		}
+
+		if len(long) > 0 {
+			line = append(long, line...)
+			long = long[:0]
+		}
+
+		if err != nil && err != io.EOF {
+			return
+		}
+
+		eof := err == io.EOF
+
+		if len(line) > 0 {
+			eol := line[len(line)-1] == '\n'
+
+			if eol {
+				line = line[:len(line)-1]
+			}
+
+			var m int64
+
+			m, err = fn(line, eol)
+			n += m
+
+			if err != nil {
+				return
+			}
+		}
+
+		if eof {
+			return n, nil
+		}
+	}
+}
+
+// HeadLines constructs a chunk function that copies at most the given number of initial lines
+// from the source to a stream.
+func HeadLines(src io.Reader, num int) Chunk {
+	if num <= 0 {
+		return nopChunk
+	}
+
+	return func(w *Writer) (n int64, err error) {
+		count := 0
+
+		n, err = forEachLine(src, func(line []byte, eol bool) (m int64, err error) {
+			if m, err = writeLine(w, line, eol); err == nil {
+				// stop right away, without waiting for the next line from the source
+				if count++; count == num {
+					err = errStop
+				}
+			}
+
+			return
+		})
+
+		if err == errStop {
+			err = nil
+		}
+
+		return
+	}
+}
+
+var errStop = errors.New("stop iteration")
+
+// TailLines constructs a chunk function that copies at most the given number of final lines
+// of the specified disk file to a stream. The file is read backwards from the end, so only the
+// required part of the file is read.
+func TailLines(pathname string, num int) Chunk {
+	if num <= 0 {
+		return nopChunk
+	}
+
+	return func(w *Writer) (n int64, err error) {
+		var fd FileHandle
+
+		if fd, err = openFile(pathname); err != nil {
+			return
+		}
+
+		defer func() {
+			if e := fd.Close(); e != nil && err == nil {
+				err = e
+			}
+		}()
+
+		file, ok := fd.(seekableFile)
+
+		if !ok {
+			return 0, &fs.PathError{Op: "tail", Path: pathname, Err: errors.ErrUnsupported}
+		}
+
+		var start int64
+
+		if start, err = tailOffset(file, num); err != nil {
+			return
+		}
+
+		return w.ReadFrom(io.NewSectionReader(file, start, math.MaxInt64-start))
+	}
+}
+
+// find the offset of the n-th line from the end of the file
+func tailOffset(file seekableFile, num int) (int64, error) {
+	stat, err := file.Stat()
+
+	if err != nil {
+		return 0, err
+	}
+
+	pos := stat.Size()
+
+	if pos == 0 {
+		return 0, nil
+	}
+
+	var buff [32 * 1024]byte
+
+	count := -1 // do not count the last '\n', if any
+	first := true
+
+	for pos > 0 {
+		size := min64(pos, int64(len(buff)))
+		pos -= size
+
+		if _, err = file.ReadAt(buff[:size], pos); err != nil {
+			return 0, err
+		}
+
+		block := buff[:size]
+
+		if first {
+			if block[len(block)-1] != '\n' {
+				count = 0
+			}
+
+			first = false
+		}
+
+		for i := len(block) - 1; i >= 0; i-- {
+			if block[i] == '\n' {
+				if count++; count == num {
+					return pos + int64(i) + 1, nil
+				}
+			}
+		}
+	}
+
+	return 0, nil
+}
+
+// UniqueLines constructs a chunk function that writes the output of the given chunk with adjacent
+// duplicate lines removed, like "uniq" command does. A final line without the trailing '\n' is
+// considered different from the same line with '\n'.
+func UniqueLines(chunk Chunk) Chunk {
+	return func(w *Writer) (int64, error) {
+		var prev []byte
+		var prevEOL, started bool
+
+		return transformLines(w, chunk, func(line []byte, eol bool) (int64, error) {
+			if started && eol == prevEOL && bytes.Equal(line, prev) {
+				return 0, nil
+			}
+
+			prev, prevEOL, started = append(prev[:0], line...), eol, true
+			return writeLine(w, line, eol)
+		})
+	}
+}
+
+// UniqueLinesGlobal constructs a chunk function that writes the output of the given chunk with all
+// duplicate lines removed, keeping the first occurrence of each line. The lines are tracked via a set
+// of their 64-bit hashes, so the probability of a false duplicate, though very small, is not zero.
+// The set is limited to the given number of distinct lines, and the chunk fails with an error if the
+// limit is exceeded.
+func UniqueLinesGlobal(chunk Chunk, maxLines int) Chunk {
+	return func(w *Writer) (int64, error) {
+		seen := make(map[uint64]struct{})
+		seed := maphash.MakeSeed()
+
+		return transformLines(w, chunk, func(line []byte, eol bool) (int64, error) {
+			h := maphash.Bytes(seed, line)
+
+			if _, ok := seen[h]; ok {
+				return 0, nil
+			}
+
+			if len(seen) >= maxLines {
+				return 0, fmt.Errorf("number of unique lines exceeds the limit of %d", maxLines)
+			}
+
+			seen[h] = struct{}{}
+			return writeLine(w, line, eol)
+		})
+	}
+}
+
+// run the given chunk, passing each line of its output to the callback
+func transformLines(w *Writer, chunk Chunk, fn func([]byte, bool) (int64, error)) (n int64, err error) {
+	lw := lineWriter{fn: fn}
+
+	s := WriterStream(&lw)
+
+	s.w.inherit(w)
+
+	if _, err = s.Write(chunk); err != nil {
+		return lw.n, err
+	}
+
+	// last line without '\n'
+	if len(lw.buff) > 0 {
+		var m int64
+
+		m, err = fn(lw.buff, false)
+		lw.n += m
+	}
+
+	return lw.n, err
+}
+
+// io.Writer that splits the data into lines
+type lineWriter struct {
+	fn   func([]byte, bool) (int64, error)
+	buff []byte // incomplete line
+	n    int64  // total number of bytes written by the callback
+}
+
+func (lw *lineWriter) Write(s []byte) (int, error) {
+	size := len(s)
+
+	for len(s) > 0 {
+		i := bytes.IndexByte(s, '\n')
+
+		if i < 0 {
+			lw.buff = append(lw.buff, s...)
+			break
+		}
+
+		line := s[:i]
+
+		if len(lw.buff) > 0 {
+			lw.buff = append(lw.buff, line...)
+			line = lw.buff
+		}
+
+		m, err := lw.fn(line, true)
+		lw.n += m
+
+		if err != nil {
+			return size - len(s), err
+		}
+
+		lw.buff = lw.buff[:0]
+		s = s[i+1:]
+	}
+
+	return size, nil
+}
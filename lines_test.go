@@ -0,0 +1,199 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestFilterLines(t *testing.T) {
+	long := strings.Repeat("x", 10000)
+	src := "aaa\nbbb\n" + long + "\nabc"
+
+	var b strings.Builder
+
+	n, err := StringBuilderStream(&b).Write(FilterLines(strings.NewReader(src), func(line []byte) bool {
+		return bytes.HasPrefix(line, []byte("a")) || len(line) > 100
+	}))
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	exp := "aaa\n" + long + "\nabc"
+
+	if s := b.String(); s != exp {
+		t.Errorf("Unexpected result: %q", s)
+		return
+	}
+
+	if n != int64(len(exp)) {
+		t.Errorf("Unexpected number of bytes written: %d instead of %d", n, len(exp))
+		return
+	}
+}
+
+func TestMapLines(t *testing.T) {
+	var b strings.Builder
+
+	_, err := StringBuilderStream(&b).Write(MapLines(strings.NewReader("aaa\nbbb\n"), bytes.ToUpper))
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if s := b.String(); s != "AAA\nBBB\n" {
+		t.Errorf("Unexpected result: %q", s)
+		return
+	}
+}
+
+func TestHeadLines(t *testing.T) {
+	var b strings.Builder
+
+	_, err := StringBuilderStream(&b).Write(
+		HeadLines(strings.NewReader("aaa\nbbb\nccc\n"), 2),
+		HeadLines(strings.NewReader("ddd"), 2),
+	)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if s := b.String(); s != "aaa\nbbb\nddd" {
+		t.Errorf("Unexpected result: %q", s)
+		return
+	}
+
+	// the source blocks after the required lines
+	r, pw := io.Pipe()
+
+	defer pw.Close()
+
+	go pw.Write([]byte("aaa\nbbb\n"))
+
+	b.Reset()
+
+	if _, err = StringBuilderStream(&b).Write(HeadLines(r, 2)); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if s := b.String(); s != "aaa\nbbb\n" {
+		t.Errorf("Unexpected result: %q", s)
+		return
+	}
+}
+
+func TestTailLines(t *testing.T) {
+	long := strings.Repeat("x", 100000)
+
+	cases := []struct {
+		src, exp string
+		num      int
+	}{
+		{"aaa\nbbb\nccc\n", "bbb\nccc\n", 2},
+		{"aaa\nbbb\nccc", "bbb\nccc", 2},
+		{"aaa\nbbb\n", "aaa\nbbb\n", 5},
+		{"", "", 1},
+		{"\n\n\n", "\n\n", 2},
+		{"aaa\n" + long + "\nbbb\n", long + "\nbbb\n", 2},
+	}
+
+	for i, c := range cases {
+		name, err := writeTempFile(c.src)
+
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		defer os.Remove(name)
+
+		var b strings.Builder
+
+		if _, err = StringBuilderStream(&b).Write(TailLines(name, c.num)); err != nil {
+			t.Error(err)
+			return
+		}
+
+		if s := b.String(); s != c.exp {
+			t.Errorf("[%d] Unexpected result: %q instead of %q", i, s, c.exp)
+			return
+		}
+	}
+}
+
+func TestUniqueLines(t *testing.T) {
+	var b strings.Builder
+
+	_, err := StringBuilderStream(&b).Write(UniqueLines(All(
+		String("aaa\naaa\nbb"),
+		String("b\nbbb\naaa\n"),
+		String("aaa"),
+	)))
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if s := b.String(); s != "aaa\nbbb\naaa\naaa" {
+		t.Errorf("Unexpected result: %q", s)
+		return
+	}
+}
+
+func TestUniqueLinesGlobal(t *testing.T) {
+	var b strings.Builder
+
+	src := String("aaa\nbbb\naaa\nccc\nbbb\n")
+
+	if _, err := StringBuilderStream(&b).Write(UniqueLinesGlobal(src, 10)); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if s := b.String(); s != "aaa\nbbb\nccc\n" {
+		t.Errorf("Unexpected result: %q", s)
+		return
+	}
+
+	if _, err := StringBuilderStream(&b).Write(UniqueLinesGlobal(src, 2)); err == nil {
+		t.Error("Missing error")
+		return
+	}
+}
@@ -0,0 +1,234 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// ListingFormat specifies the output format of a directory listing.
+type ListingFormat int
+
+const (
+	// ListingText is a text format similar to the output of "ls -lR" command: for each directory
+	// a header line with the directory path is followed by one line per directory entry, with
+	// the mode, size, modification time, digest (if any), and name of the entry.
+	ListingText ListingFormat = iota
+
+	// ListingJSON is a JSON array of objects with fields "path", "mode", "size", "mtime" (RFC 3339),
+	// and "digest" (hex-encoded, regular files only, if requested).
+	ListingJSON
+
+	// ListingNDJSON is the same objects as in ListingJSON, one per line.
+	ListingNDJSON
+)
+
+// DirListing constructs a chunk function that writes the listing of the directory tree at the given
+// root in the specified format. The listing is produced while walking the tree, with the entries
+// of each directory sorted by name, and followed by the listings of its subdirectories. Symbolic
+// links are listed, but not followed. Paths in the listing are relative to the root, with '/'
+// separators. Failure to read a directory or a file is reported as *SourceError.
+func DirListing(root string, format ListingFormat) Chunk {
+	return ListingOptions{Format: format}.DirListing(root)
+}
+
+// ListingOptions specifies options for a directory listing. The zero value gives the behaviour
+// of DirListing function with ListingText format.
+type ListingOptions struct {
+	Format  ListingFormat    // output format
+	NewHash func() hash.Hash // if not nil, digests of regular files are computed with this hash
+}
+
+// DirListing is like the package-level DirListing function, but with the options applied.
+func (opts ListingOptions) DirListing(root string) Chunk {
+	return func(w *Writer) (n int64, err error) {
+		l := lister{opts: opts, root: root, fsys: os.DirFS(root), cw: countingWriter{w: w}}
+
+		if opts.Format == ListingJSON {
+			l.write("[")
+		}
+
+		if err = l.walk("."); err == nil && opts.Format == ListingJSON {
+			if l.count > 0 {
+				l.write("\n")
+			}
+
+			l.write("]\n")
+			err = l.err
+		}
+
+		return l.cw.n, err
+	}
+}
+
+// directory listing state
+type lister struct {
+	opts  ListingOptions
+	root  string
+	fsys  fs.FS
+	cw    countingWriter
+	count int   // number of entries written
+	err   error // write error
+}
+
+// list the given directory, then its subdirectories
+func (l *lister) walk(dir string) error {
+	entries, err := fs.ReadDir(l.fsys, dir)
+
+	if err != nil {
+		return sourceError("read", filepath.Join(l.root, filepath.FromSlash(dir)), err)
+	}
+
+	if l.opts.Format == ListingText {
+		if l.count > 0 {
+			l.write("\n")
+		}
+
+		l.write(dir + ":\n")
+	}
+
+	var subdirs []string
+
+	for _, e := range entries {
+		name := path.Join(dir, e.Name())
+
+		if err = l.entry(name, e); err != nil {
+			return err
+		}
+
+		if e.IsDir() {
+			subdirs = append(subdirs, name)
+		}
+	}
+
+	for _, sub := range subdirs {
+		if err = l.walk(sub); err != nil {
+			return err
+		}
+	}
+
+	return l.err
+}
+
+// write one entry
+func (l *lister) entry(name string, e fs.DirEntry) error {
+	info, err := e.Info()
+
+	if err != nil {
+		return sourceError("stat", filepath.Join(l.root, filepath.FromSlash(name)), err)
+	}
+
+	var digest string
+
+	if l.opts.NewHash != nil && info.Mode().IsRegular() {
+		if digest, err = l.digest(name); err != nil {
+			return err
+		}
+	}
+
+	switch l.opts.Format {
+	case ListingText:
+		line := info.Mode().String() + " " + strconv.FormatInt(info.Size(), 10) + " " +
+			info.ModTime().UTC().Format("2006-01-02 15:04:05") + " "
+
+		if len(digest) > 0 {
+			line += digest + " "
+		}
+
+		l.write(line + e.Name() + "\n")
+
+	default:
+		data, err := json.Marshal(listingEntry{
+			Path:    name,
+			Mode:    info.Mode().String(),
+			Size:    info.Size(),
+			ModTime: info.ModTime().UTC(),
+			Digest:  digest,
+		})
+
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case l.opts.Format == ListingNDJSON:
+			l.write(string(data) + "\n")
+		case l.count > 0:
+			l.write(",\n  " + string(data))
+		default:
+			l.write("\n  " + string(data))
+		}
+	}
+
+	l.count++
+	return l.err
+}
+
+type listingEntry struct {
+	Path    string    `json:"path"`
+	Mode    string    `json:"mode"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	Digest  string    `json:"digest,omitempty"`
+}
+
+// compute the digest of the given file
+func (l *lister) digest(name string) (string, error) {
+	file, err := l.fsys.Open(name)
+
+	if err != nil {
+		return "", sourceError("open", filepath.Join(l.root, filepath.FromSlash(name)), err)
+	}
+
+	defer file.Close()
+
+	h := l.opts.NewHash()
+
+	if _, err = io.Copy(h, file); err != nil {
+		return "", sourceError("read", filepath.Join(l.root, filepath.FromSlash(name)), err)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// write the string, recording the first error
+func (l *lister) write(s string) {
+	if l.err == nil {
+		_, l.err = l.cw.Write([]byte(s))
+	}
+}
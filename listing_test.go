@@ -0,0 +1,154 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDirListing(t *testing.T) {
+	root := t.TempDir()
+	ts := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	for name, content := range map[string]string{"b": "bbb", "a": "a", "sub/c": "cc"} {
+		pathname := filepath.Join(root, filepath.FromSlash(name))
+
+		if err := os.MkdirAll(filepath.Dir(pathname), 0755); err != nil {
+			t.Error(err)
+			return
+		}
+
+		if err := os.WriteFile(pathname, []byte(content), 0644); err != nil {
+			t.Error(err)
+			return
+		}
+
+		if err := os.Chmod(pathname, 0644); err != nil {
+			t.Error(err)
+			return
+		}
+
+		if err := os.Chtimes(pathname, ts, ts); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	// text
+	var b strings.Builder
+
+	if _, err := StringBuilderStream(&b).Write(DirListing(root, ListingText)); err != nil {
+		t.Error(err)
+		return
+	}
+
+	lines := strings.Split(b.String(), "\n")
+
+	if len(lines) != 8 ||
+		lines[0] != ".:" ||
+		lines[1] != "-rw-r--r-- 1 2020-01-02 03:04:05 a" ||
+		lines[2] != "-rw-r--r-- 3 2020-01-02 03:04:05 b" ||
+		!strings.HasPrefix(lines[3], "drwx") || !strings.HasSuffix(lines[3], " sub") ||
+		lines[4] != "" ||
+		lines[5] != "sub:" ||
+		lines[6] != "-rw-r--r-- 2 2020-01-02 03:04:05 c" ||
+		lines[7] != "" {
+		t.Errorf("Unexpected listing:\n%s", b.String())
+		return
+	}
+
+	// NDJSON with digests
+	b.Reset()
+
+	_, err := StringBuilderStream(&b).Write(ListingOptions{Format: ListingNDJSON, NewHash: sha256.New}.DirListing(root))
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	lines = strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+
+	if len(lines) != 4 {
+		t.Errorf("Unexpected listing:\n%s", b.String())
+		return
+	}
+
+	var e listingEntry
+
+	if err = json.Unmarshal([]byte(lines[3]), &e); err != nil {
+		t.Error(err)
+		return
+	}
+
+	const digest = "355b1bbfc96725cdce8f4a2708fda310a80e6d13315aec4e5eed2a75fe8032ce"
+
+	if e.Path != "sub/c" || e.Size != 2 || !e.ModTime.Equal(ts) || e.Mode != "-rw-r--r--" || e.Digest != digest {
+		t.Errorf("Unexpected entry: %s", lines[3])
+		return
+	}
+
+	// JSON
+	b.Reset()
+
+	if _, err = StringBuilderStream(&b).Write(DirListing(root, ListingJSON)); err != nil {
+		t.Error(err)
+		return
+	}
+
+	var list []listingEntry
+
+	if err = json.Unmarshal([]byte(b.String()), &list); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if len(list) != 4 || list[0].Path != "a" || list[2].Path != "sub" || list[3].Digest != "" {
+		t.Errorf("Unexpected listing:\n%s", b.String())
+		return
+	}
+
+	// missing directory
+	var se *SourceError
+
+	_, err = StringBuilderStream(&b).Write(DirListing(filepath.Join(root, "missing"), ListingText))
+
+	if !errors.As(err, &se) || !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+}
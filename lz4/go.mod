@@ -0,0 +1,8 @@
+module github.com/maxim2266/stout/lz4
+
+go 1.25
+
+require (
+	github.com/maxim2266/stout v0.0.0-20261015180058-26924c92f7ec
+	github.com/pierrec/lz4/v4 v4.1.30
+)
@@ -0,0 +1,64 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+/*
+Package lz4 provides LZ4 (frame format) compression for stout streams and chunks. The package
+is a separate module, so that the core package does not depend on the compression library.
+*/
+package lz4
+
+import (
+	"io"
+
+	"github.com/maxim2266/stout"
+	"github.com/pierrec/lz4/v4"
+)
+
+// Codec returns a stout.Codec producing LZ4 encoders with the given options.
+func Codec(opts ...lz4.Option) stout.Codec {
+	return func(w io.Writer) (io.WriteCloser, error) {
+		enc := lz4.NewWriter(w)
+
+		if err := enc.Apply(opts...); err != nil {
+			return nil, err
+		}
+
+		return enc, nil
+	}
+}
+
+// Stream constructs a stream that writes LZ4 compressed data to the given io.Writer object.
+// The stream is for one-time use only, see stout.CompressedStream.
+func Stream(w io.Writer, opts ...lz4.Option) (stout.Stream, error) {
+	return stout.CompressedStream(w, Codec(opts...))
+}
+
+// Compressed constructs a chunk function that writes the output of the given chunk LZ4 compressed.
+func Compressed(chunk stout.Chunk, opts ...lz4.Option) stout.Chunk {
+	return stout.Compressed(chunk, Codec(opts...))
+}
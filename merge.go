@@ -0,0 +1,147 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"bufio"
+	"container/heap"
+	"io"
+)
+
+// MergeSorted constructs a chunk function that merges lines from the given sources, each
+// sorted according to the supplied "less" function, into a single sorted sequence of lines written
+// to a stream, like "sort -m" command does. The "less" function receives lines without the trailing
+// '\n', and each output line is terminated with '\n'. The merge is stable, that is, equal lines are
+// written in the order of their sources.
+func MergeSorted(less func(a, b []byte) bool, sources ...io.Reader) Chunk {
+	return func(w *Writer) (n int64, err error) {
+		h := mergeHeap{less: less}
+
+		// read the first line from each source
+		for i, src := range sources {
+			s := &mergeSource{r: bufio.NewReader(src), index: i}
+
+			var ok bool
+
+			if ok, err = s.next(); err != nil {
+				return
+			}
+
+			if ok {
+				h.sources = append(h.sources, s)
+			}
+		}
+
+		heap.Init(&h)
+
+		// merge
+		for len(h.sources) > 0 {
+			s := h.sources[0]
+
+			var m int64
+
+			if m, err = writeLine(w, s.line, true); err != nil {
+				return
+			}
+
+			n += m
+
+			var ok bool
+
+			if ok, err = s.next(); err != nil {
+				return
+			}
+
+			if ok {
+				heap.Fix(&h, 0)
+			} else {
+				heap.Pop(&h)
+			}
+		}
+
+		return
+	}
+}
+
+type mergeSource struct {
+	r     *bufio.Reader
+	line  []byte
+	index int
+}
+
+// read the next line, returning false at the end of input
+func (s *mergeSource) next() (bool, error) {
+	line, err := s.r.ReadBytes('\n')
+
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+
+	if len(line) == 0 {
+		return false, nil
+	}
+
+	if line[len(line)-1] == '\n' {
+		line = line[:len(line)-1]
+	}
+
+	s.line = line
+	return true, nil
+}
+
+// heap of sources, ordered by their current lines
+type mergeHeap struct {
+	sources []*mergeSource
+	less    func(a, b []byte) bool
+}
+
+func (h *mergeHeap) Len() int { return len(h.sources) }
+
+func (h *mergeHeap) Less(i, j int) bool {
+	a, b := h.sources[i], h.sources[j]
+
+	switch {
+	case h.less(a.line, b.line):
+		return true
+	case h.less(b.line, a.line):
+		return false
+	default:
+		return a.index < b.index
+	}
+}
+
+func (h *mergeHeap) Swap(i, j int) { h.sources[i], h.sources[j] = h.sources[j], h.sources[i] }
+
+func (h *mergeHeap) Push(x interface{}) { h.sources = append(h.sources, x.(*mergeSource)) }
+
+func (h *mergeHeap) Pop() interface{} {
+	last := h.sources[len(h.sources)-1]
+	h.sources = h.sources[:len(h.sources)-1]
+	return last
+}
@@ -0,0 +1,79 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestMergeSorted(t *testing.T) {
+	less := func(a, b []byte) bool { return bytes.Compare(a, b) < 0 }
+
+	var b strings.Builder
+
+	_, err := StringBuilderStream(&b).Write(MergeSorted(less,
+		strings.NewReader("a\nd\ng\n"),
+		strings.NewReader(""),
+		strings.NewReader("b\ne\nh"),
+		strings.NewReader("c\nf\n"),
+	))
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if s := b.String(); s != "a\nb\nc\nd\ne\nf\ng\nh\n" {
+		t.Errorf("Unexpected result: %q", s)
+		return
+	}
+
+	// stability
+	b.Reset()
+
+	byFirst := func(a, b []byte) bool { return a[0] < b[0] }
+
+	_, err = StringBuilderStream(&b).Write(MergeSorted(byFirst,
+		strings.NewReader("a1\nb1\n"),
+		strings.NewReader("a2\nb2\n"),
+	))
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if s := b.String(); s != "a1\na2\nb1\nb2\n" {
+		t.Errorf("Unexpected result: %q", s)
+		return
+	}
+
+}
@@ -0,0 +1,230 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// MessageSink is the interface of a message publisher, like a Kafka or NATS producer,
+// typically adapted by a thin wrapper around the client library. The sink may retain
+// the message byte slice.
+type MessageSink interface {
+	Send(ctx context.Context, msg []byte) error
+}
+
+// Framing specifies how the stream output is cut into messages.
+type Framing int
+
+const (
+	// FrameLines makes each line of the output (without the trailing '\n') a message.
+	// A final line without '\n' is sent when the stream Write() completes.
+	FrameLines Framing = iota
+
+	// FrameLengthPrefixed makes each record of the output a message, where each record
+	// is prefixed with its length as 4-byte big-endian unsigned integer. Records longer
+	// than MaxMessageSize bytes are rejected with an error.
+	FrameLengthPrefixed
+)
+
+// MaxMessageSize is the maximum size of a length-prefixed message.
+const MaxMessageSize = 16 << 20
+
+// MessageStream constructs a stream that cuts the output into messages according to the
+// given framing, and publishes each message to the given sink as soon as it is complete.
+// Messages are sent with context.Background(); use MessageStreamContext to specify a context.
+func MessageStream(sink MessageSink, framing Framing) Stream {
+	return MessageStreamContext(context.Background(), sink, framing)
+}
+
+// MessageStreamContext is like MessageStream, but also takes a context to pass to the sink.
+// An unknown framing is reported as an error from the first write to the stream.
+func MessageStreamContext(ctx context.Context, sink MessageSink, framing Framing) Stream {
+	m := &messageWriter{ctx: ctx, sink: sink, framing: framing}
+
+	if framing != FrameLines && framing != FrameLengthPrefixed {
+		m.err = fmt.Errorf("stout: unknown message framing %d", framing)
+	}
+
+	return WriterStream(m)
+}
+
+type messageWriter struct {
+	ctx     context.Context
+	sink    MessageSink
+	framing Framing
+	buff    []byte
+	err     error // invalid configuration
+}
+
+func (m *messageWriter) Write(s []byte) (int, error) {
+	if m.err != nil {
+		return 0, m.err
+	}
+
+	m.buff = append(m.buff, s...)
+
+	return len(s), m.sendComplete()
+}
+
+// send all complete messages from the buffer
+func (m *messageWriter) sendComplete() (err error) {
+	for err == nil {
+		var msg []byte
+		var k int
+
+		if msg, k, err = m.next(); k == 0 {
+			break
+		}
+
+		err = m.sink.Send(m.ctx, msg)
+		m.buff = m.buff[:copy(m.buff, m.buff[k:])]
+	}
+
+	return
+}
+
+// extract the next complete message from the buffer, returning the message and the number
+// of bytes consumed, or 0 if there is no complete message
+func (m *messageWriter) next() ([]byte, int, error) {
+	switch m.framing {
+	case FrameLines:
+		if i := bytes.IndexByte(m.buff, '\n'); i >= 0 {
+			return append([]byte(nil), m.buff[:i]...), i + 1, nil
+		}
+
+	default: // FrameLengthPrefixed
+		if len(m.buff) >= 4 {
+			size := int64(binary.BigEndian.Uint32(m.buff))
+
+			if size > MaxMessageSize {
+				m.buff = m.buff[:0]
+				return nil, 0, fmt.Errorf("message size %d exceeds the limit of %d bytes", size, MaxMessageSize)
+			}
+
+			if int64(len(m.buff)-4) >= size {
+				return append([]byte(nil), m.buff[4:4+size]...), 4 + int(size), nil
+			}
+		}
+	}
+
+	return nil, 0, nil
+}
+
+// Flush is called at the end of the stream Write() function.
+func (m *messageWriter) Flush() error {
+	if m.err != nil || len(m.buff) == 0 {
+		return nil
+	}
+
+	if m.framing != FrameLines {
+		m.buff = m.buff[:0]
+		return errors.New("incomplete message at the end of stream")
+	}
+
+	msg := append([]byte(nil), m.buff...)
+	m.buff = m.buff[:0]
+
+	return m.sink.Send(m.ctx, msg)
+}
+
+// WSStream constructs a stream that packages the output into websocket messages of the given
+// type (as, for example, in github.com/gorilla/websocket package), each of at most maxFrame bytes.
+// Full messages are sent as soon as they are available, and the remainder is sent when the
+// stream Write() completes. The function panics if maxFrame is not positive.
+func WSStream(conn interface{ WriteMessage(int, []byte) error }, messageType int, maxFrame int) Stream {
+	return CallbackStream(func(b []byte) error {
+		return conn.WriteMessage(messageType, b)
+	}, maxFrame)
+}
+
+// CallbackStream constructs a stream that slices the output into pieces of the given size and
+// invokes the callback on each piece, for example, to feed a gRPC streaming response. The last
+// piece may be shorter, and it is sent when the stream Write() completes. The callback must not
+// retain the byte slice. The function panics if the chunk size is not positive.
+func CallbackStream(send func([]byte) error, chunkSize int) Stream {
+	if chunkSize <= 0 {
+		panic("stout: invalid chunk size")
+	}
+
+	return WriterStream(newFrameWriter(send, chunkSize))
+}
+
+// io.Writer that cuts the output into frames of a fixed size
+type frameWriter struct {
+	send func([]byte) error
+	buff []byte
+}
+
+func newFrameWriter(send func([]byte) error, size int) *frameWriter {
+	return &frameWriter{send: send, buff: make([]byte, 0, size)}
+}
+
+func (f *frameWriter) Write(s []byte) (n int, err error) {
+	for len(s) > 0 {
+		// bypass the buffer for full frames
+		if size := cap(f.buff); len(f.buff) == 0 && len(s) >= size {
+			if err = f.send(s[:size]); err != nil {
+				return
+			}
+
+			n += size
+			s = s[size:]
+			continue
+		}
+
+		m := min(cap(f.buff)-len(f.buff), len(s))
+
+		f.buff = append(f.buff, s[:m]...)
+		n += m
+		s = s[m:]
+
+		if len(f.buff) == cap(f.buff) {
+			if err = f.Flush(); err != nil {
+				return
+			}
+		}
+	}
+
+	return
+}
+
+// Flush sends the buffered data, if any.
+func (f *frameWriter) Flush() (err error) {
+	if len(f.buff) > 0 {
+		err = f.send(f.buff)
+		f.buff = f.buff[:0]
+	}
+
+	return
+}
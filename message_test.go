@@ -0,0 +1,206 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestMessageStreamLines(t *testing.T) {
+	var sink testSink
+
+	n, err := MessageStream(&sink, FrameLines).Write(
+		String("aaa\nbb"),
+		String("b\n"),
+		String("ccc"),
+	)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if n != 11 {
+		t.Errorf("Unexpected number of bytes written: %d instead of 11", n)
+		return
+	}
+
+	if err = sink.check("aaa", "bbb", "ccc"); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// unknown framing
+	if _, err = MessageStream(&sink, Framing(42)).Write(String("aaa\n")); err == nil {
+		t.Error("Missing error")
+		return
+	}
+
+	t.Log(err)
+}
+
+func TestMessageStreamLengthPrefixed(t *testing.T) {
+	var sink testSink
+
+	record := func(s string) Chunk {
+		var size [4]byte
+
+		binary.BigEndian.PutUint32(size[:], uint32(len(s)))
+
+		return All(ByteSlice(size[:]), String(s))
+	}
+
+	_, err := MessageStream(&sink, FrameLengthPrefixed).Write(
+		record("aaa"),
+		record(""),
+		record("bbbb"),
+	)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err = sink.check("aaa", "", "bbbb"); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// incomplete record
+	if _, err = MessageStream(&sink, FrameLengthPrefixed).Write(String("\x00\x00\x00\x05abc")); err == nil {
+		t.Error("Missing error")
+		return
+	}
+
+	t.Log(err)
+
+	// oversized record
+	if _, err = MessageStream(&sink, FrameLengthPrefixed).Write(String("\xff\xff\xff\xffabc")); err == nil {
+		t.Error("Missing error")
+		return
+	}
+
+	t.Log(err)
+}
+
+type testSink struct {
+	msgs []string
+}
+
+func (s *testSink) Send(_ context.Context, msg []byte) error {
+	s.msgs = append(s.msgs, string(msg))
+	return nil
+}
+
+func (s *testSink) check(exp ...string) error {
+	if len(s.msgs) != len(exp) {
+		return fmt.Errorf("Unexpected number of messages: %d instead of %d", len(s.msgs), len(exp))
+	}
+
+	for i, m := range s.msgs {
+		if m != exp[i] {
+			return fmt.Errorf("Unexpected message %d: %q instead of %q", i, m, exp[i])
+		}
+	}
+
+	return nil
+}
+
+func TestWSStream(t *testing.T) {
+	var conn testConn
+
+	n, err := WSStream(&conn, 1, 4).Write(
+		String("aa"),
+		String("bbbbbbbbb"),
+		String("c"),
+	)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if n != 12 {
+		t.Errorf("Unexpected number of bytes written: %d instead of 12", n)
+		return
+	}
+
+	if err = conn.check("aabb", "bbbb", "bbbc"); err != nil {
+		t.Error(err)
+	}
+}
+
+type testConn struct {
+	testSink
+}
+
+func (c *testConn) WriteMessage(mt int, msg []byte) error {
+	if mt != 1 {
+		return fmt.Errorf("Unexpected message type: %d", mt)
+	}
+
+	return c.Send(context.Background(), msg)
+}
+
+func TestCallbackStream(t *testing.T) {
+	var sink testSink
+
+	send := func(b []byte) error { return sink.Send(context.Background(), b) }
+
+	if _, err := CallbackStream(send, 3).Write(String("aaabbbcc"), RepeatN(4, Byte('d'))); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := sink.check("aaa", "bbb", "ccd", "ddd"); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// error from the callback
+	fail := func(_ []byte) error { return errors.New("send error") }
+
+	if _, err := CallbackStream(fail, 3).Write(String("aa")); err == nil || err.Error() != "send error" {
+		t.Error("Unexpected error:", err)
+		return
+	}
+
+	// invalid chunk size
+	defer func() {
+		if recover() == nil {
+			t.Error("Missing panic")
+		}
+	}()
+
+	CallbackStream(send, 0)
+}
@@ -0,0 +1,71 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+var openFiles atomic.Pointer[semaphore]
+
+// SetOpenFileLimit limits the number of files the File and Files chunks may hold open at the same
+// time across all the streams, and returns the previous limit. Zero or negative value means no limit
+// (the default). Once the limit is reached, the chunks wait for a file to be closed; the wait is
+// aborted when the context of the write (see Stream.WriteContext) is done. The limit protects
+// against exceeding the operating system limit on open files when many streams are written
+// concurrently.
+func SetOpenFileLimit(n int) int {
+	var sem *semaphore
+
+	if n > 0 {
+		sem = newSemaphore(int64(n))
+	}
+
+	if prev := openFiles.Swap(sem); prev != nil {
+		return int(prev.size)
+	}
+
+	return 0
+}
+
+// take a slot for an open file, returning the function releasing the slot
+func acquireOpenFile(ctx context.Context) (func(), error) {
+	sem := openFiles.Load()
+
+	if sem == nil {
+		return func() {}, nil
+	}
+
+	if err := sem.acquire(ctx, 1); err != nil {
+		return nil, err
+	}
+
+	return func() { sem.release(1) }, nil
+}
@@ -0,0 +1,108 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOpenFileLimit(t *testing.T) {
+	dir := t.TempDir()
+	names := []string{filepath.Join(dir, "a"), filepath.Join(dir, "b")}
+
+	for _, name := range names {
+		if err := os.WriteFile(name, []byte(filepath.Base(name)), 0644); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	defer SetOpenFileLimit(SetOpenFileLimit(1))
+
+	var b strings.Builder
+
+	if _, err := StringBuilderStream(&b).Write(Files(names...)); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if b.String() != "ab" {
+		t.Errorf("Unexpected result: %q", b.String())
+		return
+	}
+
+	// hold the only slot by a file being copied to a blocked pipe
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+
+	go func() {
+		_, err := WriterStream(pw).Write(File(names[0]))
+		pw.CloseWithError(err)
+		done <- err
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+
+	defer cancel()
+
+	if _, err := StringBuilderStream(&b).WriteContext(ctx, File(names[1])); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	if data, err := io.ReadAll(pr); err != nil || string(data) != "a" {
+		t.Errorf("Unexpected result: %q, %v", data, err)
+		return
+	}
+
+	if err := <-done; err != nil {
+		t.Error(err)
+		return
+	}
+
+	// the slot is released
+	if _, err := StringBuilderStream(&b).Write(File(names[1])); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if SetOpenFileLimit(0) != 1 {
+		t.Error("Unexpected previous limit")
+		return
+	}
+}
@@ -0,0 +1,178 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"io"
+	"time"
+)
+
+// Option configures a stream constructed by NewStream function.
+type Option func(*streamOptions)
+
+type streamOptions struct {
+	bufferSize    int
+	closeOnFinish bool
+	flushPolicy   FlushPolicy
+	errorPolicy   ErrorPolicy
+	keepOpen      bool
+	finishTimeout time.Duration
+	checkUse      bool
+	stopOnClosed  bool
+}
+
+// FlushPolicy defines when a buffered stream gets flushed.
+type FlushPolicy int
+
+const (
+	// FlushOnFinish flushes the stream once all the chunks have been written (the default).
+	FlushOnFinish FlushPolicy = iota
+	// FlushEachChunk flushes the stream after each chunk passed to the stream Write() function.
+	FlushEachChunk
+)
+
+// ErrorPolicy defines what happens to the buffered data when a chunk fails.
+type ErrorPolicy int
+
+const (
+	// DiscardOnError leaves the buffered data unwritten (the default).
+	DiscardOnError ErrorPolicy = iota
+	// FlushOnError flushes the data written before the failure, ignoring any error from flushing.
+	FlushOnError
+)
+
+// NewStream constructs a stream from the given io.Writer object, configured by the given options.
+// Without options, the stream is the same as the one constructed by WriterStream function.
+func NewStream(w io.Writer, opts ...Option) (s Stream) {
+	var o streamOptions
+
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if o.bufferSize > 0 {
+		s = writerBufferedStream(w, o.bufferSize)
+	} else {
+		s = WriterStream(w)
+	}
+
+	if c, ok := w.(io.Closer); ok && o.closeOnFinish {
+		s.w.close = c.Close
+	}
+
+	s.w.flushEachChunk = o.flushPolicy == FlushEachChunk
+	s.w.flushOnError = o.errorPolicy == FlushOnError
+	s.w.keepOpenOnError = o.keepOpen
+	s.w.stopOnClosed = o.stopOnClosed
+
+	if o.checkUse {
+		s.CheckConcurrency()
+	}
+
+	if o.finishTimeout > 0 {
+		s.w.finishTimeout = o.finishTimeout
+
+		if d, ok := w.(interface{ SetWriteDeadline(time.Time) error }); ok {
+			s.w.setDeadline = d.SetWriteDeadline
+		}
+	}
+
+	return
+}
+
+// WithBufferSize makes the stream buffered, with the buffer of the given size.
+// Sizes below 4096 bytes are rounded up to 4096.
+func WithBufferSize(size int) Option {
+	return func(o *streamOptions) { o.bufferSize = size }
+}
+
+// WithCloseOnFinish makes the stream close the writer (if it implements io.Closer)
+// upon exit from the stream Write() function.
+func WithCloseOnFinish(close bool) Option {
+	return func(o *streamOptions) { o.closeOnFinish = close }
+}
+
+// WithKeepOpenOnError makes the stream leave the writer open if any chunk fails, so that
+// the caller can still write something to it (like an error frame or an HTTP trailer), and
+// then close it. Only has effect together with WithCloseOnFinish(true).
+func WithKeepOpenOnError(keep bool) Option {
+	return func(o *streamOptions) { o.keepOpen = keep }
+}
+
+// WithFinishTimeout bounds the final flush and close of the writer upon exit from the stream
+// Write() function by the given timeout. If the writer supports write deadlines (like net.Conn
+// or os.File for pipes), the deadline is set on the writer, otherwise a watchdog timer is used,
+// and on timeout the flush or close is abandoned, continuing in the background. In both cases
+// the timeout results in an error matching os.ErrDeadlineExceeded. An abandoned flush is followed
+// by the close (if any) once the flush completes, and all subsequent Write() calls on the stream
+// fail with the same error, as the writer may still be in use.
+func WithFinishTimeout(timeout time.Duration) Option {
+	return func(o *streamOptions) { o.finishTimeout = timeout }
+}
+
+// WithStopOnSinkClosed makes the stream treat the destination closed by the reader (like
+// a broken pipe when the output is piped into "head" command or a pager) as a graceful early
+// stop: the stream Write() function returns no error, and reports the number of bytes written
+// to the stream before the stop. Other errors are not affected.
+func WithStopOnSinkClosed(stop bool) Option {
+	return func(o *streamOptions) { o.stopOnClosed = stop }
+}
+
+// WithConcurrencyCheck switches the stream to the checking mode, as described for
+// Stream.CheckConcurrency function.
+func WithConcurrencyCheck(check bool) Option {
+	return func(o *streamOptions) { o.checkUse = check }
+}
+
+// WithFlushPolicy sets the flush policy of the stream.
+func WithFlushPolicy(p FlushPolicy) Option {
+	return func(o *streamOptions) { o.flushPolicy = p }
+}
+
+// WithErrorPolicy sets the error policy of the stream.
+func WithErrorPolicy(p ErrorPolicy) Option {
+	return func(o *streamOptions) { o.errorPolicy = p }
+}
+
+// wrap the chunks to flush the stream after each of them
+func flushingChunks(chunks []Chunk) []Chunk {
+	res := make([]Chunk, len(chunks))
+
+	for i, chunk := range chunks {
+		res[i] = func(w *Writer) (n int64, err error) {
+			if n, err = chunk(w); err == nil {
+				err = w.Flush()
+			}
+
+			return
+		}
+	}
+
+	return res
+}
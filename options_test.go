@@ -0,0 +1,253 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestNewStream(t *testing.T) {
+	var c closeRecorder
+
+	n, err := NewStream(&c, WithBufferSize(100), WithCloseOnFinish(true)).Write(String("aaa"), String("bbb"))
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if n != 6 || c.String() != "aaabbb" || !c.closed {
+		t.Errorf("Unexpected result: %q, closed %v", c.String(), c.closed)
+		return
+	}
+
+	// not closing
+	c.closed = false
+
+	if _, err = NewStream(&c, WithCloseOnFinish(false)).Write(String("aaa")); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if c.closed {
+		t.Error("Unexpected close")
+		return
+	}
+}
+
+func TestFlushPolicy(t *testing.T) {
+	var c closeRecorder
+	var sizes []int
+
+	probe := func(_ *Writer) (int64, error) {
+		sizes = append(sizes, c.Len())
+		return 0, nil
+	}
+
+	_, err := NewStream(&c, WithBufferSize(4096), WithFlushPolicy(FlushEachChunk)).Write(String("aaa"), probe, String("bbb"), probe)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if len(sizes) != 2 || sizes[0] != 3 || sizes[1] != 6 {
+		t.Error("Unexpected flushes:", sizes)
+		return
+	}
+}
+
+func TestErrorPolicy(t *testing.T) {
+	fail := func(_ *Writer) (int64, error) { return 0, errors.New("test error") }
+
+	for _, c := range []struct {
+		policy ErrorPolicy
+		exp    string
+	}{
+		{DiscardOnError, ""},
+		{FlushOnError, "aaa"},
+	} {
+		var r closeRecorder
+
+		if _, err := NewStream(&r, WithBufferSize(4096), WithErrorPolicy(c.policy)).Write(String("aaa"), fail); err == nil {
+			t.Error("Missing error")
+			return
+		}
+
+		if r.String() != c.exp {
+			t.Errorf("Unexpected result: %q instead of %q", r.String(), c.exp)
+			return
+		}
+	}
+}
+
+func TestKeepOpenOnError(t *testing.T) {
+	fail := func(_ *Writer) (int64, error) { return 0, errors.New("test error") }
+
+	for _, keep := range []bool{false, true} {
+		var c closeRecorder
+
+		s := NewStream(&c, WithCloseOnFinish(true), WithKeepOpenOnError(keep))
+
+		if _, err := s.Write(String("aaa"), fail); err == nil {
+			t.Error("Missing error")
+			return
+		}
+
+		if c.closed == keep {
+			t.Errorf("Unexpected state with keep-open %v: closed %v", keep, c.closed)
+			return
+		}
+
+		// the writer is still closed on success
+		if _, err := s.Write(String("aaa")); err != nil || !c.closed {
+			t.Error("Unexpected result:", err, c.closed)
+			return
+		}
+	}
+}
+
+func TestFinishTimeout(t *testing.T) {
+	// watchdog
+	c := &blockingCloser{release: make(chan struct{})}
+
+	defer close(c.release)
+
+	_, err := NewStream(c, WithCloseOnFinish(true), WithFinishTimeout(20*time.Millisecond)).Write(String("x"))
+
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	// abandoned flush makes the stream unusable
+	b := &blockingWriter{release: make(chan struct{})}
+
+	defer close(b.release)
+
+	s := NewStream(b, WithBufferSize(4096), WithFinishTimeout(10*time.Millisecond))
+
+	for i := 0; i < 2; i++ {
+		if _, err = s.Write(String("x")); !errors.Is(err, os.ErrDeadlineExceeded) {
+			t.Errorf("Unexpected error on write %d: %v", i, err)
+			return
+		}
+	}
+
+	// write deadline
+	conn, peer := net.Pipe()
+
+	defer peer.Close()
+	defer conn.Close()
+
+	_, err = NewStream(conn, WithBufferSize(4096), WithFinishTimeout(20*time.Millisecond)).Write(String("x"))
+
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	// no timeout
+	if _, err = NewStream(&closeRecorder{}, WithCloseOnFinish(true), WithFinishTimeout(time.Second)).Write(String("x")); err != nil {
+		t.Error(err)
+		return
+	}
+}
+
+func TestStopOnSinkClosed(t *testing.T) {
+	pr, pw, err := os.Pipe()
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	defer pw.Close()
+
+	go func() {
+		buff := make([]byte, 6)
+
+		io.ReadFull(pr, buff)
+		pr.Close()
+	}()
+
+	s := NewStream(pw, WithStopOnSinkClosed(true))
+
+	n, err := s.Write(String("aaa"), String("bbb"), Repeat(func(_ int, w *Writer) (int64, error) {
+		time.Sleep(time.Millisecond)
+
+		n, err := w.WriteString("ccc")
+		return int64(n), err
+	}))
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if n < 6 || n%3 != 0 {
+		t.Errorf("Unexpected number of bytes: %d", n)
+		return
+	}
+
+	// other errors are reported
+	fail := func(_ *Writer) (int64, error) { return 0, errors.New("test error") }
+
+	if _, err = NewStream(io.Discard, WithStopOnSinkClosed(true)).Write(fail); err == nil {
+		t.Error("Missing error")
+		return
+	}
+}
+
+// io.Writer with Write blocking until released
+type blockingWriter struct {
+	release chan struct{}
+}
+
+func (b *blockingWriter) Write(s []byte) (int, error) {
+	<-b.release
+	return len(s), nil
+}
+
+// io.WriteCloser with Close blocking until released
+type blockingCloser struct {
+	release chan struct{}
+}
+
+func (c *blockingCloser) Write(s []byte) (int, error) { return len(s), nil }
+
+func (c *blockingCloser) Close() error {
+	<-c.release
+	return nil
+}
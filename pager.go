@@ -0,0 +1,87 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"context"
+	"io"
+	"os"
+	"strings"
+)
+
+// PagerStream constructs a stream for displaying the output of a command line tool via a pager,
+// like "git log" does. If STDOUT is a terminal, the pager command from $PAGER environment variable
+// (or "less -R" by default) is started, and the stream writes to its STDIN, otherwise, or if the pager
+// cannot be started, the stream writes to STDOUT. The pager is terminated when the given context
+// is done. The user quitting the pager before the end of the output is not an error (see
+// WithStopOnSinkClosed). Upon exit from the stream Write() function the pager's STDIN is closed,
+// and the function waits for the pager to exit, so the stream is for one-time use only.
+func PagerStream(ctx context.Context) Stream {
+	if isTerminal(os.Stdout) {
+		pager := os.Getenv("PAGER")
+
+		if len(strings.TrimSpace(pager)) == 0 {
+			pager = "less -R"
+		}
+
+		if s, err := startPager(ctx, pager, os.Stdout); err == nil {
+			return s
+		}
+	}
+
+	return NewStream(os.Stdout, WithBufferSize(32*1024), WithStopOnSinkClosed(true))
+}
+
+// start the given pager command, returning the stream writing to its STDIN
+func startPager(ctx context.Context, pager string, out io.Writer) (s Stream, err error) {
+	args := strings.Fields(pager)
+	cmd := newCommand(ctx, args[0], args[1:])
+
+	cmd.Stdout = out
+	cmd.Stderr = os.Stderr
+
+	var stdin io.WriteCloser
+
+	if stdin, err = cmd.StdinPipe(); err != nil {
+		return
+	}
+
+	if err = cmd.Start(); err != nil {
+		return
+	}
+
+	s = NewStream(stdin, WithBufferSize(32*1024), WithStopOnSinkClosed(true))
+
+	s.w.close = func() error {
+		stdin.Close()
+		return cmd.Wait()
+	}
+
+	return
+}
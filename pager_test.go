@@ -0,0 +1,87 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"bytes"
+	"context"
+	"runtime"
+	"testing"
+)
+
+func TestPager(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires unix tools")
+	}
+
+	var b bytes.Buffer
+
+	s, err := startPager(context.Background(), "tr a-z A-Z", &b)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if _, err = s.Write(String("Hello, "), String("world!")); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if b.String() != "HELLO, WORLD!" {
+		t.Errorf("Unexpected result: %q", b.String())
+		return
+	}
+
+	// pager quitting early
+	s, err = startPager(context.Background(), "head -c 3", &b)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	b.Reset()
+
+	if _, err = s.Write(Repeat(func(_ int, w *Writer) (int64, error) { return String("zzz\n")(w) })); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if b.String() != "zzz" {
+		t.Errorf("Unexpected result: %q", b.String())
+		return
+	}
+
+	// invalid pager
+	if _, err = startPager(context.Background(), "this-command-does-not-exist", &b); err == nil {
+		t.Error("Missing error")
+		return
+	}
+}
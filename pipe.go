@@ -0,0 +1,181 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"io"
+	"sync"
+)
+
+// BoundedPipe creates a synchronous in-memory pipe with a ring buffer of the given capacity
+// between a producing stream and a consuming reader. Writes to the stream block when the buffer
+// is full, until the consumer reads some data, thus providing explicit backpressure. When the stream
+// Write() function completes, the pipe gets closed, and the reader returns io.EOF after all the buffered
+// data, or the error from the stream, if any. Closing the reader makes all further writes to the stream
+// fail with io.ErrClosedPipe. The stream is for one-time use only.
+func BoundedPipe(capacity int) (Stream, *PipeReader) {
+	if capacity <= 0 {
+		panic("stout: invalid pipe capacity")
+	}
+
+	p := &pipe{buff: make([]byte, capacity)}
+
+	p.cond.L = &p.lock
+
+	s := WriterStream((*boundedPipeWriter)(p))
+
+	s.w.closeWithError = p.closeWrite
+	return s, (*PipeReader)(p)
+}
+
+type pipe struct {
+	lock  sync.Mutex
+	cond  sync.Cond
+	buff  []byte // ring buffer
+	start int    // start of the data in the buffer
+	size  int    // number of bytes in the buffer
+	werr  error  // write end closed with this error (io.EOF if no error)
+	rdone bool   // read end closed
+}
+
+type boundedPipeWriter pipe
+
+func (pw *boundedPipeWriter) Write(s []byte) (n int, err error) {
+	p := (*pipe)(pw)
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for len(s) > 0 {
+		for p.size == len(p.buff) && !p.rdone {
+			p.cond.Wait()
+		}
+
+		if p.rdone {
+			return n, io.ErrClosedPipe
+		}
+
+		// copy as much as possible
+		end := (p.start + p.size) % len(p.buff)
+		limit := len(p.buff)
+
+		if end < p.start {
+			limit = p.start
+		}
+
+		m := copy(p.buff[end:limit], s)
+
+		p.size += m
+		n += m
+		s = s[m:]
+
+		p.cond.Broadcast()
+	}
+
+	return
+}
+
+func (p *pipe) closeWrite(err error) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if err == nil {
+		err = io.EOF
+	}
+
+	p.werr = err
+	p.cond.Broadcast()
+	return nil
+}
+
+// PipeReader is the read end of a pipe created by BoundedPipe.
+type PipeReader pipe
+
+// Read implements io.Reader interface.
+func (pr *PipeReader) Read(s []byte) (n int, err error) {
+	p := (*pipe)(pr)
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if len(s) == 0 {
+		return
+	}
+
+	for p.size == 0 && p.werr == nil && !p.rdone {
+		p.cond.Wait()
+	}
+
+	switch {
+	case p.rdone:
+		return 0, io.ErrClosedPipe
+	case p.size == 0:
+		return 0, p.werr
+	}
+
+	// copy as much as possible
+	limit := min(p.start+p.size, len(p.buff))
+
+	n = copy(s, p.buff[p.start:limit])
+
+	if n < len(s) && p.size > n { // wrap around
+		n += copy(s[n:], p.buff[:p.size-n])
+	}
+
+	p.start = (p.start + n) % len(p.buff)
+	p.size -= n
+
+	p.cond.Broadcast()
+	return
+}
+
+// Close closes the reader; subsequent writes to the stream return io.ErrClosedPipe.
+func (pr *PipeReader) Close() error {
+	p := (*pipe)(pr)
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.rdone = true
+	p.cond.Broadcast()
+	return nil
+}
+
+// Buffered returns the number of bytes currently in the pipe buffer.
+func (pr *PipeReader) Buffered() int {
+	p := (*pipe)(pr)
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return p.size
+}
+
+// Cap returns the capacity of the pipe buffer.
+func (pr *PipeReader) Cap() int { return len(pr.buff) }
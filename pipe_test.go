@@ -0,0 +1,85 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestBoundedPipe(t *testing.T) {
+	s, r := BoundedPipe(7)
+
+	exp := strings.Repeat("0123456789", 1000)
+
+	go s.Write(String(exp[:3000]), String(exp[3000:]))
+
+	res, err := io.ReadAll(r)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if string(res) != exp {
+		t.Errorf("Unexpected result of %d bytes", len(res))
+		return
+	}
+
+	if r.Cap() != 7 || r.Buffered() != 0 {
+		t.Errorf("Unexpected pipe state: %d of %d", r.Buffered(), r.Cap())
+		return
+	}
+}
+
+func TestBoundedPipeErrors(t *testing.T) {
+	// error from the producer
+	s, r := BoundedPipe(16)
+
+	go s.Write(String("aaa"), func(_ *Writer) (int64, error) { return 0, errors.New("test error") })
+
+	res, err := io.ReadAll(r)
+
+	if err == nil || string(res) != "aaa" {
+		t.Error("Unexpected result:", string(res), err)
+		return
+	}
+
+	// reader closed
+	s, r = BoundedPipe(16)
+
+	r.Close()
+
+	if _, err = s.Write(String("aaa")); !errors.Is(err, io.ErrClosedPipe) {
+		t.Error("Unexpected error:", err)
+		return
+	}
+}
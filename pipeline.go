@@ -0,0 +1,210 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Pipeline constructs a chunk function that runs the given commands (each specified as the command
+// name followed by its arguments) connected like a shell pipeline, with STDOUT of each command fed
+// to STDIN of the next one, and copies STDOUT of the last command to a stream. No shell is involved,
+// so the arguments need no quoting. STDERR of each command is recorded as described for Command
+// function. If any of the commands fails, the error is of type *PipelineError; a command terminated
+// by SIGPIPE because the next command has exited early is not considered failed.
+func Pipeline(cmds ...[]string) Chunk {
+	return CommandOptions{}.Pipeline(cmds...)
+}
+
+// PipelineError is returned from a Pipeline chunk when any of the commands fails.
+type PipelineError struct {
+	Errs []error // errors of the commands (typically *CommandError), nil for succeeded ones
+}
+
+func (e *PipelineError) Error() string {
+	var msgs []string
+
+	for i, err := range e.Errs {
+		if err != nil {
+			msgs = append(msgs, "pipeline stage "+strconv.Itoa(i)+": "+err.Error())
+		}
+	}
+
+	return strings.Join(msgs, "; ")
+}
+
+// Unwrap returns the errors of the failed commands.
+func (e *PipelineError) Unwrap() []error {
+	var errs []error
+
+	for _, err := range e.Errs {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errs
+}
+
+// Pipeline is like the package-level Pipeline function, but with the options applied. The options
+// apply to the last command, except for Stdin which feeds the first command, and ProcessGroup which
+// applies to all of them.
+func (opts CommandOptions) Pipeline(cmds ...[]string) Chunk {
+	return func(w *Writer) (n int64, err error) {
+		if len(cmds) == 0 || len(cmds[0]) == 0 {
+			return 0, errors.New("stout: empty pipeline")
+		}
+
+		last := len(cmds) - 1
+		stages := make([]*exec.Cmd, len(cmds))
+
+		for i, args := range cmds {
+			if len(args) == 0 {
+				return 0, errors.New("stout: empty command in pipeline at position " + strconv.Itoa(i))
+			}
+
+			stages[i] = newCommand(w.Context(), args[0], args[1:])
+		}
+
+		// input
+		if opts.Stdin != nil {
+			var wait func() error
+
+			stages[0].Stdin, wait = feed(w, opts.Stdin)
+
+			defer func() {
+				if e := wait(); e != nil {
+					err = e
+				}
+			}()
+		}
+
+		// start all but the last command
+		errs := make([]error, len(cmds))
+		stderrs := make([]stderrRecorder, last)
+		controls := make([]*processControl, last)
+
+		var input *os.File // read end of the pipe to the next command
+
+		defer func() {
+			if input != nil {
+				input.Close()
+			}
+
+			// wait for the started commands
+			for i, pc := range controls {
+				if pc == nil {
+					break
+				}
+
+				if err != nil {
+					pc.kill()
+				}
+
+				if e := stages[i].Wait(); e != nil && !brokenPipe(e) {
+					errs[i] = commandError(stages[i], stderrs[i], e)
+				}
+
+				pc.release()
+			}
+
+			if err == nil {
+				for _, e := range errs {
+					if e != nil {
+						err = &PipelineError{Errs: errs}
+						break
+					}
+				}
+			}
+		}()
+
+		for i, cmd := range stages[:last] {
+			var output *os.File
+
+			if input != nil {
+				cmd.Stdin = input
+			}
+
+			prev := input
+
+			if input, output, err = os.Pipe(); err != nil {
+				input = prev
+				return
+			}
+
+			stderrs[i] = opts.stderr()
+			cmd.Stdout = output
+			cmd.Stderr = stderrs[i]
+
+			pc := newProcessControl(cmd, opts.ProcessGroup)
+
+			err = cmd.Start()
+
+			// the parent process does not need these
+			output.Close()
+
+			if prev != nil {
+				prev.Close()
+			}
+
+			if err == nil {
+				if err = pc.started(); err != nil {
+					cmd.Process.Kill()
+					cmd.Wait()
+				}
+			}
+
+			if err != nil {
+				pc.release()
+				return
+			}
+
+			controls[i] = pc
+		}
+
+		// run the last command
+		if input != nil {
+			stages[last].Stdin = input
+		}
+
+		if n, err = opts.run(w, stages[last]); err != nil {
+			var ce *CommandError
+
+			if errors.As(err, &ce) {
+				errs[last], err = err, nil
+			}
+		}
+
+		return
+	}
+}
@@ -0,0 +1,112 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"errors"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestPipeline(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires unix tools")
+	}
+
+	var b strings.Builder
+
+	_, err := StringBuilderStream(&b).Write(
+		String("<"),
+		CommandOptions{Stdin: String("bbb\naaa\nccc\n")}.Pipeline(
+			[]string{"sort"},
+			[]string{"tr", "a-z", "A-Z"},
+			[]string{"head", "-n", "2"},
+		),
+		String(">"),
+	)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if exp := "<AAA\nBBB\n>"; b.String() != exp {
+		t.Errorf("Unexpected result: %q instead of %q", b.String(), exp)
+		return
+	}
+
+	// the last command exits early
+	b.Reset()
+
+	_, err = StringBuilderStream(&b).Write(Pipeline([]string{"yes"}, []string{"head", "-n", "1"}))
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if b.String() != "y\n" {
+		t.Errorf("Unexpected result: %q", b.String())
+		return
+	}
+
+	// failing stage
+	b.Reset()
+
+	_, err = StringBuilderStream(&b).Write(Pipeline(
+		[]string{"sh", "-c", "echo aaa; echo failed >&2; exit 3"},
+		[]string{"cat"},
+	))
+
+	var pe *PipelineError
+
+	if !errors.As(err, &pe) || len(pe.Errs) != 2 || pe.Errs[1] != nil {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	var ce *CommandError
+
+	if !errors.As(pe.Errs[0], &ce) || ce.ExitCode != 3 || ce.Stderr != "failed" {
+		t.Errorf("Unexpected error: %v", pe.Errs[0])
+		return
+	}
+
+	if b.String() != "aaa\n" {
+		t.Errorf("Unexpected result: %q", b.String())
+		return
+	}
+
+	// missing command
+	if _, err = StringBuilderStream(&b).Write(Pipeline([]string{"this-command-does-not-exist"}, []string{"cat"})); err == nil {
+		t.Error("Missing error")
+		return
+	}
+}
@@ -0,0 +1,227 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"math"
+	"time"
+)
+
+// WithPercentProgress attaches progress reporting to the given stream, calling the given function
+// with the completion percentage (0 to 100) as the data are written by each Write() call. The percentage
+// is computed against the given total number of bytes, or against the stream size hint (see Stream.SizeHint)
+// if the total is not positive; if neither is available, the function is never called. The function is called
+// at most once per 0.1% of progress, and the percentage never exceeds 100. Writing through the stream
+// bypasses the io.ReaderFrom optimisation of the underlying writer, for the sake of granularity
+// of the progress reports. The function returns the same stream.
+func WithPercentProgress(s Stream, total int64, fn func(pct float64)) Stream {
+	if total <= 0 {
+		total = int64(s.w.sizeHint)
+	}
+
+	if total <= 0 {
+		return withProgress(s, func() func(int64) { return func(int64) {} })
+	}
+
+	return withProgress(s, func() func(int64) {
+		last := -1.0
+
+		return func(n int64) {
+			pct := math.Min(100*float64(n)/float64(total), 100)
+
+			if pct-last >= 0.1 || (pct == 100 && last < 100) {
+				last = pct
+				fn(pct)
+			}
+		}
+	})
+}
+
+// ProgressSnapshot describes the state of a stream write in progress.
+type ProgressSnapshot struct {
+	Bytes   int64         // number of bytes written so far
+	Total   int64         // expected total number of bytes, or 0 if unknown
+	Percent float64       // completion percentage, or -1 if the total is unknown
+	Elapsed time.Duration // time since the first write
+	Rate    float64       // throughput in bytes per second, averaged over the last few seconds
+	ETA     time.Duration // estimated time to completion, or -1 if unknown
+}
+
+// WithProgress attaches progress reporting to the given stream, calling the given function with
+// progress snapshots as the data are written by each Write() call. The total number of bytes is taken
+// from the size hint of the stream (see Stream.SizeHint) if not given. The function is called at most
+// once per 100ms, and also when the total is reached. The throughput is averaged over a sliding window
+// of 5 seconds. Writing through the stream bypasses the io.ReaderFrom optimisation of the underlying
+// writer, for the sake of granularity of the progress reports. The function returns the same stream.
+func WithProgress(s Stream, total int64, fn func(ProgressSnapshot)) Stream {
+	if total <= 0 {
+		total = max(int64(s.w.sizeHint), 0)
+	}
+
+	return withProgress(s, func() func(int64) {
+		t := &progressTracker{
+			total:    total,
+			interval: 100 * time.Millisecond,
+			window:   5 * time.Second,
+			fn:       fn,
+		}
+
+		return t.update
+	})
+}
+
+// throughput estimator
+type progressTracker struct {
+	total            int64
+	interval, window time.Duration
+	fn               func(ProgressSnapshot)
+	start, last      time.Time
+	samples          []progressSample
+}
+
+type progressSample struct {
+	t time.Time
+	n int64
+}
+
+func (t *progressTracker) update(n int64) {
+	now := clockNow()
+
+	if t.start.IsZero() {
+		// the first write happens at the start
+		t.start = now
+		t.samples = append(t.samples, progressSample{now, 0})
+	}
+
+	t.samples = append(t.samples, progressSample{now, n})
+
+	// drop the samples outside the window, keeping at least one for reference
+	i := 0
+
+	for i < len(t.samples)-2 && now.Sub(t.samples[i+1].t) >= t.window {
+		i++
+	}
+
+	t.samples = append(t.samples[:0], t.samples[i:]...)
+
+	// throttle
+	done := t.total > 0 && n >= t.total
+
+	if !done && !t.last.IsZero() && now.Sub(t.last) < t.interval {
+		return
+	}
+
+	t.last = now
+
+	// snapshot
+	snap := ProgressSnapshot{
+		Bytes:   n,
+		Total:   t.total,
+		Percent: -1,
+		Elapsed: now.Sub(t.start),
+		ETA:     -1,
+	}
+
+	if ref := t.samples[0]; now.After(ref.t) {
+		snap.Rate = float64(n-ref.n) / now.Sub(ref.t).Seconds()
+	}
+
+	if t.total > 0 {
+		snap.Percent = math.Min(100*float64(n)/float64(t.total), 100)
+
+		switch {
+		case done:
+			snap.ETA = 0
+		case snap.Rate > 0:
+			snap.ETA = time.Duration(float64(t.total-n) / snap.Rate * float64(time.Second))
+		}
+	}
+
+	t.fn(snap)
+}
+
+// attach to the stream a function that reports the number of bytes written by each Write() call;
+// the chunks are invoked on a counting writer on top of the stream writer
+func withProgress(s Stream, start func() func(int64)) Stream {
+	prev := s.w.wrap
+
+	s.w.wrap = func(chunks []Chunk) []Chunk {
+		if prev != nil {
+			chunks = prev(chunks)
+		}
+
+		pw := &progressWriter{report: start()}
+		res := make([]Chunk, len(chunks))
+
+		for i, chunk := range chunks {
+			res[i] = func(w *Writer) (int64, error) {
+				return pw.run(w, chunk)
+			}
+		}
+
+		return res
+	}
+
+	return s
+}
+
+// io.Writer that reports the number of bytes written
+type progressWriter struct {
+	w      *Writer
+	n      int64
+	report func(int64)
+}
+
+// invoke the chunk on a counting writer that forwards to the given writer, keeping the offset in sync
+func (p *progressWriter) run(w *Writer, chunk Chunk) (n int64, err error) {
+	p.w = w
+
+	cw := WriterStream(p).w.inherit(w)
+
+	cw.offset = w.offset
+	cw.flush = w.Flush
+	cw.seek = w.seek
+	cw.truncate = w.truncate
+	cw.discard = w.discard
+
+	n, err = chunk(cw)
+	w.offset = cw.offset
+	return
+}
+
+func (p *progressWriter) Write(s []byte) (n int, err error) {
+	n, err = p.w.Write(s)
+
+	if n > 0 {
+		p.n += int64(n)
+		p.report(p.n)
+	}
+
+	return
+}
@@ -0,0 +1,199 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithPercentProgress(t *testing.T) {
+	var buff bytes.Buffer
+	var res []float64
+
+	fn := func(pct float64) { res = append(res, pct) }
+
+	_, err := WithPercentProgress(ByteBufferStream(&buff), 100, fn).Write(
+		RepeatN(4, String(strings.Repeat("z", 25))),
+	)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if len(res) != 4 || res[0] != 25 || res[3] != 100 {
+		t.Error("Unexpected progress:", res)
+		return
+	}
+
+	if buff.Len() != 100 {
+		t.Errorf("Unexpected number of bytes: %d instead of 100", buff.Len())
+		return
+	}
+
+	// total from the size hint, with the data via io.Reader
+	res = res[:0]
+
+	_, err = WithPercentProgress(ByteBufferStream(&buff).SizeHint(1000000), 0, fn).Write(
+		Reader(io.LimitReader(strings.NewReader(strings.Repeat("z", 1000000)), 1000000)),
+	)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if len(res) < 2 || res[len(res)-1] != 100 {
+		t.Error("Unexpected progress:", res)
+		return
+	}
+}
+
+func TestWithProgress(t *testing.T) {
+	var buff bytes.Buffer
+	var res []ProgressSnapshot
+
+	fn := func(snap ProgressSnapshot) { res = append(res, snap) }
+
+	slow := func(w *Writer) (int64, error) {
+		time.Sleep(110 * time.Millisecond)
+		return String(strings.Repeat("z", 50))(w)
+	}
+
+	_, err := WithProgress(ByteBufferStream(&buff), 200, fn).Write(slow, slow, String(strings.Repeat("z", 100)))
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if len(res) != 3 {
+		t.Errorf("Unexpected number of snapshots: %d instead of 3", len(res))
+		return
+	}
+
+	if s := res[1]; s.Bytes != 100 || s.Percent != 50 || s.Rate <= 0 || s.ETA <= 0 || s.Elapsed < 100*time.Millisecond {
+		t.Errorf("Unexpected snapshot: %+v", s)
+		return
+	}
+
+	if s := res[2]; s.Bytes != 200 || s.Percent != 100 || s.ETA != 0 {
+		t.Errorf("Unexpected final snapshot: %+v", s)
+		return
+	}
+
+	// unknown total
+	res = res[:0]
+
+	if _, err = WithProgress(ByteBufferStream(&buff), 0, fn).Write(String("aaa")); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if len(res) != 1 || res[0].Percent != -1 || res[0].ETA != -1 || res[0].Bytes != 3 {
+		t.Errorf("Unexpected snapshots: %+v", res)
+		return
+	}
+}
+
+func TestProgressOptions(t *testing.T) {
+	var c closeRecorder
+
+	fail := func(_ *Writer) (int64, error) { return 0, errors.New("test error") }
+	s := WithProgress(NewStream(&c, WithCloseOnFinish(true), WithKeepOpenOnError(true), WithConcurrencyCheck(true)), 0, func(ProgressSnapshot) {})
+
+	if _, err := s.Write(String("aaa"), fail); err == nil {
+		t.Error("Missing error")
+		return
+	}
+
+	if c.closed {
+		t.Error("Stream closed on error")
+		return
+	}
+
+	if _, err := s.Write(String("aaa")); err != nil || !c.closed {
+		t.Error("Unexpected result:", err, c.closed)
+		return
+	}
+
+	// the counter starts afresh with each write
+	var buff bytes.Buffer
+	var res []int64
+
+	s = WithProgress(ByteBufferStream(&buff), 0, func(snap ProgressSnapshot) { res = append(res, snap.Bytes) })
+
+	for i := 0; i < 2; i++ {
+		if _, err := s.Write(String("aaa")); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	if len(res) != 2 || res[0] != 3 || res[1] != 3 {
+		t.Error("Unexpected progress:", res)
+		return
+	}
+
+	// seeking and the byte limit of the underlying stream
+	fd, err := os.Create(filepath.Join(t.TempDir(), "file"))
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	defer fd.Close()
+
+	s = WithPercentProgress(LimitStream(WriterStream(fd), 6), 6, func(float64) {})
+
+	if _, err = s.Write(String("aaa"), At(0, String("b")), String("ccc"), String("d")); !errors.Is(err, ErrLimitExceeded) {
+		t.Error("Unexpected error:", err)
+		return
+	}
+
+	data, err := os.ReadFile(fd.Name())
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if string(data) != "baaccc" {
+		t.Errorf("Unexpected result: %q", data)
+		return
+	}
+}
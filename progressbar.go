@@ -0,0 +1,158 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// ProgressBar renders a single-line progress bar for a stream write, typically to STDERR
+// while the data are written to STDOUT or a file. The zero value is a usable progress bar.
+type ProgressBar struct {
+	Out   io.Writer // where to render the progress bar; defaults to os.Stderr
+	Label string    // optional label displayed before the bar
+	Width int       // width of the bar in characters; defaults to 40
+	Quiet bool      // disables the progress bar completely
+	Force bool      // render the progress bar even if the output is not a terminal
+}
+
+// Stream constructs a stream that writes to the given stream while rendering the progress bar.
+// The total number of bytes is taken from the size hint of the stream if not given, and if neither
+// is available, the bar only shows the number of bytes written and the throughput. Unless forced,
+// the bar is only rendered if the output is a terminal. The line with the bar is terminated
+// when the stream gets closed upon exit from its Write() function.
+func (p ProgressBar) Stream(s Stream, total int64) Stream {
+	out := p.Out
+
+	if out == nil {
+		out = os.Stderr
+	}
+
+	if p.Quiet || (!p.Force && !isTerminal(out)) {
+		return s
+	}
+
+	if p.Width <= 0 {
+		p.Width = 40
+	}
+
+	rendered := false
+
+	ps := WithProgress(s, total, func(snap ProgressSnapshot) {
+		rendered = true
+		io.WriteString(out, p.render(snap))
+	})
+
+	// terminate the line on close
+	closeFn := ps.w.closeFunc()
+
+	ps.w.closeWithError = func(err error) (e error) {
+		if closeFn != nil {
+			e = closeFn(err)
+		}
+
+		if rendered {
+			io.WriteString(out, "\n")
+		}
+
+		return e
+	}
+
+	return ps
+}
+
+// compose the progress bar line
+func (p ProgressBar) render(snap ProgressSnapshot) string {
+	var b strings.Builder
+
+	b.WriteByte('\r')
+
+	if len(p.Label) > 0 {
+		b.WriteString(p.Label)
+		b.WriteByte(' ')
+	}
+
+	if snap.Percent >= 0 {
+		done := int(float64(p.Width) * snap.Percent / 100)
+
+		b.WriteByte('[')
+		b.WriteString(strings.Repeat("=", done))
+
+		if done < p.Width {
+			b.WriteByte('>')
+			b.WriteString(strings.Repeat(" ", p.Width-done-1))
+		}
+
+		fmt.Fprintf(&b, "] %5.1f%% ", snap.Percent)
+	}
+
+	b.WriteString(formatBytes(float64(snap.Bytes)))
+	fmt.Fprintf(&b, " %s/s", formatBytes(snap.Rate))
+
+	if snap.ETA >= 0 {
+		fmt.Fprintf(&b, " ETA %s", snap.ETA.Round(time.Second))
+	}
+
+	// clear till the end of line
+	b.WriteString("\x1b[K")
+	return b.String()
+}
+
+// format byte count using binary prefixes
+func formatBytes(n float64) string {
+	const units = "KMGTPE"
+
+	if n < 1024 {
+		return fmt.Sprintf("%.0f B", n)
+	}
+
+	i := -1
+
+	for n >= 1024 && i < len(units)-1 {
+		n /= 1024
+		i++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", n, units[i])
+}
+
+// check if the writer is a terminal
+func isTerminal(w io.Writer) bool {
+	if f, ok := w.(*os.File); ok {
+		if info, err := f.Stat(); err == nil {
+			return info.Mode()&os.ModeCharDevice != 0
+		}
+	}
+
+	return false
+}
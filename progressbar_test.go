@@ -0,0 +1,94 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestProgressBar(t *testing.T) {
+	var out, bar bytes.Buffer
+
+	pb := ProgressBar{Out: &bar, Label: "copying", Width: 10, Force: true}
+
+	_, err := pb.Stream(ByteBufferStream(&out), 2048).Write(String(strings.Repeat("z", 2048)))
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if out.Len() != 2048 {
+		t.Errorf("Unexpected number of bytes: %d instead of 2048", out.Len())
+		return
+	}
+
+	const exp = "\rcopying [==========] 100.0% 2.0 KiB"
+
+	if s := bar.String(); !strings.HasPrefix(s, exp) || !strings.HasSuffix(s, "ETA 0s\x1b[K\n") {
+		t.Errorf("Unexpected progress bar: %q", s)
+		return
+	}
+
+	// no output when not forced and not a terminal
+	bar.Reset()
+
+	pb.Force = false
+
+	if _, err = pb.Stream(ByteBufferStream(&out), 0).Write(String("aaa")); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if bar.Len() != 0 {
+		t.Errorf("Unexpected output: %q", bar.String())
+		return
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	cases := []struct {
+		n   float64
+		exp string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KiB"},
+		{1536 * 1024, "1.5 MiB"},
+	}
+
+	for _, c := range cases {
+		if s := formatBytes(c.n); s != c.exp {
+			t.Errorf("Unexpected result for %v: %q instead of %q", c.n, s, c.exp)
+			return
+		}
+	}
+}
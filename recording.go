@@ -0,0 +1,153 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"time"
+)
+
+// the frame length field is 32 bits
+var maxFrameSize uint64 = math.MaxUint32
+
+// RecordingStream constructs a stream that writes to the given io.Writer object, and also records
+// all the written data to the given recording writer, for later playback via Replay() function.
+// Each write to the stream becomes one frame in the recording, consisting of a header with
+// the time since the first write in nanoseconds (8 bytes, big-endian), and the data length
+// (4 bytes, big-endian), followed by the data itself; a write of 4GiB or more is recorded as several
+// frames with the same time. A failure to write the recording fails the stream, though the data have
+// already been written to the io.Writer by then, so the output is ahead of the recording.
+func RecordingStream(w io.Writer, rec io.Writer) Stream {
+	return WriterStream(&recordingWriter{w: w, rec: rec})
+}
+
+type recordingWriter struct {
+	w, rec io.Writer
+	start  time.Time
+	hdr    [12]byte
+}
+
+func (r *recordingWriter) Write(s []byte) (n int, err error) {
+	if n, err = r.w.Write(s); n > 0 {
+		now := clockNow()
+
+		if r.start.IsZero() {
+			r.start = now
+		}
+
+		binary.BigEndian.PutUint64(r.hdr[:8], uint64(now.Sub(r.start)))
+
+		for data := s[:n]; len(data) > 0; {
+			k := len(data)
+
+			if uint64(k) > maxFrameSize {
+				k = int(maxFrameSize)
+			}
+
+			binary.BigEndian.PutUint32(r.hdr[8:], uint32(k))
+
+			if _, e := r.rec.Write(r.hdr[:]); e != nil {
+				return n, e
+			}
+
+			if _, e := r.rec.Write(data[:k]); e != nil {
+				return n, e
+			}
+
+			data = data[k:]
+		}
+	}
+
+	return
+}
+
+// Replay constructs a chunk function that plays back the recording made by RecordingStream,
+// reproducing the original timing of the writes. The stream is flushed after each frame.
+// The playback stops with an error when the context of the stream Write (see WriteContext) is cancelled.
+func Replay(rec io.Reader) Chunk {
+	return func(w *Writer) (n int64, err error) {
+		var hdr [12]byte
+
+		// frame data is copied via a buffer of limited size, whatever the frame length
+		buff := make([]byte, 32*1024)
+		ctx := w.Context()
+		timer := time.NewTimer(0)
+
+		defer timer.Stop()
+
+		start := clockNow()
+
+		for {
+			if _, err = io.ReadFull(rec, hdr[:]); err != nil {
+				if err == io.EOF {
+					err = nil
+				}
+
+				return
+			}
+
+			timer.Reset(start.Add(time.Duration(binary.BigEndian.Uint64(hdr[:8]))).Sub(clockNow()))
+
+			select {
+			case <-ctx.Done():
+				return n, ctx.Err()
+			case <-timer.C:
+			}
+
+			for size := int(binary.BigEndian.Uint32(hdr[8:])); size > 0; {
+				k := min(size, len(buff))
+
+				if _, err = io.ReadFull(rec, buff[:k]); err != nil {
+					if err == io.EOF {
+						err = io.ErrUnexpectedEOF
+					}
+
+					return
+				}
+
+				var m int
+
+				m, err = w.Write(buff[:k])
+				n += int64(m)
+
+				if err != nil {
+					return
+				}
+
+				size -= k
+			}
+
+			if err = w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,113 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestRecording(t *testing.T) {
+	var out, rec bytes.Buffer
+
+	pause := func(_ *Writer) (int64, error) {
+		time.Sleep(50 * time.Millisecond)
+		return 0, nil
+	}
+
+	_, err := RecordingStream(&out, &rec).Write(String("aaa"), pause, String("bbb"))
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if out.String() != "aaabbb" {
+		t.Errorf("Unexpected output: %q instead of %q", out.String(), "aaabbb")
+		return
+	}
+
+	if rec.Len() != 2*12+6 {
+		t.Errorf("Unexpected recording size: %d", rec.Len())
+		return
+	}
+
+	// replay
+	var res bytes.Buffer
+
+	start := time.Now()
+
+	if _, err = ByteBufferStream(&res).Write(Replay(bytes.NewReader(rec.Bytes()))); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if d := time.Since(start); d < 50*time.Millisecond {
+		t.Error("Replay was too fast:", d)
+		return
+	}
+
+	if res.String() != "aaabbb" {
+		t.Errorf("Unexpected result: %q instead of %q", res.String(), "aaabbb")
+		return
+	}
+
+	// truncated recording
+	res.Reset()
+
+	_, err = ByteBufferStream(&res).Write(Replay(bytes.NewReader(rec.Bytes()[:rec.Len()-1])))
+
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Error("Unexpected error:", err)
+		return
+	}
+
+	// cancelled playback
+	var slow bytes.Buffer
+
+	binary.Write(&slow, binary.BigEndian, uint64(time.Hour))
+	binary.Write(&slow, binary.BigEndian, uint32(1))
+	slow.WriteByte('x')
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+
+	defer cancel()
+
+	res.Reset()
+
+	if _, err = ByteBufferStream(&res).WriteContext(ctx, Replay(&slow)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("Unexpected error:", err)
+		return
+	}
+}
@@ -0,0 +1,81 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import "io"
+
+// RecordWriter is the interface of an external record encoder, like Parquet or Arrow writer,
+// typically adapted by a thin wrapper. The encoder writes its output to the io.Writer it was
+// constructed with, and the Close method must flush any internal state (footers, indices, etc.)
+// without closing that io.Writer.
+type RecordWriter interface {
+	WriteRecord(record interface{}) error
+	Close() error
+}
+
+// Records constructs a chunk function that delegates writing to an external record encoder.
+// The encoder is created by the given open function when the chunk is invoked, then the supplied
+// next function is called over and over again, with each record it returns passed on to the encoder,
+// until the function returns a non-nil error. The next function is expected to return io.EOF to stop
+// the iteration without an error. The encoder is always closed upon completion. Combined with
+// AtomicWriteFile, this leaves the file management to this package, and the encoding to the external
+// library.
+func Records(open func(io.Writer) (RecordWriter, error), next func() (interface{}, error)) Chunk {
+	return func(w *Writer) (n int64, err error) {
+		cw := countingWriter{w: w}
+
+		var enc RecordWriter
+
+		if enc, err = open(&cw); err != nil {
+			return
+		}
+
+		defer func() {
+			if e := enc.Close(); e != nil && err == nil {
+				err = e
+			}
+
+			n = cw.n
+		}()
+
+		var rec interface{}
+
+		for rec, err = next(); err == nil; rec, err = next() {
+			if err = enc.WriteRecord(rec); err != nil {
+				return
+			}
+		}
+
+		if err == io.EOF {
+			err = nil
+		}
+
+		return
+	}
+}
@@ -0,0 +1,150 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"encoding/csv"
+	"fmt"
+	"time"
+)
+
+// Cursor is an iterator over a result set. The interface is satisfied by *sql.Rows type,
+// so the package itself does not depend on database/sql.
+type Cursor interface {
+	Next() bool
+	Scan(dest ...interface{}) error
+	Columns() ([]string, error)
+	Err() error
+	Close() error
+}
+
+// Rows constructs a chunk function that iterates over the given result set, and for each row
+// writes the chunk returned from the supplied formatter function. The formatter receives the column
+// values of the current row, as scanned into interface{} destinations; the slice is reused between
+// the rows, so it must not be retained. The result set is always closed upon completion.
+func Rows(rows Cursor, perRow func([]interface{}) Chunk) Chunk {
+	return func(w *Writer) (n int64, err error) {
+		defer func() {
+			if e := rows.Close(); e != nil && err == nil {
+				err = e
+			}
+		}()
+
+		var cols []string
+
+		if cols, err = rows.Columns(); err != nil {
+			return
+		}
+
+		values := make([]interface{}, len(cols))
+		dest := make([]interface{}, len(cols))
+
+		for i := range values {
+			dest[i] = &values[i]
+		}
+
+		for rows.Next() {
+			if err = rows.Scan(dest...); err != nil {
+				return
+			}
+
+			var m int64
+
+			if m, err = perRow(values)(w); err != nil {
+				return
+			}
+
+			n += m
+		}
+
+		err = rows.Err()
+		return
+	}
+}
+
+// CSVFromRows constructs a chunk function that writes the given result set in CSV format,
+// optionally preceded by a header line made of the column names. NULL values are written
+// as empty strings, byte slices as strings, and time.Time values in RFC 3339 format with
+// fractional seconds (time.RFC3339Nano). Quoting is done as per encoding/csv package.
+// The result set is always closed upon completion.
+func CSVFromRows(rows Cursor, includeHeader bool) Chunk {
+	return func(w *Writer) (int64, error) {
+		cw := countingWriter{w: w}
+		out := csv.NewWriter(&cw)
+
+		if includeHeader {
+			cols, err := rows.Columns()
+
+			if err == nil {
+				err = out.Write(cols)
+			}
+
+			if err != nil {
+				rows.Close()
+				return 0, err
+			}
+		}
+
+		var record []string
+
+		_, err := Rows(rows, func(row []interface{}) Chunk {
+			return func(_ *Writer) (int64, error) {
+				record = record[:0]
+
+				for _, v := range row {
+					record = append(record, csvField(v))
+				}
+
+				return 0, out.Write(record)
+			}
+		})(w)
+
+		if err == nil {
+			out.Flush()
+			err = out.Error()
+		}
+
+		return cw.n, err
+	}
+}
+
+func csvField(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return x
+	case []byte:
+		return string(x)
+	case time.Time:
+		return x.Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprint(x)
+	}
+}
@@ -0,0 +1,155 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestRows(t *testing.T) {
+	rows := &testCursor{
+		cols: []string{"id", "name"},
+		data: [][]interface{}{{1, "one"}, {2, "two"}, {3, nil}},
+	}
+
+	var b strings.Builder
+
+	_, err := StringBuilderStream(&b).Write(Rows(rows, func(row []interface{}) Chunk {
+		return String(fmt.Sprintf("%v:%v\n", row[0], row[1]))
+	}))
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	const exp = "1:one\n2:two\n3:<nil>\n"
+
+	if s := b.String(); s != exp {
+		t.Errorf("Unexpected result: %q instead of %q", s, exp)
+		return
+	}
+
+	if !rows.closed {
+		t.Error("Rows not closed")
+		return
+	}
+}
+
+func TestRowsError(t *testing.T) {
+	rows := &testCursor{
+		cols: []string{"id"},
+		data: [][]interface{}{{1}, {2}},
+	}
+
+	var b strings.Builder
+
+	_, err := StringBuilderStream(&b).Write(Rows(rows, func(row []interface{}) Chunk {
+		return func(_ *Writer) (int64, error) { return 0, errors.New("test error") }
+	}))
+
+	if err == nil {
+		t.Error("Missing error")
+		return
+	}
+
+	if !rows.closed {
+		t.Error("Rows not closed")
+		return
+	}
+}
+
+func TestCSVFromRows(t *testing.T) {
+	rows := &testCursor{
+		cols: []string{"id", "name"},
+		data: [][]interface{}{{1, []byte("one")}, {2, "two, three"}, {3, nil}},
+	}
+
+	var b strings.Builder
+
+	n, err := StringBuilderStream(&b).Write(CSVFromRows(rows, true))
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	const exp = "id,name\n1,one\n2,\"two, three\"\n3,\n"
+
+	if s := b.String(); s != exp {
+		t.Errorf("Unexpected result: %q instead of %q", s, exp)
+		return
+	}
+
+	if n != int64(len(exp)) {
+		t.Errorf("Unexpected number of bytes written: %d instead of %d", n, len(exp))
+		return
+	}
+
+	if !rows.closed {
+		t.Error("Rows not closed")
+		return
+	}
+}
+
+// in-memory cursor
+type testCursor struct {
+	cols   []string
+	data   [][]interface{}
+	row    int
+	closed bool
+}
+
+func (c *testCursor) Next() bool {
+	if c.row < len(c.data) {
+		c.row++
+		return true
+	}
+
+	return false
+}
+
+func (c *testCursor) Scan(dest ...interface{}) error {
+	if len(dest) != len(c.cols) {
+		return errors.New("invalid number of scan destinations")
+	}
+
+	for i, v := range c.data[c.row-1] {
+		*dest[i].(*interface{}) = v
+	}
+
+	return nil
+}
+
+func (c *testCursor) Columns() ([]string, error) { return c.cols, nil }
+func (c *testCursor) Err() error                 { return nil }
+func (c *testCursor) Close() error               { c.closed = true; return nil }
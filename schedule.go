@@ -0,0 +1,92 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"sort"
+	"time"
+)
+
+// PriorityChunk is a chunk function with scheduling attributes, for use with Prioritized() function.
+type PriorityChunk struct {
+	Chunk     Chunk         // the chunk function to write
+	Priority  int           // higher priority chunks go first within a group of unordered chunks
+	Unordered bool          // the chunk may be reordered with its adjacent unordered chunks
+	Optional  bool          // the chunk may be skipped if its deadline has passed
+	Deadline  time.Duration // soft deadline, relative to the start of writing; zero means no deadline
+}
+
+// Prioritized constructs a chunk function that writes the given chunks, reordering each run of
+// adjacent unordered chunks by their priority (stable, highest first), while the chunks not marked
+// as unordered keep their positions. An optional chunk with a deadline is skipped if the deadline
+// has passed by the time the chunk is about to be written. The deadline is soft: a chunk that
+// has already started is never interrupted.
+func Prioritized(chunks ...PriorityChunk) Chunk {
+	list := append([]PriorityChunk(nil), chunks...)
+
+	for i := 0; i < len(list); {
+		if !list[i].Unordered {
+			i++
+			continue
+		}
+
+		j := i + 1
+
+		for j < len(list) && list[j].Unordered {
+			j++
+		}
+
+		group := list[i:j]
+
+		sort.SliceStable(group, func(a, b int) bool { return group[a].Priority > group[b].Priority })
+
+		i = j
+	}
+
+	return func(w *Writer) (n int64, err error) {
+		start := clockNow()
+
+		for _, c := range list {
+			if c.Optional && c.Deadline > 0 && clockSince(start) > c.Deadline {
+				continue
+			}
+
+			var m int64
+
+			m, err = c.Chunk(w)
+			n += m
+
+			if err != nil {
+				break
+			}
+		}
+
+		return
+	}
+}
@@ -0,0 +1,85 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestPrioritized(t *testing.T) {
+	var buff bytes.Buffer
+
+	_, err := ByteBufferStream(&buff).Write(Prioritized(
+		PriorityChunk{Chunk: String("<")},
+		PriorityChunk{Chunk: String("a"), Unordered: true, Priority: 1},
+		PriorityChunk{Chunk: String("b"), Unordered: true, Priority: 3},
+		PriorityChunk{Chunk: String("c"), Unordered: true, Priority: 2},
+		PriorityChunk{Chunk: String("d"), Unordered: true, Priority: 3},
+		PriorityChunk{Chunk: String(">")},
+		PriorityChunk{Chunk: String("e"), Unordered: true},
+	))
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if res := buff.String(); res != "<bdca>e" {
+		t.Errorf("Unexpected result: %q instead of %q", res, "<bdca>e")
+		return
+	}
+}
+
+func TestPrioritizedDeadline(t *testing.T) {
+	var buff bytes.Buffer
+
+	slow := func(w *Writer) (int64, error) {
+		time.Sleep(20 * time.Millisecond)
+		return String("slow")(w)
+	}
+
+	_, err := ByteBufferStream(&buff).Write(Prioritized(
+		PriorityChunk{Chunk: slow},
+		PriorityChunk{Chunk: String(" skipped"), Optional: true, Deadline: 10 * time.Millisecond},
+		PriorityChunk{Chunk: String(" required"), Deadline: 10 * time.Millisecond},
+		PriorityChunk{Chunk: String(" in time"), Optional: true, Deadline: time.Minute},
+	))
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if exp := "slow required in time"; buff.String() != exp {
+		t.Errorf("Unexpected result: %q instead of %q", buff.String(), exp)
+		return
+	}
+}
@@ -0,0 +1,111 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"errors"
+)
+
+// Optional constructs a chunk function that renders the given chunk into a memory buffer
+// (taken from the package buffer pool, see BufferPool), and then writes the buffer to the stream
+// if the chunk succeeds, or the placeholder chunk otherwise, so a failing section does not fail
+// the whole stream. Errors from the stream itself are still reported as usual.
+func Optional(chunk, placeholder Chunk) Chunk {
+	return OptionalWith(chunk, func(error) Chunk { return placeholder })
+}
+
+// OptionalWith is like Optional, but the placeholder chunk is constructed from the chunk's error,
+// allowing for messages like "section unavailable: <error>".
+func OptionalWith(chunk Chunk, placeholder func(error) Chunk) Chunk {
+	return func(w *Writer) (int64, error) {
+		buff := getBuffer(0)
+
+		defer putBuffer(buff)
+
+		if _, err := chunk(ByteBufferStream(buff).w.inherit(w)); err != nil {
+			return placeholder(err)(w)
+		}
+
+		n, err := w.Write(buff.Bytes())
+		return int64(n), err
+	}
+}
+
+// Budget constructs a chunk function that writes the output of the given chunk, but stops
+// the chunk once the specified number of bytes has been written, and then appends the onTruncate
+// chunk (e.g., a truncation marker), which may be nil. The onTruncate chunk is only written if
+// the output of the chunk has actually been truncated. A negative budget is treated as zero.
+func Budget(maxBytes int64, chunk, onTruncate Chunk) Chunk {
+	maxBytes = max(maxBytes, 0)
+
+	if onTruncate == nil {
+		onTruncate = nopChunk
+	}
+
+	return func(w *Writer) (n int64, err error) {
+		bw := budgetWriter{w: w, left: maxBytes}
+
+		_, err = chunk(WriterStream(&bw).w.inherit(w))
+		n = maxBytes - bw.left
+
+		if bw.truncated && (err == nil || errors.Is(err, errStop)) {
+			var m int64
+
+			m, err = onTruncate(w)
+			n += m
+		}
+
+		return
+	}
+}
+
+// io.Writer that stops writing when the budget is exhausted
+type budgetWriter struct {
+	w         *Writer
+	left      int64
+	truncated bool
+}
+
+func (bw *budgetWriter) Write(s []byte) (n int, err error) {
+	if int64(len(s)) <= bw.left {
+		n, err = bw.w.Write(s)
+		bw.left -= int64(n)
+		return
+	}
+
+	n, err = bw.w.Write(s[:bw.left])
+	bw.left -= int64(n)
+
+	if err == nil {
+		bw.truncated = true
+		err = errStop
+	}
+
+	return
+}
@@ -0,0 +1,107 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestOptional(t *testing.T) {
+	var buff bytes.Buffer
+
+	fail := func(w *Writer) (int64, error) {
+		w.WriteString("partial")
+		return 0, errors.New("test error")
+	}
+
+	_, err := ByteBufferStream(&buff).Write(
+		Optional(String("aaa"), String("n/a")),
+		String(", "),
+		Optional(fail, String("n/a")),
+		String(", "),
+		OptionalWith(fail, func(err error) Chunk { return String("section unavailable: " + err.Error()) }),
+	)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if exp := "aaa, n/a, section unavailable: test error"; buff.String() != exp {
+		t.Errorf("Unexpected result: %q instead of %q", buff.String(), exp)
+		return
+	}
+
+	// sink errors are not masked
+	w := limitWriter{limit: 2}
+
+	if _, err = WriterStream(&w).Write(Optional(String("aaa"), String("n/a"))); err == nil {
+		t.Error("Missing error")
+		return
+	}
+}
+
+func TestBudget(t *testing.T) {
+	var buff bytes.Buffer
+
+	_, err := ByteBufferStream(&buff).Write(
+		Budget(5, String("0123456789"), String("...")),
+		String("|"),
+		Budget(5, String("01234"), String("...")),
+		String("|"),
+		Budget(5, RepeatN(10, String("ab")), nil),
+		String("|"),
+		Budget(100, Reader(strings.NewReader(strings.Repeat("x", 200))), String("[truncated]")),
+		String("|"),
+		Budget(-1, String("abc"), String("...")),
+	)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	exp := "01234...|01234|ababa|" + strings.Repeat("x", 100) + "[truncated]|..."
+
+	if buff.String() != exp {
+		t.Errorf("Unexpected result: %q instead of %q", buff.String(), exp)
+		return
+	}
+
+	// error from the chunk
+	fail := func(_ *Writer) (int64, error) { return 0, errors.New("test error") }
+
+	if _, err = ByteBufferStream(&buff).Write(Budget(5, fail, String("..."))); err == nil {
+		t.Error("Missing error")
+		return
+	}
+}
@@ -0,0 +1,168 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+)
+
+// ErrNotSeekable is returned from chunks that require a seekable stream, when the stream
+// is not seekable.
+var ErrNotSeekable = errors.New("stream is not seekable")
+
+// SeekerStream constructs a stream from the given io.WriteSeeker object, with bufio.Writer
+// buffer on top of it. The stream supports positioned writes via At chunk.
+func SeekerStream(w io.WriteSeeker) Stream {
+	return WriterBufferedStream(w)
+}
+
+// At constructs a chunk function that writes the given chunk at the specified absolute offset
+// in a seekable stream, and then restores the current position. This allows for "backpatching"
+// of data written earlier, like sizes or checksums in a header, where a placeholder is written first,
+// and then overwritten at a later stage. The returned number of bytes is that of the given chunk,
+// though the stream offset (and the stream size) is not changed unless the chunk writes past the
+// current position. The chunk fails with ErrNotSeekable if the stream is not seekable.
+func At(offset int64, chunk Chunk) Chunk {
+	return func(w *Writer) (n int64, err error) {
+		if w.seek == nil {
+			return 0, ErrNotSeekable
+		}
+
+		// current position
+		var pos int64
+
+		if pos, err = w.seek(0, io.SeekCurrent); err != nil {
+			w.sinkErr = err
+			return
+		}
+
+		// positioned write
+		if _, err = w.seek(offset, io.SeekStart); err != nil {
+			w.sinkErr = err
+			return
+		}
+
+		saved := w.offset
+
+		if n, err = chunk(w); err != nil {
+			return
+		}
+
+		// restore the position, or move to the end of the written data if it is further
+		end := max64(pos, offset+n)
+
+		if _, err = w.seek(end, io.SeekStart); err != nil {
+			w.sinkErr = err
+			return
+		}
+
+		w.offset = saved + end - pos
+		return
+	}
+}
+
+func max64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+
+	return b
+}
+
+// WithTrailer constructs a chunk function that writes a header followed by the given body,
+// where the header depends on the size and SHA-256 digest of the body. The header function
+// is first called with zero size and all-zero digest to produce a placeholder, then the body
+// is written, and finally the header is called again with the actual values, and its output
+// overwrites the placeholder. The header must always be of the same size. The chunk requires
+// a seekable stream, and fails with ErrNotSeekable otherwise.
+func WithTrailer(header func(totalSize int64, digest []byte) Chunk, body Chunk) Chunk {
+	return func(w *Writer) (n int64, err error) {
+		if w.seek == nil {
+			return 0, ErrNotSeekable
+		}
+
+		// header position
+		var pos int64
+
+		if pos, err = w.seek(0, io.SeekCurrent); err != nil {
+			w.sinkErr = err
+			return
+		}
+
+		// placeholder
+		if n, err = header(0, make([]byte, sha256.Size))(w); err != nil {
+			return
+		}
+
+		// body
+		h := sha256.New()
+		tee := WriterStream(&teeWriter{w, h}).w.inherit(w)
+
+		var m int64
+
+		if m, err = body(tee); err != nil {
+			return
+		}
+
+		// render the final header, and check its size before patching the placeholder
+		var hdr bytes.Buffer
+
+		if _, err = header(m, h.Sum(nil))(ByteBufferStream(&hdr).w.inherit(w)); err != nil {
+			return
+		}
+
+		if int64(hdr.Len()) != n {
+			return n + m, fmt.Errorf("header size changed from %d to %d bytes", n, hdr.Len())
+		}
+
+		if _, err = At(pos, ByteSlice(hdr.Bytes()))(w); err != nil {
+			return
+		}
+
+		n += m
+		return
+	}
+}
+
+// io.Writer that also writes to a hash
+type teeWriter struct {
+	w io.Writer
+	h hash.Hash
+}
+
+func (t *teeWriter) Write(s []byte) (n int, err error) {
+	n, err = t.w.Write(s)
+	t.h.Write(s[:n])
+	return
+}
@@ -0,0 +1,165 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAt(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "file")
+	fd, err := os.Create(name)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	// size placeholder, then the body, then the size
+	var size [4]byte
+
+	const body = "Hello, world!"
+
+	_, err = SeekerStream(fd).Write(
+		ByteSlice(size[:]),
+		String(body),
+		func(w *Writer) (int64, error) {
+			binary.BigEndian.PutUint32(size[:], uint32(w.Offset()-4))
+			return At(0, ByteSlice(size[:]))(w)
+		},
+		String("!"),
+	)
+
+	if e := fd.Close(); e != nil && err == nil {
+		err = e
+	}
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	res, err := os.ReadFile(name)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if exp := "\x00\x00\x00\x0d" + body + "!"; string(res) != exp {
+		t.Errorf("Unexpected result: %q instead of %q", res, exp)
+		return
+	}
+
+	// not seekable
+	var b strings.Builder
+
+	if _, err = StringBuilderStream(&b).Write(At(0, String("aaa"))); !errors.Is(err, ErrNotSeekable) {
+		t.Error("Unexpected error:", err)
+		return
+	}
+}
+
+func TestWithTrailer(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "file")
+
+	const body = "Hello, world!"
+
+	header := func(size int64, digest []byte) Chunk {
+		var b [4]byte
+
+		binary.BigEndian.PutUint32(b[:], uint32(size))
+
+		return All(ByteSlice(b[:]), ByteSlice(digest))
+	}
+
+	n, err := WriteFile(name, 0644, String(">"), WithTrailer(header, String(body)), String("<"))
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	res, err := os.ReadFile(name)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if n != int64(len(res)) {
+		t.Errorf("Unexpected number of bytes written: %d instead of %d", n, len(res))
+		return
+	}
+
+	digest := sha256.Sum256([]byte(body))
+	exp := ">\x00\x00\x00\x0d" + string(digest[:]) + body + "<"
+
+	if string(res) != exp {
+		t.Errorf("Unexpected result: %q instead of %q", res, exp)
+		return
+	}
+
+	// header of a different size: the placeholder is left untouched
+	varying := func(size int64, _ []byte) Chunk {
+		return String(strings.Repeat("#", int(size/4)+1))
+	}
+
+	file, err := os.Create(name)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	_, err = WriterStream(file).Write(WithTrailer(varying, String(body)))
+
+	file.Close()
+
+	if err == nil {
+		t.Error("Missing error")
+		return
+	}
+
+	if res, err = os.ReadFile(name); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if string(res) != "#"+body {
+		t.Errorf("Unexpected result: %q", res)
+		return
+	}
+}
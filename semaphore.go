@@ -0,0 +1,118 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"container/list"
+	"context"
+	"sync"
+)
+
+// weighted semaphore, granting the requests in FIFO order
+type semaphore struct {
+	size    int64
+	cur     int64
+	waiters list.List // of *semaphoreWaiter
+	lock    sync.Mutex
+}
+
+type semaphoreWaiter struct {
+	n     int64
+	ready chan struct{}
+}
+
+func newSemaphore(size int64) *semaphore {
+	return &semaphore{size: size}
+}
+
+// acquire the given weight, blocking until it is available or the context is done;
+// weights above the semaphore size are capped at the size
+func (s *semaphore) acquire(ctx context.Context, n int64) error {
+	n = s.weight(n)
+
+	s.lock.Lock()
+
+	if s.size-s.cur >= n && s.waiters.Len() == 0 {
+		s.cur += n
+		s.lock.Unlock()
+		return nil
+	}
+
+	w := &semaphoreWaiter{n: n, ready: make(chan struct{})}
+	elem := s.waiters.PushBack(w)
+
+	s.lock.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+
+	case <-ctx.Done():
+		s.lock.Lock()
+
+		select {
+		case <-w.ready:
+			// acquired concurrently with the cancellation
+			s.cur -= n
+		default:
+			s.waiters.Remove(elem)
+		}
+
+		s.notify()
+		s.lock.Unlock()
+		return ctx.Err()
+	}
+}
+
+// release the given weight
+func (s *semaphore) release(n int64) {
+	s.lock.Lock()
+	s.cur -= s.weight(n)
+	s.notify()
+	s.lock.Unlock()
+}
+
+// wake up the waiters that fit; the lock must be held
+func (s *semaphore) notify() {
+	for elem := s.waiters.Front(); elem != nil; elem = s.waiters.Front() {
+		w := elem.Value.(*semaphoreWaiter)
+
+		if s.size-s.cur < w.n {
+			break
+		}
+
+		s.cur += w.n
+		s.waiters.Remove(elem)
+		close(w.ready)
+	}
+}
+
+func (s *semaphore) weight(n int64) int64 {
+	return max64(min64(n, s.size), 1)
+}
@@ -0,0 +1,96 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import "io"
+
+// Zeros constructs a chunk function that writes the given number of zero bytes to a stream.
+func Zeros(n int64) Chunk {
+	if n <= 0 {
+		return nopChunk
+	}
+
+	return func(w *Writer) (written int64, err error) {
+		for written < n {
+			var m int
+
+			m, err = w.Write(zeroBlock[:min64(n-written, int64(len(zeroBlock)))])
+			written += int64(m)
+
+			if err != nil {
+				break
+			}
+		}
+
+		return
+	}
+}
+
+var zeroBlock [32 * 1024]byte
+
+// Hole constructs a chunk function that skips the given number of bytes, creating a "hole" in
+// the output. On a seekable stream (like the one writing to a disk file) this is done by seeking forward,
+// which on most file systems results in a sparse file. On other streams the function writes zero bytes
+// instead, like Zeros. The function must not be used with files opened in append mode.
+func Hole(n int64) Chunk {
+	if n <= 0 {
+		return nopChunk
+	}
+
+	return func(w *Writer) (int64, error) {
+		if w.seek == nil {
+			return Zeros(n)(w)
+		}
+
+		// seek to the last byte of the hole, and then write a zero byte there to make sure
+		// the file is extended even if the hole is at the very end
+		if n > 1 {
+			if _, err := w.seek(n-1, io.SeekCurrent); err != nil {
+				w.sinkErr = err
+				return 0, err
+			}
+
+			w.offset += n - 1
+		}
+
+		if err := w.WriteByte(0); err != nil {
+			return n - 1, err
+		}
+
+		return n, nil
+	}
+}
+
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+
+	return b
+}
@@ -0,0 +1,96 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestZeros(t *testing.T) {
+	var b bytes.Buffer
+
+	n, err := ByteBufferStream(&b).Write(Byte('a'), Zeros(100000), Byte('b'))
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if n != 100002 || b.Len() != 100002 {
+		t.Errorf("Unexpected number of bytes written: %d", n)
+		return
+	}
+
+	if s := b.Bytes(); s[0] != 'a' || s[100001] != 'b' || bytes.Count(s, []byte{0}) != 100000 {
+		t.Error("Unexpected result")
+		return
+	}
+}
+
+func TestHole(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "sparse")
+
+	for _, hole := range []int64{1, 2, 10, 1 << 20} {
+		for _, tail := range []Chunk{nopChunk, String("bbb")} {
+			var exp bytes.Buffer
+
+			if _, err := ByteBufferStream(&exp).Write(String("aaa"), Hole(hole), tail); err != nil {
+				t.Error(err)
+				return
+			}
+
+			n, err := WriteFile(name, 0644, String("aaa"), Hole(hole), tail)
+
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			if n != int64(exp.Len()) {
+				t.Errorf("Unexpected number of bytes written: %d instead of %d", n, exp.Len())
+				return
+			}
+
+			res, err := os.ReadFile(name)
+
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			if !bytes.Equal(res, exp.Bytes()) {
+				t.Errorf("Unexpected file content (hole %d, size %d)", hole, len(res))
+				return
+			}
+		}
+	}
+}
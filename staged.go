@@ -0,0 +1,144 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"bytes"
+	"os"
+)
+
+// Staged constructs a stream that accumulates all the data written to it, and forwards them
+// to the given stream only when all the chunks have been written successfully; if any chunk fails,
+// nothing is forwarded. This is useful for sinks like sockets or HTTP responses, where partial
+// output on error is worse than no output. The first 4Mb of data are kept in memory,
+// the rest is spooled to a temporary file. The target stream is closed in either case. Each Write()
+// call on the returned stream is staged separately.
+func Staged(s Stream) Stream {
+	st := &stagedWriter{limit: 4 << 20}
+	ss := WriterStream(st)
+
+	ss.w.closeWithError = func(err error) error {
+		defer st.release()
+
+		if err == nil {
+			err = st.err
+		}
+
+		if err != nil {
+			if closeFn := s.w.closeFunc(); closeFn != nil {
+				return closeFn(err)
+			}
+
+			return nil
+		}
+
+		_, err = s.Write(st.contents)
+		return err
+	}
+
+	return ss
+}
+
+// io.Writer that accumulates data in memory, and then in a temporary file
+type stagedWriter struct {
+	buff  *bytes.Buffer
+	limit int
+	file  FileHandle
+	err   error
+}
+
+func (st *stagedWriter) Write(s []byte) (n int, err error) {
+	if st.buff == nil {
+		st.buff = getBuffer(0)
+	}
+
+	if st.file == nil && st.buff.Len()+len(s) > st.limit {
+		// spool to a temporary file
+		if st.file, err = currentFS().CreateTemp("", "stout-staged-*"); err != nil {
+			st.err = err
+			return
+		}
+
+		if _, err = st.file.Write(st.buff.Bytes()); err != nil {
+			st.err = err
+			return
+		}
+
+		st.buff.Reset()
+	}
+
+	if st.file != nil {
+		n, err = st.file.Write(s)
+	} else {
+		n, err = st.buff.Write(s)
+	}
+
+	if err != nil {
+		st.err = err
+	}
+
+	return
+}
+
+// chunk function that writes the accumulated data
+func (st *stagedWriter) contents(w *Writer) (n int64, err error) {
+	if st.buff == nil {
+		return
+	}
+
+	if st.file == nil {
+		var m int
+
+		m, err = w.Write(st.buff.Bytes())
+		return int64(m), err
+	}
+
+	// read the data back via a separate handle
+	var file FileHandle
+
+	if file, err = currentFS().OpenFile(st.file.Name(), os.O_RDONLY, 0); err != nil {
+		return
+	}
+
+	return w.readFromAndClose(file)
+}
+
+// release resources, making the writer ready for the next stream Write() call
+func (st *stagedWriter) release() {
+	if st.buff != nil {
+		putBuffer(st.buff)
+	}
+
+	if st.file != nil {
+		st.file.Close()
+		currentFS().Remove(st.file.Name())
+	}
+
+	st.buff, st.file, st.err = nil, nil, nil
+}
@@ -0,0 +1,109 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestStaged(t *testing.T) {
+	var buff bytes.Buffer
+
+	// success
+	n, err := Staged(ByteBufferStream(&buff)).Write(String("aaa"), String("bbb"))
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if n != 6 || buff.String() != "aaabbb" {
+		t.Errorf("Unexpected result: %q (%d bytes) instead of %q", buff.String(), n, "aaabbb")
+		return
+	}
+
+	// failure
+	buff.Reset()
+
+	fail := func(_ *Writer) (int64, error) { return 0, errors.New("test error") }
+
+	if _, err = Staged(ByteBufferStream(&buff)).Write(String("aaa"), fail); err == nil {
+		t.Error("Missing error")
+		return
+	}
+
+	if buff.Len() != 0 {
+		t.Errorf("Unexpected output: %q", buff.String())
+		return
+	}
+
+	// reuse
+	s := Staged(ByteBufferStream(&buff))
+
+	for _, str := range []string{"xxx", "yyy"} {
+		buff.Reset()
+
+		if _, err = s.Write(String(str)); err != nil {
+			t.Error(err)
+			return
+		}
+
+		if buff.String() != str {
+			t.Errorf("Unexpected result: %q instead of %q", buff.String(), str)
+			return
+		}
+	}
+}
+
+func TestStagedSpooled(t *testing.T) {
+	var buff bytes.Buffer
+
+	exp := strings.Repeat("0123456789", 1000000)
+
+	if _, err := Staged(ByteBufferStream(&buff)).Write(String(exp[:3000000]), String(exp[3000000:])); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if buff.String() != exp {
+		t.Errorf("Unexpected result of %d bytes", buff.Len())
+		return
+	}
+
+	// failure of the target stream
+	w := limitWriter{limit: 100}
+
+	if _, err := Staged(WriterStream(&w)).Write(String(exp)); err == nil {
+		t.Error("Missing error")
+		return
+	}
+}
@@ -38,10 +38,12 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 	"unicode/utf8"
 )
 
@@ -60,21 +62,192 @@ type Stream struct {
 // Write does the actual writing to the stream, checking errors and also
 // flushing and closing the underlying writer as necessary.
 func (s Stream) Write(chunks ...Chunk) (n int64, err error) {
-	if s.w.close != nil {
+	if g := s.w.guard; g != nil {
+		if err = g.begin(); err != nil {
+			return
+		}
+
+		defer g.end()
+	}
+
+	// a flush or close that has timed out may still be running
+	if s.w.finishErr != nil {
+		return 0, s.w.finishErr
+	}
+
+	if s.w.stopOnClosed {
+		start := s.w.offset
+
+		defer func() {
+			if err != nil && IsSinkClosed(err) {
+				n, err = s.w.offset-start, nil
+			}
+		}()
+	}
+
+	if closeFn := s.w.closeFunc(); closeFn != nil {
 		defer func() {
-			if e := s.w.close(); e != nil && err == nil {
+			if err != nil && s.w.keepOpenOnError {
+				return
+			}
+
+			// the close function may outlive the call on timeout, so it gets a copy of the error
+			cause := err
+
+			// after a timed-out flush the writer is closed in the background once the flush completes
+			if done := s.w.abandoned; done != nil {
+				go func() {
+					<-done
+					closeFn(cause)
+				}()
+
+				return
+			}
+
+			if e := s.w.finish(func() error { return closeFn(cause) }); e != nil && err == nil {
 				err = e
 			}
 		}()
 	}
 
-	if n, err = s.w.WriteChunks(chunks); err == nil && s.w.flush != nil {
-		err = s.w.flush()
+	if s.w.enter != nil {
+		var leave func()
+
+		if leave, err = s.w.enter(s.w.Context()); err != nil {
+			return
+		}
+
+		defer leave()
+	}
+
+	if s.w.countFlushed && s.w.flushed != nil {
+		start := s.w.flushed.n
+
+		defer func() { n = s.w.flushed.n - start }()
+	}
+
+	if s.w.sizeHint > 0 {
+		s.w.Grow(s.w.sizeHint)
+	}
+
+	if s.w.wrap != nil {
+		chunks = s.w.wrap(chunks)
+	}
+
+	if s.w.flushEachChunk && s.w.flush != nil {
+		chunks = flushingChunks(chunks)
+	}
+
+	if n, err = s.w.WriteChunks(chunks); s.w.flush != nil {
+		if err == nil {
+			err = s.w.finish(s.w.flush)
+		} else if s.w.flushOnError {
+			s.w.finish(s.w.flush)
+		}
 	}
 
 	return
 }
 
+// WriteContext is like Write, but also checks the given context before invoking each chunk
+// (including the chunks nested in compositions like All or Join), aborting the write with
+// the context error once the context is done. The context is also made available to the chunk
+// functions via Writer.Context() method.
+func (s Stream) WriteContext(ctx context.Context, chunks ...Chunk) (int64, error) {
+	prev := s.w.ctx
+	s.w.ctx = ctx
+
+	defer func() { s.w.ctx = prev }()
+
+	return s.Write(chunks...)
+}
+
+// run the final flush or close function, bounded by the finish timeout, if any
+func (w *Writer) finish(fn func() error) error {
+	if w.finishTimeout <= 0 {
+		return fn()
+	}
+
+	// try the write deadline first
+	if w.setDeadline != nil && w.setDeadline(time.Now().Add(w.finishTimeout)) == nil {
+		defer w.setDeadline(time.Time{})
+
+		return fn()
+	}
+
+	// watchdog; on timeout the function is left running in the background, and the writer
+	// is marked as failed, because the function may still be using it
+	var err error
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		err = fn()
+	}()
+
+	timer := time.NewTimer(w.finishTimeout)
+
+	defer timer.Stop()
+
+	select {
+	case <-done:
+		return err
+	case <-timer.C:
+		w.abandoned, w.finishErr = done, os.ErrDeadlineExceeded
+		return w.finishErr
+	}
+}
+
+// SizeHint sets the expected number of bytes to be written by each Write() call, so that streams
+// writing to in-memory sinks (bytes.Buffer or strings.Builder) preallocate the space for the data
+// beforehand, avoiding repeated reallocations. Other streams ignore the hint. The function returns
+// the same stream.
+func (s Stream) SizeHint(n int) Stream {
+	s.w.sizeHint = n
+	return s
+}
+
+// make the writer inherit the state of the given parent writer, for nested streams
+func (w *Writer) inherit(parent *Writer) *Writer {
+	w.scope = parent.scope
+	w.includes = parent.includes
+	w.ctx = parent.ctx
+	return w
+}
+
+// the function closing the writer, or nil
+func (w *Writer) closeFunc() func(error) error {
+	if w.closeWithError != nil {
+		return w.closeWithError
+	}
+
+	if fn := w.close; fn != nil {
+		return func(error) error { return fn() }
+	}
+
+	return nil
+}
+
+// LimitStream limits the total number of bytes the given stream may write to the given number;
+// a write that would exceed the limit writes only the bytes that fit, and fails with an error
+// matching ErrLimitExceeded. The limit applies to all Write() calls on the stream together.
+// A non-positive limit removes the limit. The function returns the same stream.
+func LimitStream(s Stream, limit int64) Stream {
+	s.w.limit = limit
+	return s
+}
+
+// CountFlushed switches the stream to the accounting mode where Write() function reports
+// the number of bytes that have actually been passed to the underlying writer, rather than
+// accepted into the stream buffer. The two numbers differ only for buffered streams, and only
+// when the write fails. The function returns the same stream.
+func (s Stream) CountFlushed() Stream {
+	s.w.countFlushed = true
+	return s
+}
+
 /*
 Writer implements the following interface:
 
@@ -85,18 +258,50 @@ Writer implements the following interface:
 
 	WriteRune(rune) (int, error)
 	WriteChunks([]Chunk) (int64, error)
+	Flush() error
+	Grow(int)
+	Offset() int64
+	Context() context.Context
 */
 type Writer struct {
-	writeByteSlice func([]byte) (int, error)      // required, must not be nil
-	writeByte      func(byte) error               // required, must not be nil
-	writeRune      func(rune) (int, error)        // required, must not be nil
-	writeString    func(string) (int, error)      // required, must not be nil
-	readFrom       func(io.Reader) (int64, error) // required, must not be nil
-	flush          func() error                   // optional, may be nil
-	close          func() error                   // optional, may be nil
+	writeByteSlice  func([]byte) (int, error)             // required, must not be nil
+	writeByte       func(byte) error                      // required, must not be nil
+	writeRune       func(rune) (int, error)               // required, must not be nil
+	writeString     func(string) (int, error)             // required, must not be nil
+	readFrom        func(io.Reader) (int64, error)        // required, must not be nil
+	flush           func() error                          // optional, may be nil
+	close           func() error                          // optional, may be nil
+	closeWithError  func(error) error                     // optional, may be nil, takes precedence over close
+	sinkErr         error                                 // the last error from the underlying writer
+	flushed         *countingWriter                       // optional, counts bytes passed through the buffer
+	countFlushed    bool                                  // report the number of bytes passed through the buffer
+	offset          int64                                 // total number of bytes written
+	fastCopy        bool                                  // the buffer is on top of an io.ReaderFrom
+	seek            func(int64, int) (int64, error)       // optional, may be nil
+	buff            *bytes.Buffer                         // optional, direct calls bypassing the function pointers
+	builder         *strings.Builder                      // optional, direct calls bypassing the function pointers
+	sizeHint        int                                   // expected number of bytes per Write() call
+	scratch         [64]byte                              // temporary buffer for the writer fallbacks
+	truncate        func(int64) error                     // optional, may be nil
+	discard         func()                                // optional, drops buffered data, may be nil
+	flushEachChunk  bool                                  // flush after each top-level chunk
+	flushOnError    bool                                  // flush the data written before a failure
+	keepOpenOnError bool                                  // do not close the writer on failure
+	finishTimeout   time.Duration                         // bound on the final flush and close, if positive
+	setDeadline     func(time.Time) error                 // optional, sets the write deadline on the sink
+	finishErr       error                                 // set when the final flush or close has timed out
+	abandoned       chan struct{}                         // closed when the timed-out flush or close completes
+	scope           *bindingScope                         // placeholder bindings, may be nil
+	includes        []string                              // stack of included files
+	ctx             context.Context                       // context of the current write, may be nil
+	enter           func(context.Context) (func(), error) // optional, admission to Write() calls
+	guard           *useGuard                             // concurrent use detector, may be nil
+	stopOnClosed    bool                                  // sink closed by the reader is not an error
+	limit           int64                                 // maximum number of bytes to write, if positive
+	wrap            func([]Chunk) []Chunk                 // optional, applied to the chunks of each Write() call
 }
 
-// WriterStream constructs a stream from the given io.Writer object.
+// WriterStream constructs a stream from the given io.Writer object. See also NewStream function.
 func WriterStream(w io.Writer) Stream {
 	s := &Writer{writeByteSlice: w.Write}
 
@@ -105,9 +310,10 @@ func WriterStream(w io.Writer) Stream {
 	if wr, ok := w.(io.ByteWriter); ok {
 		s.writeByte = wr.WriteByte
 	} else {
+		// the scratch buffer is part of the Writer, so nothing escapes to the heap per call
 		s.writeByte = func(b byte) (err error) {
-			m := [1]byte{b}
-			_, err = w.Write(m[:])
+			s.scratch[0] = b
+			_, err = w.Write(s.scratch[:1])
 			return
 		}
 	}
@@ -119,9 +325,7 @@ func WriterStream(w io.Writer) Stream {
 		s.writeRune = wr.WriteRune
 	} else {
 		s.writeRune = func(r rune) (int, error) {
-			var b [utf8.UTFMax]byte
-
-			return w.Write(b[:utf8.EncodeRune(b[:], r)])
+			return w.Write(utf8.AppendRune(s.scratch[:0], r))
 		}
 	}
 
@@ -129,7 +333,14 @@ func WriterStream(w io.Writer) Stream {
 	if wr, ok := w.(io.StringWriter); ok {
 		s.writeString = wr.WriteString
 	} else {
-		s.writeString = func(str string) (int, error) { return w.Write([]byte(str)) }
+		s.writeString = func(str string) (int, error) {
+			// short strings are copied to the scratch buffer to avoid allocation
+			if len(str) <= len(s.scratch) {
+				return w.Write(s.scratch[:copy(s.scratch[:], str)])
+			}
+
+			return w.Write([]byte(str))
+		}
 	}
 
 	// 4. ReadFrom
@@ -146,11 +357,23 @@ func WriterStream(w io.Writer) Stream {
 		s.flush = wr.Flush
 	}
 
+	// 6. Seek
+	if wr, ok := w.(io.Seeker); ok {
+		s.seek = wr.Seek
+	}
+
+	// 7. Truncate
+	if wr, ok := w.(truncater); ok {
+		s.truncate = wr.Truncate
+	}
+
 	return Stream{s}
 }
 
 // WriteCloserStream constructs a stream from the given io.WriteCloser object.
 // The writer object will be closed upon exit from the stream Write() function.
+//
+// Deprecated: use NewStream(w, WithCloseOnFinish(true)) instead.
 func WriteCloserStream(w io.WriteCloser) (s Stream) {
 	s = WriterStream(w)
 	s.w.close = w.Close
@@ -158,25 +381,64 @@ func WriteCloserStream(w io.WriteCloser) (s Stream) {
 }
 
 // WriterBufferedStream constructs a stream from the given io.Writer object,
-// with bufio.Writer buffer on top of it.
+// with bufio.Writer buffer on top of it. See also NewStream function.
 func WriterBufferedStream(w io.Writer) Stream {
-	b := bufio.NewWriter(w)
+	return writerBufferedStream(w, 0)
+}
 
-	return Stream{
-		&Writer{
-			writeByteSlice: b.Write,
-			writeByte:      b.WriteByte,
-			writeRune:      b.WriteRune,
-			writeString:    b.WriteString,
-			readFrom:       b.ReadFrom,
-			flush:          b.Flush,
-		},
+// buffered stream with the given buffer size, or the default size if zero
+func writerBufferedStream(w io.Writer, size int) Stream {
+	cw := &countingWriter{w: w}
+
+	// preserve the io.ReaderFrom fast path, if any
+	var dest io.Writer = cw
+
+	rf, fastCopy := w.(io.ReaderFrom)
+
+	if fastCopy {
+		dest = &countingReaderFrom{cw, rf}
 	}
+
+	b := bufio.NewWriterSize(dest, max(size, 4096))
+
+	s := &Writer{
+		writeByteSlice: b.Write,
+		writeByte:      b.WriteByte,
+		writeRune:      b.WriteRune,
+		writeString:    b.WriteString,
+		readFrom:       b.ReadFrom,
+		flush:          b.Flush,
+		flushed:        cw,
+		fastCopy:       fastCopy,
+	}
+
+	// seeking requires flushing the buffer first
+	if sk, ok := w.(io.Seeker); ok {
+		s.seek = func(off int64, whence int) (pos int64, err error) {
+			if err = b.Flush(); err == nil {
+				if pos, err = sk.Seek(off, whence); err == nil && whence == io.SeekCurrent {
+					cw.n += off
+				}
+			}
+
+			return
+		}
+	}
+
+	// rollback support: truncation after discarding the buffered data
+	if t, ok := w.(truncater); ok && s.seek != nil {
+		s.truncate = t.Truncate
+		s.discard = func() { b.Reset(dest) }
+	}
+
+	return Stream{s}
 }
 
 // WriteCloserBufferedStream constructs a stream from the given io.WriteCloser object,
 // with bufio.Writer buffer on top of it. The writer object will be closed upon
 // exit from the stream Write() function.
+//
+// Deprecated: use NewStream(w, WithBufferSize(4096), WithCloseOnFinish(true)) instead.
 func WriteCloserBufferedStream(w io.WriteCloser) (s Stream) {
 	s = WriterBufferedStream(w)
 	s.w.close = w.Close
@@ -192,6 +454,7 @@ func ByteBufferStream(b *bytes.Buffer) Stream {
 			writeRune:      b.WriteRune,
 			writeString:    b.WriteString,
 			readFrom:       b.ReadFrom,
+			buff:           b,
 		},
 	}
 }
@@ -205,45 +468,258 @@ func StringBuilderStream(b *strings.Builder) Stream {
 			writeRune:      b.WriteRune,
 			writeString:    b.WriteString,
 			readFrom:       func(src io.Reader) (int64, error) { return io.Copy(b, src) },
+			builder:        b,
 		},
 	}
 }
 
 // Write implements io.Writer interface.
 func (w *Writer) Write(s []byte) (n int, err error) {
+	if w.guard != nil {
+		if err = w.guard.enter(); err != nil {
+			return
+		}
+
+		defer w.guard.leave()
+	}
+
+	if w.limit > 0 && w.offset+int64(len(s)) > w.limit {
+		s = s[:max64(w.limit-w.offset, 0)]
+
+		defer func() {
+			if err == nil {
+				err = ErrLimitExceeded
+			}
+		}()
+	}
+
 	if len(s) > 0 {
-		n, err = w.writeByteSlice(s)
+		// in-memory sinks never fail
+		switch {
+		case w.buff != nil:
+			n, _ = w.buff.Write(s)
+		case w.builder != nil:
+			n, _ = w.builder.Write(s)
+		default:
+			if n, err = w.writeByteSlice(s); err != nil {
+				w.sinkErr = err
+			}
+		}
+
+		w.offset += int64(n)
 	}
 
 	return
 }
 
 // WriteByte implements io.ByteWriter interface.
-func (w *Writer) WriteByte(b byte) error { return w.writeByte(b) }
+func (w *Writer) WriteByte(b byte) (err error) {
+	if w.guard != nil {
+		if err = w.guard.enter(); err != nil {
+			return
+		}
+
+		defer w.guard.leave()
+	}
+
+	if w.limit > 0 && w.offset >= w.limit {
+		return ErrLimitExceeded
+	}
+
+	switch {
+	case w.buff != nil:
+		w.buff.WriteByte(b)
+	case w.builder != nil:
+		w.builder.WriteByte(b)
+	default:
+		err = w.writeByte(b)
+	}
+
+	if err != nil {
+		w.sinkErr = err
+	} else {
+		w.offset++
+	}
+
+	return
+}
 
 // WriteRune writes the given rune to the stream.
-func (w *Writer) WriteRune(r rune) (int, error) { return w.writeRune(r) }
+func (w *Writer) WriteRune(r rune) (n int, err error) {
+	if w.guard != nil {
+		if err = w.guard.enter(); err != nil {
+			return
+		}
+
+		defer w.guard.leave()
+	}
+
+	if w.limit > 0 {
+		size := utf8.RuneLen(r)
+
+		if size < 0 {
+			size = utf8.RuneLen(utf8.RuneError) // invalid runes are written as RuneError
+		}
+
+		if w.offset+int64(size) > w.limit {
+			return 0, ErrLimitExceeded
+		}
+	}
+
+	switch {
+	case w.buff != nil:
+		n, _ = w.buff.WriteRune(r)
+	case w.builder != nil:
+		n, _ = w.builder.WriteRune(r)
+	default:
+		if n, err = w.writeRune(r); err != nil {
+			w.sinkErr = err
+		}
+	}
+
+	w.offset += int64(n)
+	return
+}
 
 // WriteString implements io.StringWriter interface.
 func (w *Writer) WriteString(s string) (n int, err error) {
+	if w.guard != nil {
+		if err = w.guard.enter(); err != nil {
+			return
+		}
+
+		defer w.guard.leave()
+	}
+
+	if w.limit > 0 && w.offset+int64(len(s)) > w.limit {
+		s = s[:max64(w.limit-w.offset, 0)]
+
+		defer func() {
+			if err == nil {
+				err = ErrLimitExceeded
+			}
+		}()
+	}
+
 	if len(s) > 0 {
-		n, err = w.writeString(s)
+		switch {
+		case w.buff != nil:
+			n, _ = w.buff.WriteString(s)
+		case w.builder != nil:
+			n, _ = w.builder.WriteString(s)
+		default:
+			if n, err = w.writeString(s); err != nil {
+				w.sinkErr = err
+			}
+		}
+
+		w.offset += int64(n)
 	}
 
 	return
 }
 
-// ReadFrom implements io.ReaderFrom interface.
-func (w *Writer) ReadFrom(r io.Reader) (int64, error) { return w.readFrom(r) }
+// ReadFrom implements io.ReaderFrom interface. Errors from this function cannot generally
+// be attributed to either the source or the stream, so only the errors indicating that the
+// stream has been closed by the remote side are treated as the stream errors.
+func (w *Writer) ReadFrom(r io.Reader) (n int64, err error) {
+	if w.guard != nil {
+		if err = w.guard.enter(); err != nil {
+			return
+		}
+
+		defer w.guard.leave()
+	}
+
+	if w.limit > 0 {
+		src := r
+		lr := &io.LimitedReader{R: src, N: max64(w.limit-w.offset, 0)}
+		r = lr
+
+		defer func() {
+			// check if the source has more data
+			if err == nil && lr.N == 0 {
+				var b [1]byte
+
+				if m, _ := io.ReadFull(src, b[:]); m > 0 {
+					err = ErrLimitExceeded
+				}
+			}
+		}()
+	}
+
+	if n, err = w.readFrom(r); err != nil && isDisconnect(err) {
+		w.sinkErr = err
+	}
+
+	w.offset += n
+	return
+}
+
+// Grow preallocates space for the given number of bytes, if the stream writes to an in-memory sink
+// (bytes.Buffer or strings.Builder), otherwise does nothing. Useful in chunk functions that know
+// the size of their output in advance.
+func (w *Writer) Grow(n int) {
+	switch {
+	case w.buff != nil:
+		w.buff.Grow(n)
+	case w.builder != nil:
+		w.builder.Grow(n)
+	}
+}
+
+// Offset returns the total number of bytes written to the stream so far.
+func (w *Writer) Offset() int64 { return w.offset }
+
+// Context returns the context of the current write (see Stream.WriteContext), or
+// context.Background() if the write is not bound to a context.
+func (w *Writer) Context() context.Context {
+	if w.ctx != nil {
+		return w.ctx
+	}
+
+	return context.Background()
+}
+
+// Flush flushes the stream, if the stream supports flushing, otherwise does nothing.
+func (w *Writer) Flush() (err error) {
+	if w.guard != nil {
+		if err = w.guard.enter(); err != nil {
+			return
+		}
+
+		defer w.guard.leave()
+	}
+
+	if w.flush != nil {
+		if err = w.flush(); err != nil {
+			w.sinkErr = err
+		}
+	}
+
+	return
+}
 
 // WriteChunks writes the given chunks to the stream. Useful when implementing a chunk
 // composed from other chunks.
 func (w *Writer) WriteChunks(chunks []Chunk) (n int64, err error) {
 	for i, fn := range chunks {
+		if w.ctx != nil {
+			if err = w.ctx.Err(); err != nil {
+				break
+			}
+		}
+
 		var m int64
 
 		if m, err = fn(w); err != nil {
-			err = fmt.Errorf("writing stream chunk %d: %w", i, err) // chunks counted from 0
+			err = &ChunkError{
+				Index:  i,
+				Offset: w.offset,
+				Err:    err,
+				sink:   w.sinkErr != nil && errors.Is(err, w.sinkErr),
+			}
+
 			break
 		}
 
@@ -261,6 +737,15 @@ func (w *Writer) readFromAndClose(src io.ReadCloser) (n int64, err error) {
 		}
 	}()
 
+	// for disk files, flush the buffer to let the underlying writer (if it is also a disk file)
+	// do the copy, possibly without moving the data through the user space at all
+	// (via copy_file_range(2) system call on Linux, which may also clone the data on some file systems)
+	if _, ok := src.(*os.File); ok && w.fastCopy {
+		if err = w.Flush(); err != nil {
+			return
+		}
+	}
+
 	n, err = w.ReadFrom(src)
 	return
 }
@@ -335,6 +820,26 @@ func RepeatN(num int, chunk Chunk) Chunk {
 	})
 }
 
+// WithCleanup constructs a chunk function that invokes the given chunk, and then calls the cleanup
+// function with the chunk's error (nil on success). The cleanup function is also called if the chunk
+// panics, with an error describing the panic, before the panic is propagated further. Note that
+// the cleanup function is not called if the chunk itself is never invoked, for example, due to an error
+// from a preceding chunk; for such cases consider acquiring the resources within the chunk.
+func WithCleanup(chunk Chunk, cleanup func(error)) Chunk {
+	return func(w *Writer) (n int64, err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				cleanup(fmt.Errorf("panic: %v", p))
+				panic(p)
+			}
+
+			cleanup(err)
+		}()
+
+		return chunk(w)
+	}
+}
+
 // ByteSlice constructs a chunk function that writes the given byte slice to a stream.
 func ByteSlice(val []byte) Chunk {
 	if len(val) == 0 {
@@ -359,22 +864,90 @@ func String(val string) Chunk {
 	}
 }
 
+// Flush is a chunk function that flushes the stream, if the stream supports flushing.
+// It is useful for incremental delivery, like with ResponseStream.
+func Flush(w *Writer) (int64, error) {
+	return 0, w.Flush()
+}
+
 // no-op stream write
 func nopChunk(_ *Writer) (int64, error) {
 	return 0, nil
 }
 
-// Byte constructs a chunk function that writes the given byte to a stream.
-func Byte(val byte) Chunk {
+// Newline is a chunk function that writes a '\n' byte to a stream.
+func Newline(w *Writer) (int64, error) { return writeByte(w, '\n') }
+
+// Space is a chunk function that writes a ' ' byte to a stream.
+func Space(w *Writer) (int64, error) { return writeByte(w, ' ') }
+
+// Comma is a chunk function that writes a ',' byte to a stream.
+func Comma(w *Writer) (int64, error) { return writeByte(w, ',') }
+
+// Tab is a chunk function that writes a '\t' byte to a stream.
+func Tab(w *Writer) (int64, error) { return writeByte(w, '\t') }
+
+// CRLF is a chunk function that writes "\r\n" to a stream.
+func CRLF(w *Writer) (int64, error) {
+	n, err := w.WriteString("\r\n")
+	return int64(n), err
+}
+
+// Digits contains chunk functions writing decimal digits from '0' to '9'.
+var Digits = [10]Chunk{
+	func(w *Writer) (int64, error) { return writeByte(w, '0') },
+	func(w *Writer) (int64, error) { return writeByte(w, '1') },
+	func(w *Writer) (int64, error) { return writeByte(w, '2') },
+	func(w *Writer) (int64, error) { return writeByte(w, '3') },
+	func(w *Writer) (int64, error) { return writeByte(w, '4') },
+	func(w *Writer) (int64, error) { return writeByte(w, '5') },
+	func(w *Writer) (int64, error) { return writeByte(w, '6') },
+	func(w *Writer) (int64, error) { return writeByte(w, '7') },
+	func(w *Writer) (int64, error) { return writeByte(w, '8') },
+	func(w *Writer) (int64, error) { return writeByte(w, '9') },
+}
+
+// NewlineN constructs a chunk function that writes the given number of '\n' bytes to a stream.
+func NewlineN(num int) Chunk {
+	if num <= 0 {
+		return nopChunk
+	}
+
+	if num == 1 {
+		return Newline
+	}
+
 	return func(w *Writer) (n int64, err error) {
-		if err = w.WriteByte(val); err == nil {
-			n = 1
+		for left := num; left > 0 && err == nil; {
+			var m int
+
+			m, err = w.WriteString(newlines[:min(left, len(newlines))])
+			n += int64(m)
+			left -= m
 		}
 
 		return
 	}
 }
 
+const newlines = "\n\n\n\n\n\n\n\n\n\n\n\n\n\n\n\n\n\n\n\n\n\n\n\n\n\n\n\n\n\n\n\n"
+
+// write one byte
+func writeByte(w *Writer, b byte) (n int64, err error) {
+	if err = w.WriteByte(b); err == nil {
+		n = 1
+	}
+
+	return
+}
+
+// Byte constructs a chunk function that writes the given byte to a stream.
+func Byte(val byte) Chunk {
+	return func(w *Writer) (int64, error) {
+		return writeByte(w, val)
+	}
+}
+
 // Rune constructs a chunk function that writes the given rune to a stream.
 func Rune(val rune) Chunk {
 	return func(w *Writer) (int64, error) {
@@ -390,6 +963,14 @@ func Reader(src io.Reader) Chunk {
 	}
 }
 
+// WriterTo constructs a chunk function that copies data from the given io.WriterTo (like bytes.Reader
+// or net.Buffers) to a stream, letting the source choose the most efficient way of writing the data.
+func WriterTo(src io.WriterTo) Chunk {
+	return func(w *Writer) (int64, error) {
+		return src.WriteTo(w)
+	}
+}
+
 // ReadCloser constructs a chunk function that copies data from the given io.ReadCloser to a stream,
 // also closing the reader upon completion.
 func ReadCloser(src io.ReadCloser) Chunk {
@@ -398,67 +979,60 @@ func ReadCloser(src io.ReadCloser) Chunk {
 	}
 }
 
-// File constructs a chunk function that copies data from the given disk file to a stream.
-func File(pathname string) Chunk {
+// Open constructs a chunk function that acquires an io.ReadCloser by calling the given function
+// only when the chunk is actually invoked, then copies data from the reader to a stream, and always
+// closes the reader upon completion. Unlike ReadCloser, no resource is held if the chunk never runs,
+// for example, due to an error from a preceding chunk.
+func Open(open func() (io.ReadCloser, error)) Chunk {
 	return func(w *Writer) (n int64, err error) {
-		var file *os.File
+		var src io.ReadCloser
 
-		if file, err = os.Open(pathname); err == nil {
-			n, err = w.readFromAndClose(file)
+		if src, err = open(); err == nil {
+			n, err = w.readFromAndClose(src)
 		}
 
 		return
 	}
 }
 
-// Command constructs a chunk function that invokes the given command and copies its STDOUT
-// to a stream. The initial 2048 bytes of the command's STDERR output (if any) are recorded
-// and returned as an error message if the command fails with a non-zero exit code.
-func Command(name string, args ...string) Chunk {
-	return cmdChunk(exec.Command(name, args...))
-}
-
-// CommandContext is like Command, but also takes a context which when becomes done terminates
-// the process.
-func CommandContext(ctx context.Context, name string, args ...string) Chunk {
-	return cmdChunk(exec.CommandContext(ctx, name, args...))
-}
-
-func cmdChunk(cmd *exec.Cmd) Chunk {
+// File constructs a chunk function that copies data from the given disk file to a stream.
+// Failure to open the file is reported as *SourceError. The file counts towards the limit
+// on open files, if set (see SetOpenFileLimit).
+func File(pathname string) Chunk {
 	return func(w *Writer) (n int64, err error) {
-		// set stderr
-		stderr := limitedWriter{limit: 2048}
-
-		cmd.Stderr = &stderr
+		var release func()
 
-		// get stdout pipe
-		var stdout io.ReadCloser
-
-		if stdout, err = cmd.StdoutPipe(); err != nil {
+		if release, err = acquireOpenFile(w.Context()); err != nil {
 			return
 		}
 
-		// start the command
-		if err = cmd.Start(); err != nil {
-			return
-		}
+		defer release()
 
-		// read output
-		if n, err = w.ReadFrom(stdout); err != nil {
-			// this error may come from the target writer, so in order to make the command fail
-			// here we can just close the STDOUT pipe (is that correct?)
-			stdout.Close()
-			cmd.Wait()
+		var file FileHandle
 
-			return
+		if file, err = openFile(pathname); err != nil {
+			return 0, sourceError("open", pathname, err)
 		}
 
-		// wait for completion
-		if err = cmd.Wait(); err != nil {
-			if msg := stderr.String(); len(msg) > 0 {
-				err = errors.New(msg)
-			} else {
-				err = fmt.Errorf("command %q: %w", cmd.Args[0], err)
+		return w.readFromAndClose(file)
+	}
+}
+
+// FileOptional is like File, but writes nothing if the file does not exist.
+func FileOptional(pathname string) Chunk {
+	return FileOr(pathname, nopChunk)
+}
+
+// FileOr is like File, but writes the given placeholder chunk instead, if the file does not exist.
+func FileOr(pathname string, placeholder Chunk) Chunk {
+	file := File(pathname)
+
+	return func(w *Writer) (n int64, err error) {
+		if n, err = file(w); errors.Is(err, fs.ErrNotExist) {
+			var se *SourceError
+
+			if errors.As(err, &se) && se.Path == pathname {
+				return placeholder(w)
 			}
 		}
 
@@ -466,29 +1040,40 @@ func cmdChunk(cmd *exec.Cmd) Chunk {
 	}
 }
 
-type limitedWriter struct {
-	b     []byte
-	limit int
-}
+// Files constructs a chunk function that copies data from the given disk files to a stream,
+// one after another, holding at most one of the files open at any time.
+func Files(pathnames ...string) Chunk {
+	chunks := make([]Chunk, len(pathnames))
 
-func (w *limitedWriter) Write(s []byte) (int, error) {
-	if n := min(w.limit-len(w.b), len(s)); n > 0 {
-		w.b = append(w.b, s[:n]...)
+	for i, name := range pathnames {
+		chunks[i] = File(name)
 	}
 
-	return len(s), nil
+	return All(chunks...)
 }
 
-func (w *limitedWriter) String() string {
-	// truncation may result in broken UTF-8 encoding at the end of the message
-	s := w.b
+// io.Writer that counts the number of bytes written
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
 
-	for r, n := utf8.DecodeLastRune(s); r == utf8.RuneError && n > 0; r, n = utf8.DecodeLastRune(s) {
-		s = s[:len(s)-n]
-	}
+func (c *countingWriter) Write(s []byte) (n int, err error) {
+	n, err = c.w.Write(s)
+	c.n += int64(n)
+	return
+}
 
-	// trim space and return as a string
-	return string(bytes.TrimSpace(s))
+// countingWriter that also implements io.ReaderFrom
+type countingReaderFrom struct {
+	*countingWriter
+	rf io.ReaderFrom
+}
+
+func (c *countingReaderFrom) ReadFrom(src io.Reader) (n int64, err error) {
+	n, err = c.rf.ReadFrom(src)
+	c.n += n
+	return
 }
 
 func min(a, b int) int {
@@ -500,36 +1085,307 @@ func min(a, b int) int {
 }
 
 // WriteFile is a convenience function for writing to the given disk file. Existing file gets overwritten.
-func WriteFile(pathname string, perm os.FileMode, chunks ...Chunk) (int64, error) {
-	return writeFile(pathname, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm, chunks)
+func WriteFile(pathname string, perm fs.FileMode, chunks ...Chunk) (int64, error) {
+	return OutputFile{Perm: perm}.Write(pathname, chunks...)
 }
 
 // AppendToFile is a convenience function for appending data to the given disk file. The file is created
 // if does not exist.
-func AppendToFile(pathname string, perm os.FileMode, chunks ...Chunk) (int64, error) {
-	return writeFile(pathname, os.O_CREATE|os.O_WRONLY|os.O_APPEND, perm, chunks)
+func AppendToFile(pathname string, perm fs.FileMode, chunks ...Chunk) (int64, error) {
+	return OutputFile{Perm: perm}.Append(pathname, chunks...)
+}
+
+// WriteFileFS is like WriteFile, but the file name is resolved within the given root directory,
+// so that the write cannot escape the directory tree (see os.Root).
+func WriteFileFS(root *os.Root, name string, perm fs.FileMode, chunks ...Chunk) (int64, error) {
+	return OutputFile{Perm: perm, Root: root}.Write(name, chunks...)
+}
+
+// AppendToFileFS is like AppendToFile, but the file name is resolved within the given root directory,
+// so that the write cannot escape the directory tree (see os.Root).
+func AppendToFileFS(root *os.Root, name string, perm fs.FileMode, chunks ...Chunk) (int64, error) {
+	return OutputFile{Perm: perm, Root: root}.Append(name, chunks...)
+}
+
+// OutputFile specifies options for non-atomic file writes. The zero value (apart from
+// the permission bits) corresponds to the behaviour of WriteFile and AppendToFile functions.
+type OutputFile struct {
+	// Permission bits for a new file. By default, the bits are combined with 0600 and then
+	// subjected to umask.
+	Perm fs.FileMode
+
+	// If set, the permission bits of the file are set to exactly Perm value, regardless of umask,
+	// and even if the file already exists.
+	ExactPerm bool
+
+	// Optional root directory to confine the write to.
+	Root *os.Root
+
+	// Optional encoder (compressor) to write the data through, see also CodecForFile.
+	Codec Codec
+
+	// If set, the file is synced to the disk before closing.
+	Sync bool
+
+	// If set, nothing is written to the disk; instead, the chunks are rendered and compared
+	// with the existing file content, and the function is called with the description of the write.
+	DryRun func(DryRunEntry)
+}
+
+// Write writes the given chunks to the specified file. Existing file gets overwritten.
+func (f OutputFile) Write(pathname string, chunks ...Chunk) (int64, error) {
+	return f.write(pathname, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, chunks)
+}
+
+// Append appends the given chunks to the specified file. The file is created if does not exist.
+func (f OutputFile) Append(pathname string, chunks ...Chunk) (int64, error) {
+	return f.write(pathname, os.O_CREATE|os.O_WRONLY|os.O_APPEND, chunks)
 }
 
 // write to disk file
-func writeFile(pathname string, flags int, perm os.FileMode, chunks []Chunk) (n int64, err error) {
-	var file *os.File
+func (f OutputFile) write(pathname string, flags int, chunks []Chunk) (n int64, err error) {
+	ops := osFileOps()
 
-	if file, err = os.OpenFile(pathname, flags, perm|0600); err == nil {
-		n, err = WriteCloserBufferedStream(file).Write(chunks...)
+	if f.Root != nil {
+		ops = rootFileOps(f.Root)
 	}
 
-	return
+	if f.DryRun != nil {
+		return dryRun(ops.open, pathname, flags&os.O_APPEND != 0, f.Codec, chunks, f.DryRun)
+	}
+
+	perm := f.Perm | 0600
+
+	if f.ExactPerm {
+		perm = f.Perm & os.ModePerm
+	}
+
+	var file FileHandle
+
+	if file, err = ops.openFile(pathname, flags, perm); err != nil {
+		return
+	}
+
+	if f.ExactPerm {
+		if err = file.Chmod(perm); err != nil {
+			file.Close()
+			return
+		}
+	}
+
+	if f.Sync {
+		sync := func(_ *Writer) (int64, error) { return 0, file.Sync() }
+
+		chunks = append(append([]Chunk(nil), encoded(f.Codec, chunks)...), Flush, sync)
+	} else {
+		chunks = encoded(f.Codec, chunks)
+	}
+
+	return NewStream(file, WithBufferSize(4096), WithCloseOnFinish(true)).Write(chunks...)
 }
 
 // AtomicWriteFile is a convenience function for writing to the given disk file. The file must exist,
 // and be a regular file. The write first goes to a temporary file, and then the temporary gets moved to
 // the destination, but only upon successful completion of the write operation. In case of any error the
 // temporary is removed from the disk, and the target (if exists) is left untouched.
-func AtomicWriteFile(pathname string, perm os.FileMode, chunks ...Chunk) (n int64, err error) {
+// A symbolic link as the target is rejected with an error.
+func AtomicWriteFile(pathname string, perm fs.FileMode, chunks ...Chunk) (int64, error) {
+	return AtomicFile{Perm: perm}.Write(pathname, chunks...)
+}
+
+// AtomicWriteFileFS is like AtomicWriteFile, but the file name is resolved within the given root
+// directory, so that the write cannot escape the directory tree (see os.Root).
+func AtomicWriteFileFS(root *os.Root, name string, perm fs.FileMode, chunks ...Chunk) (int64, error) {
+	return AtomicFile{Perm: perm, Root: root}.Write(name, chunks...)
+}
+
+// AtomicFile specifies options for atomic file writes. The zero value (apart from the permission
+// bits) corresponds to the behaviour of AtomicWriteFile function.
+type AtomicFile struct {
+	Perm     fs.FileMode   // permission bits for a new file
+	Root     *os.Root      // optional root directory to confine the write to
+	Symlinks SymlinkPolicy // what to do if the target is a symbolic link
+	Codec    Codec         // optional encoder (compressor), see also CodecForFile
+	Sync     bool          // if set, the temporary file is synced to the disk before the rename
+
+	// If set, the permission bits of the file are set to exactly Perm value, even if the target
+	// already exists, and even if the value does not allow writing (like 0440).
+	ExactPerm bool
+
+	// attributes to set on the file before it is moved to the destination
+	ModTime    time.Time              // modification time, if not zero
+	AccessTime time.Time              // access time, if not zero; defaults to ModTime
+	Owner      *FileOwner             // owner of the file, if not nil
+	Finish     func(FileHandle) error // optional hook to set other attributes, like xattrs
+
+	// If set, nothing is written to the disk; instead, the chunks are rendered and compared
+	// with the existing file content, and the function is called with the description of the write.
+	DryRun func(DryRunEntry)
+}
+
+// FileOwner specifies the owner of a file, as in os.Chown function.
+type FileOwner struct {
+	UID, GID int
+}
+
+// SymlinkPolicy specifies how an atomic write treats a target that is a symbolic link.
+type SymlinkPolicy int
+
+const (
+	// SymlinkReject makes the write fail with an error (the default).
+	SymlinkReject SymlinkPolicy = iota
+
+	// SymlinkFollow makes the write go to the final destination of the link (which must be
+	// a regular file, if exists), with the temporary file created in the destination's directory.
+	// The link itself is left untouched.
+	SymlinkFollow
+
+	// SymlinkReplace makes the write replace the link itself with a regular file.
+	SymlinkReplace
+)
+
+// Write writes the given chunks to the specified file, atomically, as described for AtomicWriteFile
+// function.
+func (a AtomicFile) Write(pathname string, chunks ...Chunk) (int64, error) {
+	ops := osFileOps()
+
+	if a.Root != nil {
+		ops = rootFileOps(a.Root)
+	}
+
+	return a.write(ops, pathname, chunks)
+}
+
+// file system operations used by the atomic write
+type fileOps struct {
+	open       func(string) (io.ReadCloser, error)
+	openFile   func(string, int, fs.FileMode) (FileHandle, error)
+	lstat      func(string) (fs.FileInfo, error)
+	readlink   func(string) (string, error)
+	createTemp func(dir, pattern string) (FileHandle, string, error)
+	rename     func(string, string) error
+	link       func(string, string) error
+	remove     func(string) error
+	chtimes    func(string, time.Time, time.Time) error
+}
+
+// file system operations from the package file system (see SetFileSystem)
+func osFileOps() fileOps {
+	fsys := currentFS()
+
+	return fileOps{
+		open: func(name string) (io.ReadCloser, error) {
+			return fsys.OpenFile(name, os.O_RDONLY, 0)
+		},
+		openFile: fsys.OpenFile,
+		lstat:    fsys.Lstat,
+		readlink: fsys.Readlink,
+		createTemp: func(dir, pattern string) (fd FileHandle, name string, err error) {
+			if fd, err = fsys.CreateTemp(dir, pattern); err == nil {
+				name = fd.Name()
+			}
+
+			return
+		},
+		rename:  fsys.Rename,
+		link:    fsys.Link,
+		remove:  fsys.Remove,
+		chtimes: fsys.Chtimes,
+	}
+}
+
+func rootFileOps(root *os.Root) fileOps {
+	return fileOps{
+		open: func(name string) (io.ReadCloser, error) {
+			return fileHandle(root.Open(name))
+		},
+		openFile: func(name string, flag int, perm fs.FileMode) (FileHandle, error) {
+			return fileHandle(root.OpenFile(name, flag, perm))
+		},
+		lstat:    root.Lstat,
+		readlink: root.Readlink,
+		createTemp: func(dir, prefix string) (fd FileHandle, name string, err error) {
+			// os.Root has no CreateTemp, so here is a simplified version of it; the counter keeps
+			// the names distinct even if the random source repeats itself
+			for i := 0; i < 10000; i++ {
+				name = filepath.Join(dir, prefix+strconv.FormatUint(uint64(randomUint32()+uint32(i)), 10))
+
+				if fd, err = fileHandle(root.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)); !errors.Is(err, fs.ErrExist) {
+					break
+				}
+			}
+
+			if err != nil {
+				name = ""
+			}
+
+			return
+		},
+		rename:  root.Rename,
+		link:    root.Link,
+		remove:  root.Remove,
+		chtimes: root.Chtimes,
+	}
+}
+
+// resolve the given symbolic link to its final destination
+func resolveSymlink(ops fileOps, pathname string) (string, error) {
+	for i := 0; i < 255; i++ {
+		stat, err := ops.lstat(pathname)
+
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				err = nil // broken link, the target will be created
+			}
+
+			return pathname, err
+		}
+
+		if stat.Mode()&fs.ModeSymlink == 0 {
+			return pathname, nil
+		}
+
+		var link string
+
+		if link, err = ops.readlink(pathname); err != nil {
+			return "", err
+		}
+
+		if !filepath.IsAbs(link) {
+			link = filepath.Join(filepath.Dir(pathname), link)
+		}
+
+		pathname = link
+	}
+
+	return "", &os.PathError{
+		Op:   "atomic write to file",
+		Path: pathname,
+		Err:  errors.New("too many levels of symbolic links"),
+	}
+}
+
+func (a AtomicFile) write(ops fileOps, pathname string, chunks []Chunk) (n int64, err error) {
+	perm := a.Perm
+
 	// check destination; it must be a regular file
 	var stat os.FileInfo
 
-	if stat, err = os.Lstat(pathname); err == nil {
+	if stat, err = ops.lstat(pathname); err == nil && stat.Mode()&fs.ModeSymlink != 0 {
+		switch a.Symlinks {
+		case SymlinkFollow:
+			if pathname, err = resolveSymlink(ops, pathname); err != nil {
+				return
+			}
+
+			stat, err = ops.lstat(pathname)
+
+		case SymlinkReplace:
+			stat, err = nil, fs.ErrNotExist
+		}
+	}
+
+	if err == nil {
 		// check if it's a regular file
 		if !stat.Mode().IsRegular() {
 			err = &os.PathError{
@@ -542,14 +1398,16 @@ func AtomicWriteFile(pathname string, perm os.FileMode, chunks ...Chunk) (n int6
 		}
 
 		// copy permission bits from the existing file
-		perm = stat.Mode().Perm()
+		if !a.ExactPerm {
+			perm = stat.Mode().Perm()
+		}
 
 	} else if !errors.Is(err, os.ErrNotExist) {
 		return
 	}
 
 	// check permission bits
-	if perm &= os.ModePerm; perm&0200 == 0 {
+	if perm &= os.ModePerm; perm&0200 == 0 && !a.ExactPerm {
 		err = &os.PathError{
 			Op:   "atomic write to file",
 			Path: pathname,
@@ -559,39 +1417,70 @@ func AtomicWriteFile(pathname string, perm os.FileMode, chunks ...Chunk) (n int6
 		return
 	}
 
+	if a.DryRun != nil {
+		return dryRun(ops.open, pathname, false, a.Codec, chunks, a.DryRun)
+	}
+
 	// create temporary file in the same directory as the target
-	var fd *os.File
+	var fd FileHandle
+	var temp string
 
-	if fd, err = os.CreateTemp(filepath.Dir(pathname), "tmp-"); err != nil {
+	if fd, temp, err = ops.createTemp(filepath.Dir(pathname), "tmp-"); err != nil {
 		return
 	}
 
-	temp := fd.Name()
-
-	// make sure the temporary file is removed on failure
+	// make sure the temporary file is closed and removed on failure
 	defer func() {
 		if p := recover(); p != nil {
-			os.Remove(temp)
+			fd.Close()
+			ops.remove(temp)
 			panic(p)
 		}
 
 		if err != nil {
 			n = 0
-			os.Remove(temp)
+			ops.remove(temp)
 		}
 	}()
 
 	// set file permissions
 	if err = fd.Chmod(perm); err != nil {
+		fd.Close()
 		return
 	}
 
-	// do the write
-	if n, err = WriteCloserBufferedStream(fd).Write(chunks...); err != nil {
-		return
+	// do the write, and optionally flush the data to the disk before renaming
+	if n, err = WriterBufferedStream(fd).Write(encoded(a.Codec, chunks)...); err == nil && a.Sync {
+		err = fd.Sync()
+	}
+
+	// set attributes
+	if err == nil && a.Owner != nil {
+		err = fd.Chown(a.Owner.UID, a.Owner.GID)
+	}
+
+	if err == nil && a.Finish != nil {
+		err = a.Finish(fd)
+	}
+
+	if e := fd.Close(); e != nil && err == nil {
+		err = e
+	}
+
+	if err == nil && !(a.ModTime.IsZero() && a.AccessTime.IsZero()) {
+		atime := a.AccessTime
+
+		if atime.IsZero() {
+			atime = a.ModTime
+		}
+
+		err = ops.chtimes(temp, atime, a.ModTime)
+	}
+
+	if err == nil {
+		err = ops.rename(temp, pathname)
 	}
 
-	err = os.Rename(temp, pathname)
 	return
 }
 
@@ -599,10 +1488,33 @@ func AtomicWriteFile(pathname string, perm os.FileMode, chunks ...Chunk) (n int6
 // the file and the number of bytes written, or an error. In case of any error or a panic
 // the temporary file is removed from the disk. The file name has prefix "tmp-", and it is
 // located in the default directory for temporary files (see os.TempDir).
-func WriteTempFile(chunks ...Chunk) (name string, n int64, err error) {
-	var fd *os.File
+func WriteTempFile(chunks ...Chunk) (string, int64, error) {
+	return WriteTempFileIn("", "tmp-", chunks...)
+}
+
+// WriteTempFileIn is like WriteTempFile, but creates the temporary file in the given directory,
+// with the name generated from the given pattern, as described in os.CreateTemp documentation.
+func WriteTempFileIn(dir, pattern string, chunks ...Chunk) (string, int64, error) {
+	return TempFile{Dir: dir, Pattern: pattern}.Write(chunks...)
+}
+
+// TempFile specifies the location and naming of a temporary file.
+type TempFile struct {
+	Dir         string // directory, or os.TempDir() if empty
+	Pattern     string // file name pattern, as in os.CreateTemp
+	KeepOnError bool   // do not remove the file on error or panic, for debugging
+}
+
+// Write writes the given chunks to a new temporary file and returns the full path to the file
+// and the number of bytes written, or an error. Unless KeepOnError flag is set, in case of any
+// error or a panic the temporary file is removed from the disk. With the flag set, the file name
+// is returned along with the error, if the file has been created.
+func (t TempFile) Write(chunks ...Chunk) (name string, n int64, err error) {
+	fsys := currentFS()
+
+	var fd FileHandle
 
-	if fd, err = os.CreateTemp("", "tmp-"); err != nil {
+	if fd, err = fsys.CreateTemp(t.Dir, t.Pattern); err != nil {
 		return
 	}
 
@@ -610,19 +1522,23 @@ func WriteTempFile(chunks ...Chunk) (name string, n int64, err error) {
 
 	// make sure the temporary file is removed on failure
 	defer func() {
+		if t.KeepOnError {
+			return
+		}
+
 		if p := recover(); p != nil {
-			os.Remove(name)
+			fsys.Remove(name)
 			panic(p)
 		}
 
 		if err != nil {
-			os.Remove(name)
+			fsys.Remove(name)
 			name = ""
 			n = 0
 		}
 	}()
 
 	// do the write
-	n, err = WriteCloserBufferedStream(fd).Write(chunks...)
+	n, err = NewStream(fd, WithBufferSize(4096), WithCloseOnFinish(true)).Write(chunks...)
 	return
 }
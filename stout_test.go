@@ -30,15 +30,19 @@ package stout
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
-	"io/ioutil"
+	"io"
+	"io/fs"
 	"log"
+	"net"
 	"os"
 	"path/filepath"
 	"runtime"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestBasics(t *testing.T) {
@@ -94,6 +98,38 @@ func TestAtomicWriteFile(t *testing.T) {
 	}
 }
 
+func TestAtomicWriteFileNew(t *testing.T) {
+	name, err := mktemp("zzz-")
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	os.Remove(name)
+	defer os.Remove(name)
+
+	if _, err = AtomicWriteFile(name, 0644, String("ZZZ")); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err = checkContent(name, "ZZZ", 3); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// with sync
+	if _, err = (AtomicFile{Perm: 0644, Sync: true}).Write(name, String("XXXX")); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err = checkContent(name, "XXXX", 4); err != nil {
+		t.Error(err)
+	}
+}
+
 func TestAtomicWriteFileError(t *testing.T) {
 	const file = "test-atomic-write-error"
 
@@ -116,7 +152,7 @@ func TestAtomicWriteFileError(t *testing.T) {
 	}
 
 	// check error message
-	const msg = "writing stream chunk 0: test error"
+	const msg = "writing stream chunk 0 at offset 15: test error"
 
 	if s := err.Error(); s != msg {
 		t.Errorf("Unexpected error message: %q instead of %q", s, msg)
@@ -176,6 +212,145 @@ func TestAtomicWriteFileError(t *testing.T) {
 	t.Log(err)
 }
 
+func TestAtomicWriteFileSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file")
+	link := filepath.Join(dir, "link")
+
+	if _, err := WriteFile(file, 0644, String("ZZZ")); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := os.Symlink("file", link); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// follow
+	if _, err := (AtomicFile{Symlinks: SymlinkFollow}).Write(link, String("aaa")); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := checkContent(file, "aaa", 3); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if stat, err := os.Lstat(link); err != nil || stat.Mode()&os.ModeSymlink == 0 {
+		t.Error("The link has been replaced:", err)
+		return
+	}
+
+	// replace
+	if _, err := (AtomicFile{Perm: 0644, Symlinks: SymlinkReplace}).Write(link, String("bbb")); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := checkContent(link, "bbb", 3); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if stat, err := os.Lstat(link); err != nil || !stat.Mode().IsRegular() {
+		t.Error("The link has not been replaced:", err)
+		return
+	}
+
+	if err := checkContent(file, "aaa", 3); err != nil {
+		t.Error(err)
+		return
+	}
+}
+
+func TestAtomicWriteFileAttributes(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file")
+	mtime := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+
+	var finished bool
+
+	opts := AtomicFile{
+		Perm:    0644,
+		ModTime: mtime,
+		Finish: func(fd FileHandle) error {
+			finished = true
+			return nil
+		},
+	}
+
+	if runtime.GOOS != "windows" {
+		opts.Owner = &FileOwner{UID: os.Getuid(), GID: os.Getgid()}
+	}
+
+	if _, err := opts.Write(file, String("ZZZ")); err != nil {
+		t.Error(err)
+		return
+	}
+
+	stat, err := os.Stat(file)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if !stat.ModTime().Equal(mtime) {
+		t.Errorf("Unexpected modification time: %s instead of %s", stat.ModTime(), mtime)
+		return
+	}
+
+	if !finished {
+		t.Error("Finish hook not called")
+		return
+	}
+}
+
+func TestExactPerm(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("not applicable on windows")
+	}
+
+	dir := t.TempDir()
+
+	check := func(name string, perm os.FileMode) error {
+		stat, err := os.Stat(name)
+
+		if err != nil {
+			return err
+		}
+
+		if p := stat.Mode().Perm(); p != perm {
+			return fmt.Errorf("Unexpected permissions: %#o instead of %#o", p, perm)
+		}
+
+		return nil
+	}
+
+	file := filepath.Join(dir, "file")
+
+	if _, err := (OutputFile{Perm: 0466, ExactPerm: true}).Write(file, String("ZZZ")); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := check(file, 0466); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if _, err := (AtomicFile{Perm: 0440, ExactPerm: true}).Write(file, String("ZZZ")); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := check(file, 0440); err != nil {
+		t.Error(err)
+		return
+	}
+}
+
 func TestAtomicWriteFilePanic(t *testing.T) {
 	const (
 		file = "test-atomic-write-panic"
@@ -229,7 +404,7 @@ func TestAtomicWriteFilePanic(t *testing.T) {
 		}
 
 		// check the target content
-		content, err := ioutil.ReadFile(file)
+		content, err := os.ReadFile(file)
 
 		if err != nil {
 			t.Error(err)
@@ -259,6 +434,70 @@ func TestAtomicWriteFilePanic(t *testing.T) {
 	}
 }
 
+func TestWriteFileFS(t *testing.T) {
+	root, err := os.OpenRoot(t.TempDir())
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	defer root.Close()
+
+	if _, err = WriteFileFS(root, "zzz", 0644, String("ZZZ")); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if _, err = AppendToFileFS(root, "zzz", 0644, String("aaa")); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err = checkContent(filepath.Join(root.Name(), "zzz"), "ZZZaaa", 6); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// escape attempt
+	if _, err = WriteFileFS(root, "../zzz", 0644, String("ZZZ")); err == nil {
+		t.Error("Missing error")
+		return
+	}
+
+	t.Log(err)
+
+	// atomic write
+	if _, err = AtomicWriteFileFS(root, "zzz", 0644, String("bbb")); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err = checkContent(filepath.Join(root.Name(), "zzz"), "bbb", 3); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// escape via symlink
+	if err = os.Symlink("..", filepath.Join(root.Name(), "up")); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if _, err = AtomicWriteFileFS(root, "up/zzz", 0644, String("ZZZ")); err == nil {
+		t.Error("Missing error")
+		return
+	}
+
+	t.Log(err)
+
+	// check for leftovers
+	if files, _ := filepath.Glob(filepath.Join(root.Name(), "tmp-*")); len(files) > 0 {
+		t.Error("Found unexpected temporary files:", files)
+		return
+	}
+}
+
 func TestAppendToFile(t *testing.T) {
 	tmp, _, err := WriteTempFile(String("ZZZ"))
 
@@ -274,7 +513,7 @@ func TestAppendToFile(t *testing.T) {
 		return
 	}
 
-	cont, err := ioutil.ReadFile(tmp)
+	cont, err := os.ReadFile(tmp)
 
 	if err != nil {
 		t.Error(err)
@@ -379,6 +618,88 @@ func TestFromFile(t *testing.T) {
 	}
 }
 
+func TestFileFastCopy(t *testing.T) {
+	name, err := writeTempFile("ZZZ")
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	defer os.Remove(name)
+
+	var w readerFromWriter
+
+	_, err = WriterBufferedStream(&w).Write(String("--- "), File(name), String(" ---"))
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	const exp = "--- ZZZ ---"
+
+	if s := string(w.b); s != exp {
+		t.Errorf("Unexpected result: %q instead of %q", s, exp)
+		return
+	}
+
+	if !w.called {
+		t.Error("ReadFrom has not been called")
+		return
+	}
+}
+
+func TestFileOptional(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "file")
+	missing := filepath.Join(dir, "missing")
+
+	if err := os.WriteFile(name, []byte("ZZZ"), 0644); err != nil {
+		t.Error(err)
+		return
+	}
+
+	var b strings.Builder
+
+	_, err := StringBuilderStream(&b).Write(
+		FileOptional(name),
+		FileOptional(missing),
+		FileOr(missing, String(" (none)")),
+	)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if b.String() != "ZZZ (none)" {
+		t.Errorf("Unexpected result: %q", b.String())
+		return
+	}
+
+	// strict variant
+	_, err = StringBuilderStream(&b).Write(File(missing))
+
+	var se *SourceError
+
+	if !errors.As(err, &se) || se.Path != missing || se.Op != "open" || !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+}
+
+// writer that records ReadFrom calls
+type readerFromWriter struct {
+	writer
+	called bool
+}
+
+func (w *readerFromWriter) ReadFrom(src io.Reader) (int64, error) {
+	w.called = true
+	return io.Copy(&w.writer, src)
+}
+
 func TestDefaultFunctions(t *testing.T) {
 	var w writer
 
@@ -430,7 +751,7 @@ func TestCommadError(t *testing.T) {
 		return
 	}
 
-	// "writing stream chunk 0: cat: this-file-does-not-exist: No such file or directory"
+	// "writing stream chunk 0 at offset 0: cat: this-file-does-not-exist: No such file or directory"
 	t.Log(err)
 }
 
@@ -453,7 +774,7 @@ func TestCommadStreamError(t *testing.T) {
 		return
 	}
 
-	const msg = "writing stream chunk 0: dead writer error"
+	const msg = "writing stream chunk 0 at offset 0: dead writer error"
 
 	if s := err.Error(); s != msg {
 		t.Errorf("Unexpected error message: %q instead of %q", s, msg)
@@ -461,6 +782,152 @@ func TestCommadStreamError(t *testing.T) {
 	}
 }
 
+func TestWriteContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	defer cancel()
+
+	var b strings.Builder
+
+	s := StringBuilderStream(&b)
+
+	_, err := s.WriteContext(ctx,
+		String("aaa"),
+		All(
+			String("bbb"),
+			func(w *Writer) (int64, error) {
+				if w.Context() != ctx {
+					return 0, errors.New("unexpected context")
+				}
+
+				cancel()
+				return 0, nil
+			},
+			String("ccc"),
+		),
+		String("ddd"),
+	)
+
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	if b.String() != "aaabbb" {
+		t.Errorf("Unexpected result: %q", b.String())
+		return
+	}
+
+	// the context is not retained after the write
+	_, err = s.Write(func(w *Writer) (int64, error) {
+		if w.Context() != context.Background() {
+			return 0, errors.New("unexpected context")
+		}
+
+		return 0, nil
+	})
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+}
+
+func TestWithCleanup(t *testing.T) {
+	var b strings.Builder
+	var res []error
+
+	cleanup := func(err error) { res = append(res, err) }
+
+	_, err := StringBuilderStream(&b).Write(
+		WithCleanup(String("aaa"), cleanup),
+		WithCleanup(func(_ *Writer) (int64, error) { return 0, errors.New("test error") }, cleanup),
+	)
+
+	if err == nil {
+		t.Error("Missing error")
+		return
+	}
+
+	if len(res) != 2 || res[0] != nil || res[1] == nil || res[1].Error() != "test error" {
+		t.Error("Unexpected cleanup errors:", res)
+		return
+	}
+}
+
+func TestOpen(t *testing.T) {
+	var opened, closed bool
+
+	open := func() (io.ReadCloser, error) {
+		opened = true
+		return &testReadCloser{strings.NewReader("ZZZ"), &closed}, nil
+	}
+
+	var b strings.Builder
+
+	// the first chunk fails, so the second should not open anything
+	_, err := StringBuilderStream(&b).Write(
+		func(_ *Writer) (int64, error) { return 0, errors.New("test error") },
+		Open(open),
+	)
+
+	if err == nil || opened {
+		t.Error("Unexpected result:", err, opened)
+		return
+	}
+
+	if _, err = StringBuilderStream(&b).Write(Open(open)); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if !opened || !closed || b.String() != "ZZZ" {
+		t.Error("Unexpected result:", opened, closed, b.String())
+		return
+	}
+}
+
+type testReadCloser struct {
+	io.Reader
+	closed *bool
+}
+
+func (r *testReadCloser) Close() error {
+	*r.closed = true
+	return nil
+}
+
+func TestCountFlushed(t *testing.T) {
+	w := limitWriter{limit: 9000}
+
+	n, err := WriterBufferedStream(&w).CountFlushed().Write(RepeatN(1000, String("ZZZZZZZZZZ")))
+
+	if err == nil {
+		t.Error("Missing error")
+		return
+	}
+
+	if n != int64(len(w.b)) {
+		t.Errorf("Unexpected number of bytes written: %d instead of %d", n, len(w.b))
+		return
+	}
+}
+
+// writer that fails after the given number of bytes
+type limitWriter struct {
+	b     []byte
+	limit int
+}
+
+func (w *limitWriter) Write(s []byte) (int, error) {
+	if n := len(w.b) + len(s); n > w.limit {
+		return 0, errors.New("limit exceeded")
+	}
+
+	w.b = append(w.b, s...)
+	return len(s), nil
+}
+
 type deadWriter struct{}
 
 func (*deadWriter) Write(_ []byte) (int, error) {
@@ -526,7 +993,7 @@ func testAndCompare(expected string, test func(string) (int64, error)) error {
 }
 
 func testAndCompareFd(expected string, test func(*os.File) (int64, error)) error {
-	fd, err := ioutil.TempFile("", "zzz-")
+	fd, err := os.CreateTemp("", "zzz-")
 
 	if err != nil {
 		return err
@@ -553,7 +1020,7 @@ func checkContent(fileName, content string, n int64) error {
 		return fmt.Errorf("Unexpected number of bytes written: %d instead of %d", n, m)
 	}
 
-	res, err := ioutil.ReadFile(fileName)
+	res, err := os.ReadFile(fileName)
 
 	if err != nil {
 		return err
@@ -573,7 +1040,7 @@ func writeTempFile(content string) (name string, err error) {
 }
 
 func mktemp(prefix string) (string, error) {
-	file, err := ioutil.TempFile("", prefix)
+	file, err := os.CreateTemp("", prefix)
 
 	if err != nil {
 		return "", err
@@ -605,3 +1072,246 @@ func (w *writer) Write(s []byte) (int, error) {
 	w.b = append(w.b, s...)
 	return len(s), nil
 }
+
+func TestCommonChunks(t *testing.T) {
+	var b strings.Builder
+
+	chunks := []Chunk{Newline, Space, Comma, Tab, CRLF, NewlineN(0), NewlineN(1), NewlineN(100)}
+
+	for _, d := range Digits {
+		chunks = append(chunks, d)
+	}
+
+	n, err := StringBuilderStream(&b).Write(chunks...)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	exp := "\n ,\t\r\n\n" + strings.Repeat("\n", 100) + "0123456789"
+
+	if b.String() != exp || n != int64(len(exp)) {
+		t.Errorf("Unexpected result: %q (%d bytes) instead of %q", b.String(), n, exp)
+		return
+	}
+
+	// no allocations
+	w := StringBuilderStream(&b).w
+
+	b.Grow(1000)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		Newline(w)
+		Comma(w)
+		Digits[7](w)
+	})
+
+	if allocs != 0 {
+		t.Errorf("Unexpected number of allocations: %v", allocs)
+		return
+	}
+}
+
+func TestInMemorySinks(t *testing.T) {
+	const exp = "aaabbbcЫddd"
+
+	var buff bytes.Buffer
+	var sb strings.Builder
+
+	for _, s := range []Stream{ByteBufferStream(&buff), StringBuilderStream(&sb)} {
+		n, err := s.Write(String("aaa"), ByteSlice([]byte("bbb")), Byte('c'), Rune('Ы'), Reader(strings.NewReader("ddd")))
+
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if n != int64(len(exp)) || s.w.Offset() != n {
+			t.Errorf("Unexpected number of bytes: %d (offset %d) instead of %d", n, s.w.Offset(), len(exp))
+			return
+		}
+	}
+
+	if buff.String() != exp || sb.String() != exp {
+		t.Errorf("Unexpected results: %q and %q instead of %q", buff.String(), sb.String(), exp)
+		return
+	}
+}
+
+func BenchmarkByteBufferStream(b *testing.B) {
+	var buff bytes.Buffer
+
+	chunks := []Chunk{String("aaa"), Comma, Byte('b'), Newline}
+
+	s := ByteBufferStream(&buff)
+
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		buff.Reset()
+		s.Write(chunks...)
+	}
+}
+
+func BenchmarkStringBuilderStream(b *testing.B) {
+	chunks := []Chunk{String("aaa"), Comma, Byte('b'), Newline}
+
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		var sb strings.Builder
+
+		StringBuilderStream(&sb).Write(chunks...)
+	}
+}
+
+func TestSizeHint(t *testing.T) {
+	var buff bytes.Buffer
+	var sb strings.Builder
+
+	exp := strings.Repeat("z", 1000)
+
+	if _, err := ByteBufferStream(&buff).SizeHint(10000).Write(String(exp)); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if _, err := StringBuilderStream(&sb).SizeHint(10000).Write(String(exp)); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if buff.Cap() < 10000 || sb.Cap() < 10000 {
+		t.Errorf("Unexpected capacity: %d and %d", buff.Cap(), sb.Cap())
+		return
+	}
+
+	if buff.String() != exp || sb.String() != exp {
+		t.Error("Unexpected result")
+		return
+	}
+
+	// other streams ignore the hint
+	var w limitWriter
+
+	w.limit = 1000
+
+	if _, err := WriterStream(&w).SizeHint(10000).Write(String(exp)); err != nil {
+		t.Error(err)
+		return
+	}
+}
+
+func TestWriterFallbackAllocs(t *testing.T) {
+	var pw plainWriter
+
+	s := WriterStream(&pw)
+	chunks := []Chunk{Byte(','), Rune('Ы'), String("short string"), Space}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		if _, err := s.w.WriteChunks(chunks); err != nil {
+			t.Error(err)
+		}
+	})
+
+	if allocs != 0 {
+		t.Errorf("Unexpected number of allocations: %v", allocs)
+		return
+	}
+
+	if exp := 101 * int64(len(",Ыshort string ")); pw.n != exp {
+		t.Errorf("Unexpected number of bytes: %d instead of %d", pw.n, exp)
+		return
+	}
+}
+
+func BenchmarkWriterFallback(b *testing.B) {
+	var pw plainWriter
+
+	s := WriterStream(&pw)
+	chunks := []Chunk{Byte(','), Rune('Ы'), String("short string"), Space}
+
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		s.w.WriteChunks(chunks)
+	}
+}
+
+// io.Writer with no other methods
+type plainWriter struct {
+	n int64
+}
+
+func (w *plainWriter) Write(s []byte) (int, error) {
+	w.n += int64(len(s))
+	return len(s), nil
+}
+
+func TestWriterTo(t *testing.T) {
+	var b strings.Builder
+
+	bufs := net.Buffers{[]byte("Hello"), []byte(", "), []byte("world!")}
+
+	n, err := StringBuilderStream(&b).Write(WriterTo(bytes.NewReader([]byte(">> "))), WriterTo(&bufs))
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if exp := ">> Hello, world!"; b.String() != exp || n != int64(len(exp)) {
+		t.Errorf("Unexpected result: %q instead of %q", b.String(), exp)
+		return
+	}
+
+	// error from the stream
+	if _, err = WriterStream(&limitWriter{limit: 3}).Write(WriterTo(strings.NewReader("0123456789"))); err == nil {
+		t.Error("Missing error")
+		return
+	}
+}
+
+func TestLimitStream(t *testing.T) {
+	var b strings.Builder
+
+	s := LimitStream(StringBuilderStream(&b), 9)
+
+	n, err := s.Write(String("aaa"), Byte('b'), Rune('Ы'), String("cccc"))
+
+	if !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	if b.String() != "aaabЫccc" || n != 6 {
+		t.Errorf("Unexpected result: %q (%d bytes)", b.String(), n)
+		return
+	}
+
+	// the limit is shared by all the writes
+	if _, err = s.Write(Byte('z')); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+
+	// reader
+	b.Reset()
+
+	s = LimitStream(StringBuilderStream(&b), 5)
+
+	if _, err = s.Write(Reader(strings.NewReader("zzzzz"))); err != nil || b.String() != "zzzzz" {
+		t.Errorf("Unexpected result: %q, %v", b.String(), err)
+		return
+	}
+
+	b.Reset()
+
+	s = LimitStream(WriterBufferedStream(&b), 5)
+
+	if _, err = s.Write(Reader(strings.NewReader("zzzzzz"))); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("Unexpected error: %v", err)
+		return
+	}
+}
@@ -0,0 +1,346 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+/*
+Package stouttest provides utilities for testing code that writes files via stout package.
+The crash-consistency Harness replays a file write operation with a failure injected at each
+file system call the operation makes, verifying that the target file is always left either
+with the old or with the new content, and no temporary files remain on the disk.
+*/
+package stouttest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/maxim2266/stout"
+)
+
+// ErrInjected is the error returned from a file system call where a failure has been injected.
+var ErrInjected = errors.New("stouttest: injected failure")
+
+// Op is a file system call recorded by the Harness.
+type Op struct {
+	Name string // name of the call, like "write" or "rename"
+	Path string // file name(s) relative to the test directory
+}
+
+func (op Op) String() string {
+	return op.Name + " " + op.Path
+}
+
+// Harness checks crash consistency of a file write operation. For each file system call the
+// operation makes (as recorded from a successful run), the operation is replayed from the initial
+// state with that call failing, and the invariants are verified: the target file has either the old
+// or the new content, and (unless Crash is set) no other files are left in the target's directory.
+// The harness replaces the package-level file system of stout package (see stout.SetFileSystem)
+// for the duration of the check, so it must not be run in parallel with other tests writing files.
+type Harness struct {
+	Old []byte // content of the target before the write, or nil if the target does not exist
+	New []byte // content of the target after a successful write
+
+	// If set, a crash is simulated: all the calls after the injected failure fail as well,
+	// and the temporary files are allowed to remain, as no cleanup is possible after a crash.
+	Crash bool
+
+	// The operation under test, writing to the given target file.
+	Write func(target string) error
+}
+
+// Check runs the operation under test as described above, reporting any violations via
+// the given testing.TB. The function returns the recorded sequence of file system calls.
+func (h Harness) Check(t testing.TB) []Op {
+	t.Helper()
+
+	// record
+	fsys := &injectingFS{fail: -1}
+
+	dir, err := h.run(t, fsys)
+
+	if err != nil {
+		t.Errorf("operation failed without injected failure: %v", err)
+		return nil
+	}
+
+	if err = h.verify(dir); err != nil {
+		t.Errorf("after successful write: %v", err)
+		return nil
+	}
+
+	ops := fsys.ops
+
+	// replay with injected failures
+	for i, op := range ops {
+		fsys = &injectingFS{fail: i, crash: h.Crash}
+
+		if dir, err = h.run(t, fsys); err == nil && fsys.failed {
+			t.Errorf("failure at %q: not reported", op)
+			continue
+		}
+
+		if err = h.verify(dir); err != nil {
+			t.Errorf("failure at %q: %v", op, err)
+		}
+	}
+
+	return ops
+}
+
+// run the operation in a fresh directory with the initial state
+func (h Harness) run(t testing.TB, fsys *injectingFS) (dir string, err error) {
+	dir = t.TempDir()
+	fsys.dir = dir
+
+	target := filepath.Join(dir, "target")
+
+	if h.Old != nil {
+		if err = os.WriteFile(target, h.Old, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	defer stout.SetFileSystem(stout.SetFileSystem(fsys))
+
+	err = h.Write(target)
+	return
+}
+
+// check the invariants
+func (h Harness) verify(dir string) error {
+	data, err := os.ReadFile(filepath.Join(dir, "target"))
+
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		if h.Old != nil {
+			return errors.New("target file is missing")
+		}
+	case err != nil:
+		return err
+	case h.Old != nil && bytes.Equal(data, h.Old):
+		// ok
+	case bytes.Equal(data, h.New):
+		// ok
+	default:
+		return fmt.Errorf("target file has unexpected content: %q", truncate(data))
+	}
+
+	if h.Crash {
+		return nil
+	}
+
+	entries, err := os.ReadDir(dir)
+
+	if err != nil {
+		return err
+	}
+
+	var leftovers []string
+
+	for _, e := range entries {
+		if e.Name() != "target" {
+			leftovers = append(leftovers, e.Name())
+		}
+	}
+
+	if len(leftovers) > 0 {
+		return fmt.Errorf("files left over: %s", strings.Join(leftovers, ", "))
+	}
+
+	return nil
+}
+
+func truncate(data []byte) []byte {
+	if len(data) > 64 {
+		return data[:64]
+	}
+
+	return data
+}
+
+// file system recording the calls, and failing the call with the given index
+type injectingFS struct {
+	stout.OSFileSystem
+	dir    string
+	fail   int  // index of the call to fail, or -1
+	crash  bool // fail all calls after the failed one
+	failed bool // the failure has been injected
+	ops    []Op
+	lock   sync.Mutex
+}
+
+// record the call, and return an error if the call is to fail
+func (f *injectingFS) call(name string, paths ...string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	for i, p := range paths {
+		if rel, err := filepath.Rel(f.dir, p); err == nil {
+			paths[i] = rel
+		}
+	}
+
+	op := Op{Name: name, Path: strings.Join(paths, " -> ")}
+
+	if f.failed && f.crash || len(f.ops) == f.fail {
+		f.failed = true
+		f.ops = append(f.ops, op)
+		return &os.PathError{Op: name, Path: op.Path, Err: ErrInjected}
+	}
+
+	f.ops = append(f.ops, op)
+	return nil
+}
+
+func (f *injectingFS) OpenFile(name string, flag int, perm fs.FileMode) (stout.FileHandle, error) {
+	if err := f.call("open", name); err != nil {
+		return nil, err
+	}
+
+	return f.handle(f.OSFileSystem.OpenFile(name, flag, perm))
+}
+
+func (f *injectingFS) CreateTemp(dir, pattern string) (stout.FileHandle, error) {
+	if err := f.call("create-temp", dir); err != nil {
+		return nil, err
+	}
+
+	return f.handle(f.OSFileSystem.CreateTemp(dir, pattern))
+}
+
+func (f *injectingFS) Rename(oldpath, newpath string) error {
+	if err := f.call("rename", oldpath, newpath); err != nil {
+		return err
+	}
+
+	return f.OSFileSystem.Rename(oldpath, newpath)
+}
+
+func (f *injectingFS) Remove(name string) error {
+	if err := f.call("remove", name); err != nil {
+		return err
+	}
+
+	return f.OSFileSystem.Remove(name)
+}
+
+func (f *injectingFS) Link(oldname, newname string) error {
+	if err := f.call("link", oldname, newname); err != nil {
+		return err
+	}
+
+	return f.OSFileSystem.Link(oldname, newname)
+}
+
+func (f *injectingFS) Lstat(name string) (fs.FileInfo, error) {
+	if err := f.call("lstat", name); err != nil {
+		return nil, err
+	}
+
+	return f.OSFileSystem.Lstat(name)
+}
+
+func (f *injectingFS) Readlink(name string) (string, error) {
+	if err := f.call("readlink", name); err != nil {
+		return "", err
+	}
+
+	return f.OSFileSystem.Readlink(name)
+}
+
+func (f *injectingFS) Chtimes(name string, atime, mtime time.Time) error {
+	if err := f.call("chtimes", name); err != nil {
+		return err
+	}
+
+	return f.OSFileSystem.Chtimes(name, atime, mtime)
+}
+
+func (f *injectingFS) handle(fd stout.FileHandle, err error) (stout.FileHandle, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	return &injectingFile{fd, f}, nil
+}
+
+// file handle recording the calls
+type injectingFile struct {
+	stout.FileHandle
+	fs *injectingFS
+}
+
+func (f *injectingFile) Write(s []byte) (int, error) {
+	if err := f.fs.call("write", f.Name()); err != nil {
+		return 0, err
+	}
+
+	return f.FileHandle.Write(s)
+}
+
+func (f *injectingFile) Sync() error {
+	if err := f.fs.call("sync", f.Name()); err != nil {
+		return err
+	}
+
+	return f.FileHandle.Sync()
+}
+
+func (f *injectingFile) Chmod(mode fs.FileMode) error {
+	if err := f.fs.call("chmod", f.Name()); err != nil {
+		return err
+	}
+
+	return f.FileHandle.Chmod(mode)
+}
+
+func (f *injectingFile) Chown(uid, gid int) error {
+	if err := f.fs.call("chown", f.Name()); err != nil {
+		return err
+	}
+
+	return f.FileHandle.Chown(uid, gid)
+}
+
+func (f *injectingFile) Close() error {
+	// the descriptor is released even if the failure is injected
+	err := f.fs.call("close", f.Name())
+
+	if e := f.FileHandle.Close(); err == nil {
+		err = e
+	}
+
+	return err
+}
@@ -0,0 +1,116 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stouttest
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/maxim2266/stout"
+)
+
+func TestAtomicWriteFile(t *testing.T) {
+	for _, crash := range []bool{false, true} {
+		for _, old := range [][]byte{nil, []byte("old content")} {
+			h := Harness{
+				Old:   old,
+				New:   []byte("new content"),
+				Crash: crash,
+				Write: func(target string) error {
+					_, err := stout.AtomicWriteFile(target, 0644, stout.String("new content"))
+					return err
+				},
+			}
+
+			ops := h.Check(t)
+
+			if len(ops) == 0 {
+				t.Error("No calls recorded")
+				return
+			}
+
+			if last := ops[len(ops)-1]; last.Name != "rename" {
+				t.Errorf("Unexpected last call: %q", last)
+				return
+			}
+		}
+	}
+}
+
+func TestViolations(t *testing.T) {
+	// non-atomic write truncates the target before writing
+	rec := recorder{TB: t}
+
+	Harness{
+		Old: []byte("old content"),
+		New: []byte("new content"),
+		Write: func(target string) error {
+			_, err := stout.WriteFile(target, 0644, stout.String("new content"))
+			return err
+		},
+	}.Check(&rec)
+
+	if !strings.Contains(rec.String(), `failure at "write target": target file has unexpected content: ""`) {
+		t.Errorf("Unexpected report:\n%s", rec.String())
+		return
+	}
+
+	// leftovers
+	rec.Reset()
+
+	Harness{
+		New: []byte("new content"),
+		Write: func(target string) error {
+			if _, err := stout.WriteFile(target+".tmp", 0644, stout.String("new content")); err != nil {
+				return err
+			}
+
+			return os.Rename(target+".tmp", target)
+		},
+	}.Check(&rec)
+
+	if !strings.Contains(rec.String(), "files left over: target.tmp") {
+		t.Errorf("Unexpected report:\n%s", rec.String())
+		return
+	}
+}
+
+// testing.TB collecting the error messages
+type recorder struct {
+	testing.TB
+	strings.Builder
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...any) {
+	fmt.Fprintf(r, format+"\n", args...)
+}
@@ -0,0 +1,192 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"strconv"
+)
+
+// FileTarget is a disk file that gets written repeatedly, in different modes, but with the same
+// configuration. FileTarget objects are constructed by NewFileTarget function.
+type FileTarget struct {
+	pathname string
+	perm     fs.FileMode
+	root     *os.Root
+	codec    Codec
+	sync     bool
+	backup   string // backup file suffix, if any
+	keep     int    // number of rotated files to keep
+}
+
+// FileOption configures a FileTarget.
+type FileOption func(*FileTarget)
+
+// NewFileTarget constructs a FileTarget for the given file name, configured by the given options.
+// By default, the file is created with permission bits 0644, not synced to the disk when written,
+// without any backup, and with one rotated file kept.
+func NewFileTarget(pathname string, opts ...FileOption) *FileTarget {
+	t := &FileTarget{pathname: pathname, perm: 0644, keep: 1}
+
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	return t
+}
+
+// FilePerm sets the permission bits for a newly created file.
+func FilePerm(perm fs.FileMode) FileOption {
+	return func(t *FileTarget) { t.perm = perm }
+}
+
+// FileRoot confines the file operations to the given root directory (see os.Root).
+func FileRoot(root *os.Root) FileOption {
+	return func(t *FileTarget) { t.root = root }
+}
+
+// FileCodec sets the encoder (compressor) to write the data through, see also CodecForFile.
+func FileCodec(codec Codec) FileOption {
+	return func(t *FileTarget) { t.codec = codec }
+}
+
+// FileSync makes the file synced to the disk after each write. Replace() always syncs the file.
+func FileSync(sync bool) FileOption {
+	return func(t *FileTarget) { t.sync = sync }
+}
+
+// FileBackup makes Write() and Replace() keep the previous version of the file under the name
+// with the given suffix appended.
+func FileBackup(suffix string) FileOption {
+	return func(t *FileTarget) { t.backup = suffix }
+}
+
+// FileRotateKeep sets the number of rotated files kept by Rotate().
+func FileRotateKeep(num int) FileOption {
+	return func(t *FileTarget) { t.keep = num }
+}
+
+// Name returns the name of the file.
+func (t *FileTarget) Name() string { return t.pathname }
+
+// Write writes the given chunks to the file, overwriting any existing content.
+func (t *FileTarget) Write(chunks ...Chunk) (int64, error) {
+	if len(t.backup) > 0 {
+		// the original file is moved to the backup, and a new file is created
+		if err := t.moveToBackup(); err != nil {
+			return 0, err
+		}
+	}
+
+	return t.outputFile().Write(t.pathname, chunks...)
+}
+
+// Append appends the given chunks to the file. The file is created if does not exist.
+func (t *FileTarget) Append(chunks ...Chunk) (int64, error) {
+	return t.outputFile().Append(t.pathname, chunks...)
+}
+
+// Replace atomically replaces the file with the given chunks, like AtomicFile.Write() does.
+func (t *FileTarget) Replace(chunks ...Chunk) (int64, error) {
+	if len(t.backup) > 0 {
+		// the original file stays in place until it gets replaced
+		if err := t.linkToBackup(); err != nil {
+			return 0, err
+		}
+	}
+
+	return AtomicFile{Perm: t.perm, Root: t.root, Codec: t.codec}.Write(t.pathname, chunks...)
+}
+
+// Rotate renames the file to the name with suffix ".1", shifting the existing rotated files
+// (".1" to ".2", and so on), and removing the ones beyond the configured number of files to keep.
+// A missing file is not an error. The next Write() or Append() creates a new file.
+func (t *FileTarget) Rotate() (err error) {
+	ops := t.ops()
+
+	if t.keep <= 0 {
+		return ignoreNotExist(ops.remove(t.pathname))
+	}
+
+	if err = ignoreNotExist(ops.remove(t.rotated(t.keep))); err != nil {
+		return
+	}
+
+	for i := t.keep - 1; i > 0; i-- {
+		if err = ignoreNotExist(ops.rename(t.rotated(i), t.rotated(i+1))); err != nil {
+			return
+		}
+	}
+
+	return ignoreNotExist(ops.rename(t.pathname, t.rotated(1)))
+}
+
+// name of the rotated file with the given index
+func (t *FileTarget) rotated(i int) string {
+	return t.pathname + "." + strconv.Itoa(i)
+}
+
+func (t *FileTarget) outputFile() OutputFile {
+	return OutputFile{Perm: t.perm, Root: t.root, Codec: t.codec, Sync: t.sync}
+}
+
+func (t *FileTarget) ops() fileOps {
+	if t.root != nil {
+		return rootFileOps(t.root)
+	}
+
+	return osFileOps()
+}
+
+// rename the file to the backup name
+func (t *FileTarget) moveToBackup() error {
+	return ignoreNotExist(t.ops().rename(t.pathname, t.pathname+t.backup))
+}
+
+// hard-link the file to the backup name
+func (t *FileTarget) linkToBackup() (err error) {
+	ops := t.ops()
+	name := t.pathname + t.backup
+
+	if err = ignoreNotExist(ops.remove(name)); err == nil {
+		err = ignoreNotExist(ops.link(t.pathname, name))
+	}
+
+	return
+}
+
+func ignoreNotExist(err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,119 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileTarget(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "out.txt")
+	target := NewFileTarget(name, FilePerm(0600), FileSync(true), FileBackup(".bak"), FileRotateKeep(2))
+
+	steps := []struct {
+		op    func() error
+		files map[string]string
+	}{
+		{
+			func() error { _, err := target.Write(String("aaa")); return err },
+			map[string]string{"": "aaa"},
+		},
+		{
+			func() error { _, err := target.Append(String("bbb")); return err },
+			map[string]string{"": "aaabbb"},
+		},
+		{
+			func() error { _, err := target.Write(String("ccc")); return err },
+			map[string]string{"": "ccc", ".bak": "aaabbb"},
+		},
+		{
+			func() error { _, err := target.Replace(String("ddd")); return err },
+			map[string]string{"": "ddd", ".bak": "ccc"},
+		},
+		{
+			target.Rotate,
+			map[string]string{".1": "ddd"},
+		},
+		{
+			func() error { _, err := target.Write(String("eee")); return err },
+			map[string]string{"": "eee", ".1": "ddd"},
+		},
+		{
+			target.Rotate,
+			map[string]string{".1": "eee", ".2": "ddd"},
+		},
+		{
+			func() error {
+				if _, err := target.Write(String("fff")); err != nil {
+					return err
+				}
+
+				return target.Rotate()
+			},
+			map[string]string{".1": "fff", ".2": "eee", ".3": ""},
+		},
+	}
+
+	for i, step := range steps {
+		if err := step.op(); err != nil {
+			t.Errorf("step %d: %s", i, err)
+			return
+		}
+
+		for suffix, exp := range step.files {
+			data, err := os.ReadFile(name + suffix)
+
+			if len(exp) == 0 {
+				if !os.IsNotExist(err) {
+					t.Errorf("step %d: unexpected file %q", i, name+suffix)
+					return
+				}
+
+				continue
+			}
+
+			if err != nil {
+				t.Errorf("step %d: %s", i, err)
+				return
+			}
+
+			if string(data) != exp {
+				t.Errorf("step %d: unexpected content of %q: %q instead of %q", i, suffix, string(data), exp)
+				return
+			}
+		}
+	}
+
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Error("Unexpected file after rotation:", err)
+		return
+	}
+}
@@ -0,0 +1,145 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// Expand constructs a chunk function that writes the given string to a stream, with ${var} or $var
+// references replaced using the mapping function, as in os.Expand. The mapping function is called
+// at the time of writing, not at the time of the chunk construction.
+func Expand(s string, mapping func(string) string) Chunk {
+	return func(w *Writer) (int64, error) {
+		n, err := w.WriteString(os.Expand(s, mapping))
+		return int64(n), err
+	}
+}
+
+// ExpandEnv is like Expand, but with the references replaced by the values of the corresponding
+// environment variables at the time of writing, as in os.ExpandEnv.
+func ExpandEnv(s string) Chunk {
+	return Expand(s, os.Getenv)
+}
+
+// Placeholder constructs a chunk function that writes the chunk bound to the given name
+// by an enclosing Bind, and fails with an error if the name is not bound. Placeholders allow for
+// building reusable document skeletons, with the actual content supplied at the time of writing.
+// The bound chunks may themselves contain placeholders, but not circular references.
+func Placeholder(name string) Chunk {
+	return func(w *Writer) (n int64, err error) {
+		for s := w.scope; s != nil; s = s.parent {
+			if chunk, ok := s.values[name]; ok {
+				if s.active[name] {
+					return 0, fmt.Errorf("placeholder %q refers to itself", name)
+				}
+
+				if s.active == nil {
+					s.active = make(map[string]bool)
+				}
+
+				s.active[name] = true
+				n, err = chunk(w)
+				delete(s.active, name)
+				return
+			}
+		}
+
+		return 0, fmt.Errorf("placeholder %q is not bound", name)
+	}
+}
+
+// Bind constructs a chunk function that writes the given chunk with the placeholders within it
+// resolved to the chunks from the given map. Bindings can be nested, with the innermost binding
+// of a name taking precedence.
+func Bind(chunk Chunk, values map[string]Chunk) Chunk {
+	return func(w *Writer) (int64, error) {
+		saved := w.scope
+		w.scope = &bindingScope{values: values, parent: saved}
+
+		defer func() { w.scope = saved }()
+
+		return chunk(w)
+	}
+}
+
+// a level of placeholder bindings
+type bindingScope struct {
+	values map[string]Chunk
+	active map[string]bool // names being resolved
+	parent *bindingScope
+}
+
+// MaxIncludeDepth is the maximum nesting depth of Include chunks.
+const MaxIncludeDepth = 32
+
+// Include constructs a chunk function that writes the chunk returned from the resolver function
+// for the given file name, allowing for assembling documents from fragment files. The chunk
+// from the resolver may itself contain Include chunks, where relative file names are resolved
+// against the directory of the including file. Circular includes and nesting deeper than
+// MaxIncludeDepth result in an error. A nil resolver writes the file content as is (see File).
+func Include(pathname string, resolver func(string) (Chunk, error)) Chunk {
+	if resolver == nil {
+		resolver = func(name string) (Chunk, error) { return File(name), nil }
+	}
+
+	return func(w *Writer) (n int64, err error) {
+		name := pathname
+
+		if k := len(w.includes); k > 0 && !filepath.IsAbs(name) {
+			name = filepath.Join(filepath.Dir(w.includes[k-1]), name)
+		}
+
+		name = filepath.Clean(name)
+
+		if slices.Contains(w.includes, name) {
+			return 0, fmt.Errorf("circular include of %q", name)
+		}
+
+		if len(w.includes) >= MaxIncludeDepth {
+			return 0, fmt.Errorf("include of %q: nesting is too deep", name)
+		}
+
+		var chunk Chunk
+
+		if chunk, err = resolver(name); err != nil {
+			return
+		}
+
+		saved := w.includes
+		w.includes = append(saved[:len(saved):len(saved)], name)
+
+		defer func() { w.includes = saved }()
+
+		return chunk(w)
+	}
+}
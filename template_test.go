@@ -0,0 +1,198 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExpand(t *testing.T) {
+	chunk := ExpandEnv("user=${STOUT_TEST_USER}, home=$STOUT_TEST_HOME")
+
+	// late binding: the variables are set after the chunk is constructed
+	t.Setenv("STOUT_TEST_USER", "joe")
+	t.Setenv("STOUT_TEST_HOME", "/home/joe")
+
+	var b strings.Builder
+
+	_, err := StringBuilderStream(&b).Write(
+		chunk,
+		String("; "),
+		Expand("${a}-${b}", func(name string) string { return strings.ToUpper(name) }),
+	)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if exp := "user=joe, home=/home/joe; A-B"; b.String() != exp {
+		t.Errorf("Unexpected result: %q instead of %q", b.String(), exp)
+		return
+	}
+}
+
+func TestPlaceholder(t *testing.T) {
+	page := All(
+		String("<h1>"), Placeholder("title"), String("</h1>"),
+		Placeholder("body"),
+	)
+
+	var b strings.Builder
+
+	_, err := StringBuilderStream(&b).Write(
+		Bind(page, map[string]Chunk{
+			"title": String("Hello"),
+			"body": Bind(
+				All(String("<p>"), Placeholder("text"), String(" "), Placeholder("title"), String("</p>")),
+				map[string]Chunk{"text": String("Goodbye")},
+			),
+		}),
+		Bind(Optional(Placeholder("title"), String("n/a")), map[string]Chunk{"title": String("!")}),
+	)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if exp := "<h1>Hello</h1><p>Goodbye Hello</p>!"; b.String() != exp {
+		t.Errorf("Unexpected result: %q instead of %q", b.String(), exp)
+		return
+	}
+
+	// unbound name
+	_, err = StringBuilderStream(&b).Write(Bind(page, map[string]Chunk{"title": String("Hello")}))
+
+	if err == nil || !strings.Contains(err.Error(), `placeholder "body" is not bound`) {
+		t.Error("Unexpected error:", err)
+		return
+	}
+
+	// self-reference
+	_, err = StringBuilderStream(&b).Write(Bind(Placeholder("x"), map[string]Chunk{"x": Placeholder("x")}))
+
+	if err == nil {
+		t.Error("Missing error")
+		return
+	}
+}
+
+func TestInclude(t *testing.T) {
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"main.txt":        "main[@inc/a.txt]",
+		"inc/a.txt":       "a[@b.txt][@../c.txt]",
+		"inc/b.txt":       "b",
+		"c.txt":           "c",
+		"loop.txt":        "loop[@loop2.txt]",
+		"loop2.txt":       "loop2[@loop.txt]",
+		"inc/missing.txt": "[@nothing.txt]",
+	}
+
+	for name, content := range files {
+		name = filepath.Join(dir, name)
+
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Error(err)
+			return
+		}
+
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	// resolver that expands "[@name]" references
+	var resolver func(string) (Chunk, error)
+
+	resolver = func(name string) (Chunk, error) {
+		data, err := os.ReadFile(name)
+
+		if err != nil {
+			return nil, err
+		}
+
+		var chunks []Chunk
+
+		for s := string(data); len(s) > 0; {
+			i := strings.Index(s, "[@")
+
+			if i < 0 {
+				chunks = append(chunks, String(s))
+				break
+			}
+
+			j := strings.IndexByte(s[i:], ']') + i
+
+			chunks = append(chunks, String(s[:i]), Include(s[i+2:j], resolver))
+			s = s[j+1:]
+		}
+
+		return All(chunks...), nil
+	}
+
+	var b strings.Builder
+
+	if _, err := StringBuilderStream(&b).Write(Include(filepath.Join(dir, "main.txt"), resolver)); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if exp := "mainabc"; b.String() != exp {
+		t.Errorf("Unexpected result: %q instead of %q", b.String(), exp)
+		return
+	}
+
+	// errors
+	for _, name := range []string{"loop.txt", "inc/missing.txt"} {
+		if _, err := StringBuilderStream(&b).Write(Include(filepath.Join(dir, name), resolver)); err == nil {
+			t.Errorf("Missing error for %q", name)
+			return
+		}
+	}
+
+	// default resolver
+	b.Reset()
+
+	if _, err := StringBuilderStream(&b).Write(Include(filepath.Join(dir, "c.txt"), nil)); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if b.String() != "c" {
+		t.Errorf("Unexpected result: %q instead of %q", b.String(), "c")
+		return
+	}
+}
@@ -0,0 +1,86 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"errors"
+	"os"
+	"sync"
+)
+
+// TempSet is a collection of temporary files that are all removed by a single call
+// to Close function, typically deferred. The zero value is an empty set ready to use.
+// TempSet is safe for concurrent use.
+type TempSet struct {
+	names []string
+	lock  sync.Mutex
+}
+
+// WriteTempFile is like the package level WriteTempFile function, but also adds the
+// created file to the set.
+func (ts *TempSet) WriteTempFile(chunks ...Chunk) (string, int64, error) {
+	return ts.WriteTempFileIn("", "tmp-", chunks...)
+}
+
+// WriteTempFileIn is like the package level WriteTempFileIn function, but also adds the
+// created file to the set.
+func (ts *TempSet) WriteTempFileIn(dir, pattern string, chunks ...Chunk) (name string, n int64, err error) {
+	if name, n, err = WriteTempFileIn(dir, pattern, chunks...); err == nil {
+		ts.Add(name)
+	}
+
+	return
+}
+
+// Add adds the given file to the set.
+func (ts *TempSet) Add(name string) {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+
+	ts.names = append(ts.names, name)
+}
+
+// Close removes all the files in the set from the disk, and clears the set. The files that
+// do not exist are ignored. The first error encountered (if any) is returned, though the function
+// always attempts to remove all the files.
+func (ts *TempSet) Close() (err error) {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+
+	fsys := currentFS()
+
+	for _, name := range ts.names {
+		if e := fsys.Remove(name); e != nil && err == nil && !errors.Is(e, os.ErrNotExist) {
+			err = e
+		}
+	}
+
+	ts.names = nil
+	return
+}
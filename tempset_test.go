@@ -0,0 +1,111 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTempSet(t *testing.T) {
+	dir := t.TempDir()
+
+	var ts TempSet
+
+	defer ts.Close()
+
+	for i := 0; i < 3; i++ {
+		name, _, err := ts.WriteTempFileIn(dir, "zzz-*.txt", String("ZZZ"))
+
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if m, _ := filepath.Match(filepath.Join(dir, "zzz-*.txt"), name); !m {
+			t.Errorf("Unexpected file name: %q", name)
+			return
+		}
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*"))
+
+	if len(files) != 3 {
+		t.Errorf("Unexpected number of files: %d", len(files))
+		return
+	}
+
+	// remove one file to check that missing files are ignored
+	os.Remove(files[0])
+
+	if err := ts.Close(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if files, _ = filepath.Glob(filepath.Join(dir, "*")); len(files) != 0 {
+		t.Error("Found unexpected files:", files)
+		return
+	}
+}
+
+func TestTempFileKeepOnError(t *testing.T) {
+	dir := t.TempDir()
+
+	tf := TempFile{Dir: dir, Pattern: "zzz-", KeepOnError: true}
+
+	name, _, err := tf.Write(String("ZZZ"), func(_ *Writer) (int64, error) {
+		return 0, errors.New("test error")
+	})
+
+	if err == nil {
+		t.Error("Missing error")
+		return
+	}
+
+	if _, err = os.Stat(name); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// now without the flag
+	tf.KeepOnError = false
+
+	if name, _, err = tf.Write(func(_ *Writer) (int64, error) { return 0, errors.New("test error") }); err == nil || name != "" {
+		t.Error("Unexpected result:", name, err)
+		return
+	}
+
+	if files, _ := filepath.Glob(filepath.Join(dir, "*")); len(files) != 1 {
+		t.Error("Unexpected files:", files)
+		return
+	}
+}
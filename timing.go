@@ -0,0 +1,60 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import "time"
+
+// Timed constructs a chunk function that invokes the given chunk, and then calls the record
+// function with the time the chunk has taken to complete, whether successfully or not.
+func Timed(chunk Chunk, record func(time.Duration)) Chunk {
+	return func(w *Writer) (int64, error) {
+		start := clockNow()
+
+		defer func() { record(clockSince(start)) }()
+
+		return chunk(w)
+	}
+}
+
+// Elapsed constructs a chunk function that writes the time elapsed since the given moment,
+// rounded to the specified unit, in the format of time.Duration.String() function, like "3.2s".
+// The time is measured when the chunk is invoked, so it can be used, for example, in a report footer.
+// In the deterministic mode (see SetDeterministic) the chunk always writes zero duration.
+func Elapsed(since time.Time, round time.Duration) Chunk {
+	return func(w *Writer) (int64, error) {
+		var d time.Duration
+
+		if !IsDeterministic() {
+			d = clockSince(since).Round(round)
+		}
+
+		n, err := w.WriteString(d.String())
+		return int64(n), err
+	}
+}
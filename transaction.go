@@ -0,0 +1,108 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"errors"
+	"io"
+)
+
+// Checkpoint is a saved position in a stream, for use with Writer.Rollback() function.
+type Checkpoint struct {
+	pos    int64 // position in the underlying writer
+	offset int64 // stream offset
+}
+
+// Checkpoint saves the current position in the stream. The stream must be seekable and truncatable
+// (like a stream writing to an *os.File), otherwise ErrNotSeekable is returned. For buffered streams,
+// the buffer is flushed.
+func (w *Writer) Checkpoint() (cp Checkpoint, err error) {
+	if w.seek == nil || w.truncate == nil {
+		return cp, ErrNotSeekable
+	}
+
+	if cp.pos, err = w.seek(0, io.SeekCurrent); err != nil {
+		w.sinkErr = err
+		return
+	}
+
+	cp.offset = w.offset
+	return
+}
+
+// Rollback discards all the data written to the stream after the given checkpoint,
+// by truncating the underlying writer back to the checkpoint position. Any buffered
+// data are also discarded.
+func (w *Writer) Rollback(cp Checkpoint) (err error) {
+	if w.seek == nil || w.truncate == nil {
+		return ErrNotSeekable
+	}
+
+	if w.discard != nil {
+		w.discard()
+	}
+
+	if _, err = w.seek(cp.pos, io.SeekStart); err == nil {
+		if err = w.truncate(cp.pos); err == nil {
+			w.offset = cp.offset
+		}
+	}
+
+	return
+}
+
+// Transaction constructs a chunk function that invokes the given chunk, and if the chunk fails,
+// rolls the stream back to the position before the chunk, so that none of its output remains
+// in the stream. The stream must be seekable and truncatable (like a stream writing to a file),
+// otherwise the chunk fails with ErrNotSeekable. If the rollback itself fails, both errors
+// are returned.
+func Transaction(chunk Chunk) Chunk {
+	return func(w *Writer) (n int64, err error) {
+		var cp Checkpoint
+
+		if cp, err = w.Checkpoint(); err != nil {
+			return
+		}
+
+		if n, err = chunk(w); err != nil {
+			if e := w.Rollback(cp); e != nil {
+				return n, errors.Join(err, e)
+			}
+
+			n = 0
+		}
+
+		return
+	}
+}
+
+// io.Writer that can be truncated, like *os.File
+type truncater interface {
+	Truncate(int64) error
+}
@@ -0,0 +1,147 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTransaction(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "data")
+
+	fail := func(w *Writer) (int64, error) {
+		w.WriteString(strings.Repeat("x", 10000))
+		return 0, errors.New("test error")
+	}
+
+	for _, stream := range []func(*os.File) Stream{
+		func(f *os.File) Stream { return WriterStream(f) },
+		func(f *os.File) Stream { return WriterBufferedStream(f) },
+	} {
+		file, err := os.Create(name)
+
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		_, err = stream(file).Write(
+			String("aaa"),
+			Transaction(String("bbb")),
+			Transaction(fail),
+		)
+
+		file.Close()
+
+		if err == nil {
+			t.Error("Missing error")
+			return
+		}
+
+		// check the file content
+		var data []byte
+
+		if data, err = os.ReadFile(name); err != nil {
+			t.Error(err)
+			return
+		}
+
+		if string(data) != "aaabbb" {
+			t.Errorf("Unexpected file content of %d bytes", len(data))
+			return
+		}
+	}
+}
+
+func TestCheckpointRollback(t *testing.T) {
+	file, err := os.Create(filepath.Join(t.TempDir(), "data"))
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	defer file.Close()
+
+	s := WriterBufferedStream(file)
+
+	_, err = s.Write(
+		String("aaa"),
+		func(w *Writer) (n int64, err error) {
+			var cp Checkpoint
+
+			if cp, err = w.Checkpoint(); err != nil {
+				return
+			}
+
+			w.WriteString("bbb")
+
+			if err = w.Rollback(cp); err != nil {
+				return
+			}
+
+			if w.Offset() != 3 {
+				return 0, errors.New("unexpected offset after rollback")
+			}
+
+			return
+		},
+		String("ccc"),
+	)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	var data []byte
+
+	if data, err = os.ReadFile(file.Name()); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if string(data) != "aaaccc" {
+		t.Errorf("Unexpected file content: %q instead of %q", string(data), "aaaccc")
+		return
+	}
+
+	// not seekable
+	_, err = ByteBufferStream(new(bytes.Buffer)).Write(Transaction(String("aaa")))
+
+	if !errors.Is(err, ErrNotSeekable) {
+		t.Error("Unexpected error:", err)
+		return
+	}
+}
@@ -0,0 +1,365 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// TreeOption configures RenderTree function.
+type TreeOption func(*treeOptions)
+
+type treeOptions struct {
+	filePerm, dirPerm fs.FileMode
+
+	// manifest
+	manifest       string
+	newHash        func() hash.Hash
+	manifestFormat func([]ManifestEntry) Chunk
+
+	dryRun func(DryRunEntry)
+}
+
+// TreeFilePerm sets the permission bits of the files written by RenderTree (default 0644).
+func TreeFilePerm(perm fs.FileMode) TreeOption {
+	return func(o *treeOptions) { o.filePerm = perm }
+}
+
+// TreeDirPerm sets the permission bits of the directories created by RenderTree (default 0755).
+func TreeDirPerm(perm fs.FileMode) TreeOption {
+	return func(o *treeOptions) { o.dirPerm = perm }
+}
+
+// TreeDryRun makes RenderTree only report what would be written, without touching the disk: the given
+// function is called for each page (with the path of the file within the destination directory),
+// and then for each existing file in the destination that would be removed.
+func TreeDryRun(report func(DryRunEntry)) TreeOption {
+	return func(o *treeOptions) { o.dryRun = report }
+}
+
+// TreeManifest makes RenderTree write a manifest file with the given path (relative to the destination
+// directory) after all the pages. The manifest lists the path, size, digest (computed by a hash from
+// the given constructor while writing the page, in the same pass), and modification time of each page,
+// in the lexical order of paths. The manifest content is rendered by the format function, or by
+// ManifestJSON function if the format is nil.
+func TreeManifest(name string, newHash func() hash.Hash, format func([]ManifestEntry) Chunk) TreeOption {
+	if format == nil {
+		format = ManifestJSON
+	}
+
+	return func(o *treeOptions) {
+		o.manifest, o.newHash, o.manifestFormat = name, newHash, format
+	}
+}
+
+// ManifestEntry describes one file written by RenderTree function.
+type ManifestEntry struct {
+	Path    string    // path relative to the destination directory, with '/' separators
+	Size    int64     // file size
+	Digest  []byte    // file digest
+	ModTime time.Time // modification time
+}
+
+// ManifestJSON constructs a chunk function that writes the given manifest entries as a JSON array
+// of objects with fields "path", "size", "digest" (hex-encoded), and "mtime" (RFC 3339).
+func ManifestJSON(entries []ManifestEntry) Chunk {
+	return func(w *Writer) (int64, error) {
+		type entry struct {
+			Path    string    `json:"path"`
+			Size    int64     `json:"size"`
+			Digest  string    `json:"digest"`
+			ModTime time.Time `json:"mtime"`
+		}
+
+		list := make([]entry, len(entries))
+
+		for i, e := range entries {
+			list[i] = entry{e.Path, e.Size, hex.EncodeToString(e.Digest), e.ModTime}
+		}
+
+		data, err := json.MarshalIndent(list, "", "  ")
+
+		if err != nil {
+			return 0, err
+		}
+
+		return All(ByteSlice(data), Newline)(w)
+	}
+}
+
+// RenderTree writes the given pages (a map from a path relative to the destination directory
+// to a chunk rendering the file content) as a directory tree, replacing the destination directory.
+// The tree is first written to a staging directory next to the destination, and only upon
+// successful completion of all the writes the staging directory replaces the destination, so that
+// the destination never contains partial output, and files not present in the pages are removed.
+// The replacement is done by two renames (the destination is first moved aside, and then the staging
+// directory takes its place), so the destination path briefly does not exist in between.
+// On any error the staging directory is removed, and the destination is left untouched.
+// The page paths must be local (see filepath.IsLocal). The pages are written in the lexical order
+// of their paths. The function returns the total number of bytes written.
+func RenderTree(dstDir string, pages map[string]Chunk, opts ...TreeOption) (n int64, err error) {
+	o := treeOptions{filePerm: 0644, dirPerm: 0755}
+
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	dstDir = filepath.Clean(dstDir)
+
+	if o.dryRun != nil {
+		return o.dryRunTree(dstDir, pages)
+	}
+
+	// staging directory
+	var stage string
+
+	if stage, err = os.MkdirTemp(filepath.Dir(dstDir), "."+filepath.Base(dstDir)+".stage-"); err != nil {
+		return
+	}
+
+	defer func() {
+		if err != nil {
+			os.RemoveAll(stage)
+		}
+	}()
+
+	if err = os.Chmod(stage, o.dirPerm); err != nil {
+		return
+	}
+
+	// write pages
+	if n, err = o.writePages(stage, pages); err != nil {
+		return
+	}
+
+	// swap the directories
+	err = swapDir(stage, dstDir)
+	return
+}
+
+// write all the pages (and the manifest, if requested) to the given directory
+func (o *treeOptions) writePages(root string, pages map[string]Chunk) (n int64, err error) {
+	var manifest []ManifestEntry
+
+	for _, name := range sortedPages(pages) {
+		if len(o.manifest) > 0 && filepath.Clean(name) == filepath.Clean(o.manifest) {
+			return n, fmt.Errorf("page %q conflicts with the manifest", name)
+		}
+
+		chunk := pages[name]
+
+		var h hash.Hash
+
+		if len(o.manifest) > 0 {
+			h = o.newHash()
+			chunk = hashed(chunk, h)
+		}
+
+		var m int64
+
+		m, err = o.writePage(root, name, chunk)
+		n += m
+
+		if err != nil {
+			return
+		}
+
+		if h != nil {
+			mtime := CurrentTime()
+
+			if o.dryRun == nil && !IsDeterministic() {
+				var info fs.FileInfo
+
+				if info, err = currentFS().Lstat(filepath.Join(root, name)); err != nil {
+					return
+				}
+
+				mtime = info.ModTime()
+			}
+
+			manifest = append(manifest, ManifestEntry{
+				Path:    filepath.ToSlash(filepath.Clean(name)),
+				Size:    m,
+				Digest:  h.Sum(nil),
+				ModTime: mtime,
+			})
+		}
+	}
+
+	// write manifest
+	if len(o.manifest) > 0 {
+		var m int64
+
+		m, err = o.writePage(root, o.manifest, o.manifestFormat(manifest))
+		n += m
+
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// report the planned writes and removals without touching the disk
+func (o *treeOptions) dryRunTree(dstDir string, pages map[string]Chunk) (n int64, err error) {
+	if n, err = o.writePages(dstDir, pages); err != nil {
+		return
+	}
+
+	// files to remove
+	keep := make(map[string]bool, len(pages)+1)
+
+	for name := range pages {
+		keep[filepath.Clean(name)] = true
+	}
+
+	if len(o.manifest) > 0 {
+		keep[filepath.Clean(o.manifest)] = true
+	}
+
+	err = filepath.WalkDir(dstDir, func(pathname string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			if errors.Is(err, fs.ErrNotExist) && pathname == dstDir {
+				err = nil // nothing to remove
+			}
+
+			return err
+		}
+
+		name, err := filepath.Rel(dstDir, pathname)
+
+		if err != nil || keep[name] {
+			return err
+		}
+
+		info, err := d.Info()
+
+		if err == nil {
+			o.dryRun(DryRunEntry{Path: pathname, Size: info.Size(), Exists: true, Changed: true, Removed: true})
+		}
+
+		return err
+	})
+
+	return
+}
+
+// write one file of the tree
+func (o *treeOptions) writePage(root, name string, chunk Chunk) (n int64, err error) {
+	if !filepath.IsLocal(name) {
+		return 0, fmt.Errorf("page path %q is not local", name)
+	}
+
+	pathname := filepath.Join(root, name)
+
+	if o.dryRun != nil {
+		return OutputFile{DryRun: o.dryRun}.Write(pathname, chunk)
+	}
+
+	if err = os.MkdirAll(filepath.Dir(pathname), o.dirPerm); err != nil {
+		return
+	}
+
+	if n, err = (OutputFile{Perm: o.filePerm, ExactPerm: true}).Write(pathname, chunk); err != nil {
+		err = fmt.Errorf("page %q: %w", name, err)
+	}
+
+	return
+}
+
+// chunk that also feeds its output to the given hash
+func hashed(chunk Chunk, h hash.Hash) Chunk {
+	return func(w *Writer) (int64, error) {
+		return chunk(WriterStream(&teeWriter{w, h}).w.inherit(w))
+	}
+}
+
+// page paths in lexical order
+func sortedPages(pages map[string]Chunk) []string {
+	names := make([]string, 0, len(pages))
+
+	for name := range pages {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// replace the destination directory with the source one; the destination is missing
+// between the two renames
+func swapDir(src, dst string) (err error) {
+	fsys := currentFS()
+
+	// move the existing destination out of the way
+	var old string
+
+	if _, err = fsys.Lstat(dst); err == nil {
+		if old, err = os.MkdirTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".old-"); err != nil {
+			return
+		}
+
+		old = filepath.Join(old, "tree")
+
+		if err = fsys.Rename(dst, old); err != nil {
+			os.Remove(filepath.Dir(old))
+			return
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+
+	// move the source in place
+	if err = fsys.Rename(src, dst); err != nil {
+		if len(old) > 0 {
+			// try to restore the original
+			fsys.Rename(old, dst)
+			os.RemoveAll(filepath.Dir(old))
+		}
+
+		return
+	}
+
+	// the tree has been published, so failing to remove the old one is not an error
+	if len(old) > 0 {
+		os.RemoveAll(filepath.Dir(old))
+	}
+
+	return nil
+}
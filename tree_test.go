@@ -0,0 +1,240 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package stout
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+func TestRenderTree(t *testing.T) {
+	dst := filepath.Join(t.TempDir(), "site")
+
+	// initial tree
+	pages := map[string]Chunk{
+		"index.html":     String("index"),
+		"a/page.html":    String("page a"),
+		"a/b/page.html":  String("page b"),
+		"old/stale.html": String("stale"),
+	}
+
+	if _, err := RenderTree(dst, pages); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := checkTree(dst, map[string]string{
+		"index.html":     "index",
+		"a/page.html":    "page a",
+		"a/b/page.html":  "page b",
+		"old/stale.html": "stale",
+	}); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// update
+	delete(pages, "old/stale.html")
+	pages["index.html"] = String("new index")
+
+	n, err := RenderTree(dst, pages)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if n != int64(len("new index")+len("page a")+len("page b")) {
+		t.Errorf("Unexpected number of bytes: %d", n)
+		return
+	}
+
+	if err = checkTree(dst, map[string]string{
+		"index.html":    "new index",
+		"a/page.html":   "page a",
+		"a/b/page.html": "page b",
+	}); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// failure leaves the tree untouched
+	pages["index.html"] = func(_ *Writer) (int64, error) { return 0, errors.New("test error") }
+
+	if _, err = RenderTree(dst, pages); err == nil {
+		t.Error("Missing error")
+		return
+	}
+
+	if _, err = RenderTree(dst, map[string]Chunk{"../escape.html": String("x")}); err == nil {
+		t.Error("Missing error for non-local path")
+		return
+	}
+
+	if err = checkTree(dst, map[string]string{
+		"index.html":    "new index",
+		"a/page.html":   "page a",
+		"a/b/page.html": "page b",
+	}); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// no leftovers next to the destination
+	entries, err := os.ReadDir(filepath.Dir(dst))
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if len(entries) != 1 {
+		t.Errorf("Unexpected number of entries: %d", len(entries))
+		return
+	}
+}
+
+// compare the directory tree with the expected content
+func checkTree(dir string, exp map[string]string) error {
+	var names []string
+
+	err := filepath.WalkDir(dir, func(pathname string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		name, err := filepath.Rel(dir, pathname)
+
+		if err != nil {
+			return err
+		}
+
+		data, err := os.ReadFile(pathname)
+
+		if err != nil {
+			return err
+		}
+
+		if s, ok := exp[filepath.ToSlash(name)]; !ok || s != string(data) {
+			return errors.New("unexpected file " + name + ": " + string(data))
+		}
+
+		names = append(names, name)
+		return nil
+	})
+
+	if err == nil && len(names) != len(exp) {
+		sort.Strings(names)
+		err = errors.New("missing files")
+	}
+
+	return err
+}
+
+func TestRenderTreeManifest(t *testing.T) {
+	dst := filepath.Join(t.TempDir(), "site")
+
+	pages := map[string]Chunk{
+		"index.html":  String("index"),
+		"a/page.html": String("page a"),
+	}
+
+	format := func(entries []ManifestEntry) Chunk {
+		var chunks []Chunk
+
+		for _, e := range entries {
+			chunks = append(chunks, Join(" ", String(e.Path), String(strconv.FormatInt(e.Size, 10)), String(hex.EncodeToString(e.Digest))), Newline)
+		}
+
+		return All(chunks...)
+	}
+
+	if _, err := RenderTree(dst, pages, TreeManifest("MANIFEST", sha256.New, format)); err != nil {
+		t.Error(err)
+		return
+	}
+
+	sumA, sumIndex := sha256.Sum256([]byte("page a")), sha256.Sum256([]byte("index"))
+
+	exp := "a/page.html 6 " + hex.EncodeToString(sumA[:]) + "\n" +
+		"index.html 5 " + hex.EncodeToString(sumIndex[:]) + "\n"
+
+	if err := checkTree(dst, map[string]string{
+		"index.html":  "index",
+		"a/page.html": "page a",
+		"MANIFEST":    exp,
+	}); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// default format
+	if _, err := RenderTree(dst, pages, TreeManifest("manifest.json", sha256.New, nil)); err != nil {
+		t.Error(err)
+		return
+	}
+
+	data, err := os.ReadFile(filepath.Join(dst, "manifest.json"))
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	var list []struct {
+		Path   string `json:"path"`
+		Size   int64  `json:"size"`
+		Digest string `json:"digest"`
+	}
+
+	if err = json.Unmarshal(data, &list); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if len(list) != 2 || list[1].Path != "index.html" || list[1].Size != 5 || list[1].Digest != hex.EncodeToString(sumIndex[:]) {
+		t.Errorf("Unexpected manifest: %s", data)
+		return
+	}
+
+	// conflict
+	pages["manifest.json"] = String("x")
+
+	if _, err = RenderTree(dst, pages, TreeManifest("manifest.json", sha256.New, nil)); err == nil {
+		t.Error("Missing error")
+		return
+	}
+}
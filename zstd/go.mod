@@ -0,0 +1,8 @@
+module github.com/maxim2266/stout/zstd
+
+go 1.25
+
+require (
+	github.com/klauspost/compress v1.18.0
+	github.com/maxim2266/stout v0.0.0-20261015180058-26924c92f7ec
+)
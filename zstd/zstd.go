@@ -0,0 +1,58 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+/*
+Package zstd provides Zstandard compression for stout streams and chunks. The package is a separate
+module, so that the core package does not depend on the compression library.
+*/
+package zstd
+
+import (
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/maxim2266/stout"
+)
+
+// Codec returns a stout.Codec producing Zstandard encoders with the given options.
+func Codec(opts ...zstd.EOption) stout.Codec {
+	return func(w io.Writer) (io.WriteCloser, error) {
+		return zstd.NewWriter(w, opts...)
+	}
+}
+
+// Stream constructs a stream that writes Zstandard compressed data to the given io.Writer object.
+// The stream is for one-time use only, see stout.CompressedStream.
+func Stream(w io.Writer, opts ...zstd.EOption) (stout.Stream, error) {
+	return stout.CompressedStream(w, Codec(opts...))
+}
+
+// Compressed constructs a chunk function that writes the output of the given chunk Zstandard compressed.
+func Compressed(chunk stout.Chunk, opts ...zstd.EOption) stout.Chunk {
+	return stout.Compressed(chunk, Codec(opts...))
+}
@@ -0,0 +1,74 @@
+/*
+Copyright (c) 2019,2020,2021 Maxim Konakov
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without modification,
+are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its contributors
+   may be used to endorse or promote products derived from this software without
+   specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED.
+IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT,
+INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY
+OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE,
+EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package zstd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/maxim2266/stout"
+)
+
+func TestStream(t *testing.T) {
+	var b bytes.Buffer
+
+	s, err := Stream(&b, zstd.WithEncoderLevel(zstd.SpeedFastest))
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if _, err = s.Write(stout.RepeatN(1000, stout.String("ZZZ\n"))); err != nil {
+		t.Error(err)
+		return
+	}
+
+	dec, err := zstd.NewReader(&b)
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	defer dec.Close()
+
+	var res bytes.Buffer
+
+	if _, err = res.ReadFrom(dec); err != nil {
+		t.Error(err)
+		return
+	}
+
+	if exp := bytes.Repeat([]byte("ZZZ\n"), 1000); !bytes.Equal(res.Bytes(), exp) {
+		t.Error("Unexpected result")
+		return
+	}
+}